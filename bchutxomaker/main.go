@@ -130,6 +130,7 @@ func redeemByUserCmd() *cobra.Command {
 			txid := viper.GetString(flagTxid)
 			inTxid := viper.GetString(flagInTxid)
 			inVout := viper.GetUint(flagInVout)
+			scriptSig := viper.GetString(flagScriptSigHex)
 
 			tx := types.TxInfo{}
 			tx.Version = 2
@@ -137,10 +138,7 @@ func redeemByUserCmd() *cobra.Command {
 				tx.TxID = txid
 				tx.Hash = txid
 			}
-			tx.VinList = append(tx.VinList, map[string]interface{}{
-				"txid": inTxid,
-				"vout": inVout,
-			})
+			tx.VinList = append(tx.VinList, buildCovenantVin(inTxid, inVout, scriptSig))
 			tx.VoutList = append(tx.VoutList, types.Vout{
 				ScriptPubKey: map[string]interface{}{
 					"asm": "OP_DUP OP_HASH160 f1c075a01882ae0972f95d3a4177c86c852b7d91 OP_EQUALVERIFY OP_CHECKSIG",
@@ -158,6 +156,7 @@ func redeemByUserCmd() *cobra.Command {
 	cmd.Flags().String(flagTxid, "", "tx TXID")
 	cmd.Flags().String(flagInTxid, "", "input TXID")
 	cmd.Flags().Uint(flagInVout, 0, "input vout")
+	cmd.Flags().String(flagScriptSigHex, "", "scriptSig unlocking the cc-covenant, signed by operators")
 	_ = cmd.MarkFlagRequired(flagTxid)
 	_ = cmd.MarkFlagRequired(flagInTxid)
 	_ = cmd.MarkFlagRequired(flagInVout)
@@ -184,6 +183,7 @@ func convertByOperatorsCmd() *cobra.Command {
 			amt := viper.GetFloat64(flagAmt)
 			inTxid := viper.GetString(flagInTxid)
 			inVout := viper.GetUint(flagInVout)
+			scriptSig := viper.GetString(flagScriptSigHex)
 
 			tx := types.TxInfo{}
 			tx.Version = 2
@@ -191,10 +191,7 @@ func convertByOperatorsCmd() *cobra.Command {
 				tx.TxID = txid
 				tx.Hash = txid
 			}
-			tx.VinList = append(tx.VinList, map[string]interface{}{
-				"txid": inTxid,
-				"vout": inVout,
-			})
+			tx.VinList = append(tx.VinList, buildCovenantVin(inTxid, inVout, scriptSig))
 			tx.VoutList = append(tx.VoutList, types.Vout{
 				Value: amt,
 				ScriptPubKey: map[string]interface{}{
@@ -215,6 +212,7 @@ func convertByOperatorsCmd() *cobra.Command {
 	cmd.Flags().Float64(flagAmt, 0, "value of UTXO")
 	cmd.Flags().String(flagInTxid, "", "input TXID")
 	cmd.Flags().Uint(flagInVout, 0, "input vout")
+	cmd.Flags().String(flagScriptSigHex, "", "scriptSig unlocking the cc-covenant, signed by operators")
 	_ = cmd.MarkFlagRequired(flagTxid)
 	_ = cmd.MarkFlagRequired(flagCcCovenantAddr)
 	_ = cmd.MarkFlagRequired(flagAmt)
@@ -227,12 +225,22 @@ func convertByMonitorsCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "convert-by-monitors",
 		Short: "convert cc-UTXO by monitors",
+		Example: `go run github.com/smartbch/testkit/bchutxomaker convert-by-monitors \
+	--txid=c01ab2bfa4a7f64cf781e886844de836e7b45f2c6150de380cb891045e8353c9 \
+	--in-txid=4798e7b278130160bc5fdfe1d0f297786c9268a1631ea6a00f531e5f3e798f73 \
+	--in-vout=0 \
+	--amt=0.001 \
+	--cc-covenant-addr=6ad3f81523c87aa17f1dfa08271cf57b6277c98e`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if err := viper.BindPFlags(cmd.Flags()); err != nil {
 				return err
 			}
 
 			txid := viper.GetString(flagTxid)
+			ccCovenantAddr := viper.GetString(flagCcCovenantAddr)
+			amt := viper.GetFloat64(flagAmt)
+			inTxid := viper.GetString(flagInTxid)
+			inVout := viper.GetUint(flagInVout)
 
 			tx := types.TxInfo{}
 			tx.Version = 2
@@ -240,6 +248,21 @@ func convertByMonitorsCmd() *cobra.Command {
 				tx.TxID = txid
 				tx.Hash = txid
 			}
+			// monitors do not take the miner fee from the cc-UTXO, so the
+			// whole value is moved to the new covenant address
+			tx.VinList = append(tx.VinList, map[string]interface{}{
+				"txid": inTxid,
+				"vout": inVout,
+			})
+			tx.VoutList = append(tx.VoutList, types.Vout{
+				Value: amt,
+				ScriptPubKey: map[string]interface{}{
+					"asm": "OP_HASH160 " + ccCovenantAddr + " OP_EQUAL",
+				},
+			})
+
+			data, _ := json.Marshal(tx)
+			fmt.Printf(string(data))
 
 			return nil
 		},
@@ -247,6 +270,29 @@ func convertByMonitorsCmd() *cobra.Command {
 
 	cmd.Flags().SortFlags = false
 	cmd.Flags().String(flagTxid, "", "tx TXID")
+	cmd.Flags().String(flagCcCovenantAddr, "", "new P2SH address of cc-covenant")
+	cmd.Flags().Float64(flagAmt, 0, "value of UTXO")
+	cmd.Flags().String(flagInTxid, "", "input TXID")
+	cmd.Flags().Uint(flagInVout, 0, "input vout")
 	_ = cmd.MarkFlagRequired(flagTxid)
+	_ = cmd.MarkFlagRequired(flagCcCovenantAddr)
+	_ = cmd.MarkFlagRequired(flagAmt)
+	_ = cmd.MarkFlagRequired(flagInTxid)
+	_ = cmd.MarkFlagRequired(flagInVout)
 	return cmd
 }
+
+// buildCovenantVin builds the input spending a cc-UTXO, the scriptSig is
+// only kept for inspection since the fake node does not run scripts.
+func buildCovenantVin(inTxid string, inVout uint, scriptSig string) map[string]interface{} {
+	vin := map[string]interface{}{
+		"txid": inTxid,
+		"vout": inVout,
+	}
+	if scriptSig != "" {
+		vin["scriptSig"] = map[string]string{
+			"hex": scriptSig,
+		}
+	}
+	return vin
+}
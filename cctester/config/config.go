@@ -3,10 +3,13 @@ package config
 var BasePath = "/Users/bear/Documents/GitHub/smart_bch/"
 
 var (
-	TxMakerPath     = BasePath + "testkit/bchutxomaker/txmaker"
-	FakeNodePath    = BasePath + "testkit/bchnode/fakenode"
-	SideNodePath    = BasePath + "smartbch/smartbchd"
-	CcContractsPath = BasePath + "cc-contracts"
-	OperatorPath    = BasePath + "cc-operator/ccoperator"
-	CollectorPath   = BasePath + "testkit/fakecollector/fakecollector"
+	TxMakerPath      = BasePath + "testkit/bchutxomaker/txmaker"
+	FakeNodePath     = BasePath + "testkit/bchnode/fakenode"
+	SideNodePath     = BasePath + "smartbch/smartbchd"
+	CcContractsPath  = BasePath + "cc-contracts"
+	OperatorPath     = BasePath + "cc-operator/ccoperator"
+	FakeOperatorPath = BasePath + "testkit/fakeoperator/fakeoperator"
+	CollectorPath    = BasePath + "testkit/fakecollector/fakecollector"
+	// CollectorStatePath keeps the txs the fake collector submitted across its restarts
+	CollectorStatePath = BasePath + "testkit/fakecollector/fakecollector_state.json"
 )
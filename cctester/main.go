@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
 	"time"
@@ -14,6 +15,31 @@ import (
 )
 
 func main() {
+	var run string
+	var jsonReport string
+	var junitReport string
+	flag.StringVar(&run, "run", run, "only run the test cases whose names match this regexp")
+	flag.StringVar(&jsonReport, "json", jsonReport, "write the test results as JSON to this file")
+	flag.StringVar(&junitReport, "junit", junitReport, "write the test results as JUnit XML to this file")
+	flag.IntVar(&testcase.Load.Users, "load-users", testcase.Load.Users, "number of side chain users in TestMultiUserLoad")
+	flag.IntVar(&testcase.Load.UtxosPerBlock, "load-utxos", testcase.Load.UtxosPerBlock, "number of cc-UTXOs per main chain block in TestMultiUserLoad")
+	flag.IntVar(&testcase.Load.Blocks, "load-blocks", testcase.Load.Blocks, "number of main chain blocks with cc-UTXOs in TestMultiUserLoad")
+	flag.Int64Var(&testcase.Load.Seed, "load-seed", testcase.Load.Seed, "random seed of TestMultiUserLoad, for the users and amounts")
+	flag.Uint64Var(&testcase.Load.MinAmount, "load-min", testcase.Load.MinAmount, "min cc amount of smartbchd in satoshi")
+	flag.Uint64Var(&testcase.Load.MaxAmount, "load-max", testcase.Load.MaxAmount, "max cc amount of smartbchd in satoshi")
+	var fakeOperatorKeys string
+	flag.StringVar(&fakeOperatorKeys, "fake-operator-keys", "", "run the fake operators with the private keys in this file instead of cc-operator")
+	flag.Parse()
+	cases, err := testcase.Select(run)
+	if err != nil {
+		fmt.Println("invalid -run pattern:", err.Error())
+		os.Exit(2)
+	}
+	if len(cases) == 0 {
+		fmt.Println("no test case matches", run)
+		os.Exit(2)
+	}
+
 	key, _ := crypto.GenerateKey()
 	rpcKey := hex.EncodeToString(crypto.FromECDSA(key))
 	fmt.Printf("rpc key: %s\n", rpcKey)
@@ -35,12 +61,33 @@ func main() {
 	utils.InitSbchNodesGov(nodesGovAddr)
 	time.Sleep(3 * time.Second)
 	fmt.Println("-------------- start operators --------------")
-	go utils.StartOperators(nodesGovAddr)
+	if fakeOperatorKeys != "" {
+		go utils.StartFakeOperators(fakeOperatorKeys)
+	} else {
+		go utils.StartOperators(nodesGovAddr)
+	}
 	time.Sleep(3 * time.Second)
 	fmt.Println("-------------- start fake collector --------------")
 	go utils.StartFakeCollector()
 	time.Sleep(3 * time.Second)
 	fmt.Println("-------------- start test --------------")
-	go testcase.Test()
-	select {}
+	results := testcase.Run(cases)
+	if jsonReport != "" {
+		if err := testcase.WriteJSONReport(jsonReport, results); err != nil {
+			fmt.Println("failed to write JSON report:", err.Error())
+		}
+	}
+	if junitReport != "" {
+		if err := testcase.WriteJUnitReport(junitReport, results); err != nil {
+			fmt.Println("failed to write JUnit report:", err.Error())
+		}
+	}
+	fmt.Println("-------------- test results --------------")
+	for _, r := range results {
+		fmt.Printf("%s\t%s\t%.1fs\t%s\n", r.Status, r.Name, r.Duration, r.Message)
+	}
+	if testcase.Failed(results) {
+		os.Exit(1)
+	}
+	os.Exit(0)
 }
@@ -29,6 +29,12 @@ cd ../bchutxomaker
 go build -o txmaker main.go
 popd
 
+pushd $PWD
+echo 'build fakeoperator'
+cd ../fakeoperator
+go build -o fakeoperator github.com/smartbch/testkit/fakeoperator
+popd
+
 pushd $PWD
 echo 'build fakecollector'
 cd ../fakecollector
@@ -43,6 +49,7 @@ file ../../smartbch/smartbchd
 file ../../cc-operator/ccoperator
 file ../bchnode/fakenode 
 file ../bchutxomaker/txmaker
+file ../fakeoperator/fakeoperator
 file ../fakecollector/fakecollector
 
 echo 'run tests'
@@ -21,7 +21,8 @@ async function main() {
         gasPrice: 20000000000,
         gas: 4000000
     });
-    console.log(tx)
+    console.log(tx);
+    console.log('txHash:', tx.transactionHash);
 }
 
 module.exports = async function(callback) {
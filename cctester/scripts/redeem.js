@@ -40,17 +40,27 @@ async function main() {
             "type": "function"
         }
     ], '0x0000000000000000000000000000000000002714')
-    const tx = await cc.methods.redeem(
-        txid,
-        index,
-        targetAddress
-    ).send({
-        from: accounts[0],
-        value: amount,
-        gasPrice: 20000000000,
-        gas: 4000000
-    });
+    let tx;
+    try {
+        tx = await cc.methods.redeem(
+            txid,
+            index,
+            targetAddress
+        ).send({
+            from: accounts[0],
+            value: amount,
+            gasPrice: 20000000000,
+            gas: 4000000
+        });
+    } catch (error) {
+        // a reverted redeem is still mined, the cases check its receipt
+        if (!error.receipt) {
+            throw error;
+        }
+        tx = error.receipt;
+    }
     console.log(tx);
+    console.log('txHash:', tx.transactionHash);
 }
 
 module.exports = async function (callback) {
@@ -32,6 +32,7 @@ async function main() {
         gas: 4000000
     });
     console.log(tx);
+    console.log('txHash:', tx.transactionHash);
 }
 
 module.exports = async function(callback) {
@@ -0,0 +1,202 @@
+package testcase
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/bchec"
+	"github.com/gcash/bchd/txscript"
+
+	"github.com/smartbch/testkit/bchnode/generator/types"
+	"github.com/smartbch/testkit/cctester/utils"
+)
+
+// mainnetTxTimeout is how long we wait for the fake collector to get a
+// redeem or convert tx mined by the fake node.
+var mainnetTxTimeout = 60 * time.Second
+
+func waitSideChainHeight(height uint64) {
+	latestSideChainHeight := utils.GetSideChainBlockHeight()
+	for latestSideChainHeight <= height {
+		fmt.Printf("side chain height:%d\n", latestSideChainHeight)
+		time.Sleep(5 * time.Second)
+		latestSideChainHeight = utils.GetSideChainBlockHeight()
+	}
+}
+
+// currCovenantAddress returns the covenant address the cc-UTXOs are sent to.
+func currCovenantAddress() string {
+	return utils.GetCcInfo().CurrCovenantAddress
+}
+
+// lastCovenantAddress returns the covenant address before the last change,
+// the covenant is changed first if it has not changed yet.
+func lastCovenantAddress(t *T) string {
+	info := utils.GetCcInfo()
+	if common.HexToAddress(info.LastCovenantAddress) == (common.Address{}) {
+		changeCovenant(t, info.CurrCovenantAddress)
+		info = utils.GetCcInfo()
+	}
+	return info.LastCovenantAddress
+}
+
+// changeCovenant lets the side chain apply the monitors' vote sent by main,
+// and returns the new covenant address.
+func changeCovenant(t *T, old string) string {
+	waitSideChainHeight(70)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(6 * time.Second)
+	curr := currCovenantAddress()
+	if strings.EqualFold(curr, old) {
+		t.Fatalf("covenant address did not change from %s", old)
+	}
+	return curr
+}
+
+func findUtxo(utxos []*utils.UtxoInfo, txid string) *utils.UtxoInfo {
+	for _, utxo := range utxos {
+		if utxo.Txid.String() == strings.ToLower(txid) {
+			return utxo
+		}
+	}
+	return nil
+}
+
+// checkMainnetRedeemed makes sure the cc-UTXO has been spent on the main
+// chain after the fake node's block at fromHeight.
+func checkMainnetRedeemed(t *T, txid string, fromHeight int64) *types.TxInfo {
+	tx := utils.WaitMainnetSpendingTx(txid, 0, fromHeight, mainnetTxTimeout)
+	if tx == nil {
+		t.Fatalf("cc-UTXO %s is not redeemed on main chain", txid)
+	}
+	return tx
+}
+
+// checkMainnetConverted makes sure the cc-UTXO has been moved to the new
+// covenant address on the main chain with the expected value, and returns
+// the convert tx.
+func checkMainnetConverted(t *T, txid string, fromHeight int64, newCovenantAddress string, amountInSatoshi uint64) *types.TxInfo {
+	tx := utils.WaitMainnetSpendingTx(txid, 0, fromHeight, mainnetTxTimeout)
+	if tx == nil {
+		t.Fatalf("cc-UTXO %s is not converted on main chain", txid)
+	}
+	if len(tx.VoutList) == 0 {
+		t.Fatalf("convert tx of %s has no output", txid)
+	}
+	addr := utils.GetCovenantAddrOfVout(tx.VoutList[0])
+	if !strings.EqualFold(strings.TrimPrefix(addr, "0x"), strings.TrimPrefix(newCovenantAddress, "0x")) {
+		t.Fatalf("cc-UTXO %s is converted to %s instead of %s", txid, addr, newCovenantAddress)
+	}
+	if value := uint64(math.Round(tx.VoutList[0].Value * 1e8)); value != amountInSatoshi {
+		t.Fatalf("cc-UTXO %s is converted with value %d instead of %d", txid, value, amountInSatoshi)
+	}
+	return tx
+}
+
+// operatorSigners returns the indexes of the operators whose signature of
+// txSigHash is pushed by the scriptSig of the first input of tx.
+func operatorSigners(tx *types.TxInfo, txSigHash []byte, operators []*utils.FakeOperatorInfo) map[int]bool {
+	signers := make(map[int]bool)
+	if len(tx.VinList) == 0 {
+		return signers
+	}
+	scriptSig, _ := tx.VinList[0]["scriptSig"].(map[string]interface{})
+	scriptHex, _ := scriptSig["hex"].(string)
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil {
+		return signers
+	}
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return signers
+	}
+	for _, push := range pushes {
+		if len(push) < 2 {
+			continue
+		}
+		sig, err := bchec.ParseDERSignature(push[:len(push)-1], bchec.S256())
+		if err != nil {
+			continue
+		}
+		for _, op := range operators {
+			pubkeyBytes, _ := hex.DecodeString(op.Pubkey)
+			pubkey, err := bchec.ParsePubKey(pubkeyBytes, bchec.S256())
+			if err == nil && sig.Verify(txSigHash, pubkey) {
+				signers[op.Index] = true
+			}
+		}
+	}
+	return signers
+}
+
+// checkBalances fails the case if any account tracked by the checker did not
+// get the expected amount, the gas paid for the txs is accounted precisely.
+func checkBalances(t *T, checker *utils.BalanceChecker) {
+	if err := checker.Check(); err != nil {
+		t.Fatalf("%s", err)
+	}
+}
+
+func checkTxSucceeded(t *T, receipt *utils.TxReceipt) {
+	if !receipt.Succeeded() {
+		t.Fatalf("tx %s failed: %s", receipt.TransactionHash.String(), receipt.Reason())
+	}
+}
+
+// checkTxFailed makes sure smartbchd rejected the tx for the expected reason.
+func checkTxFailed(t *T, receipt *utils.TxReceipt, reason string) {
+	if receipt.Succeeded() {
+		t.Fatalf("tx %s should fail with %q", receipt.TransactionHash.String(), reason)
+	}
+	if receipt.Reason() != reason {
+		t.Fatalf("tx %s failed with %q instead of %q", receipt.TransactionHash.String(), receipt.Reason(), reason)
+	}
+}
+
+// checkNoUtxoRecord makes sure smartbchd ignored the main chain tx.
+func checkNoUtxoRecord(t *T, txid string) {
+	lists := map[string][]*utils.UtxoInfo{
+		"redeemable":      utils.GetRedeemableUTXOs(),
+		"redeeming":       utils.GetRedeemingUTXOs(),
+		"lost-and-found":  utils.GetLostAndFoundUTXOs(),
+		"to-be-converted": utils.GetToBeConvertedUTXOs(),
+	}
+	for name, utxos := range lists {
+		if findUtxo(utxos, txid) != nil {
+			t.Fatalf("UTXO %s should not be recorded, but it is %s", txid, name)
+		}
+	}
+}
+
+// waitMainnetTx waits for the cc tx to be mined by the fake node and returns
+// the height of its block.
+func waitMainnetTx(t *T, txid string, fromHeight int64) int64 {
+	deadline := time.Now().Add(mainnetTxTimeout)
+	for {
+		height := utils.FindMainnetTx(txid, fromHeight)
+		if height >= 0 {
+			return height
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cc tx %s is not mined on main chain", txid)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// checkSubmittedOnce makes sure the fake collector submitted exactly one tx
+// for the cc-UTXO, and the fake node mined exactly one tx spending it.
+func checkSubmittedOnce(t *T, kind, txid string, fromHeight int64) {
+	submissions := utils.GetCollectorSubmissions(kind, txid, 0)
+	if len(submissions) != 1 {
+		t.Fatalf("expected 1 %s submission of %s, got %d", kind, txid, len(submissions))
+	}
+	spending := utils.FindMainnetSpendingTxs(txid, 0, fromHeight)
+	if len(spending) != 1 {
+		t.Fatalf("expected 1 main chain tx spending %s, got %d", txid, len(spending))
+	}
+}
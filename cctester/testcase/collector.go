@@ -0,0 +1,154 @@
+package testcase
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/smartbch/testkit/cctester/utils"
+)
+
+// TestCollectorRestart restarts the fake collector while the redeemed
+// cc-UTXO is still listed as redeeming, the collector must remember it has
+// already submitted the redeem tx and not submit it again.
+func TestCollectorRestart(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendHandleUTXOTx()))
+	time.Sleep(4 * time.Second)
+	fmt.Println(`-------------------- send redeem tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")))
+	time.Sleep(4 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
+	if findUtxo(utils.GetRedeemingUTXOs(), txid) == nil {
+		t.Fatalf("UTXO %s should still be redeeming before the next rescan", txid)
+	}
+	fmt.Println(`-------------------- restart fake collector -------------------`)
+	utils.StopFakeCollector()
+	go utils.StartFakeCollector()
+	// give the restarted collector a few rounds to resubmit, if it would
+	time.Sleep(10 * time.Second)
+	checkSubmittedOnce(t, "redeem", txid, mainHeight)
+	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(15 * time.Second)
+	fmt.Println(`--------------------- send handle utxo tx second time -------------------`)
+	utils.BuildAndSendHandleUTXOTx()
+	time.Sleep(4 * time.Second)
+	if findUtxo(utils.GetRedeemingUTXOs(), txid) != nil {
+		t.Fatalf("UTXO %s should not be redeeming any more", txid)
+	}
+	checkSubmittedOnce(t, "redeem", txid, mainHeight)
+}
+
+// TestCollectorRejectsTamperedUtxos runs the fake collector behind a man in
+// the middle which flips bytes of the UtxoInfos, the collector must refuse
+// them and redeem nothing until it talks to smartbchd directly again.
+func TestCollectorRejectsTamperedUtxos(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	fmt.Println(`-------------------- restart fake collector in mitm mode -------------------`)
+	utils.StopFakeCollector()
+	go utils.StartFakeCollector("-mitm")
+	defer func() {
+		utils.StopFakeCollector()
+		go utils.StartFakeCollector()
+		time.Sleep(3 * time.Second)
+	}()
+	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendHandleUTXOTx()))
+	time.Sleep(4 * time.Second)
+	fmt.Println(`-------------------- send redeem tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")))
+	time.Sleep(20 * time.Second)
+	if n := len(utils.GetCollectorSubmissions("redeem", txid, 0)); n != 0 {
+		t.Fatalf("collector submitted %d redeem txs of %s from tampered UtxoInfos", n, txid)
+	}
+	if tx := utils.FindMainnetSpendingTx(txid, 0, mainHeight); tx != nil {
+		t.Fatalf("cc-UTXO %s is redeemed by %s from tampered UtxoInfos", txid, tx.Hash)
+	}
+	fmt.Println(`-------------------- restart fake collector without mitm -------------------`)
+	utils.StopFakeCollector()
+	go utils.StartFakeCollector()
+	checkMainnetRedeemed(t, txid, mainHeight)
+	checkSubmittedOnce(t, "redeem", txid, mainHeight)
+	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(15 * time.Second)
+	fmt.Println(`--------------------- send handle utxo tx second time -------------------`)
+	utils.BuildAndSendHandleUTXOTx()
+	time.Sleep(4 * time.Second)
+	if findUtxo(utils.GetRedeemingUTXOs(), txid) != nil {
+		t.Fatalf("UTXO %s should not be redeeming any more", txid)
+	}
+}
+
+// TestFakeOperatorSigs redeems a cc-UTXO while three of the fake operators
+// sign wrongly, time out or fail, the redeem tx must still carry valid
+// signatures of seven of the others. It needs -fake-operator-keys.
+func TestFakeOperatorSigs(t *T) {
+	if !utils.FakeOperatorsStarted() {
+		t.Logf("skipped, the fake operators are not running")
+		return
+	}
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	operators := utils.GetFakeOperators()
+	faulty := operators[:3]
+	for i, mode := range []string{"wrong-sig", "delay", "error"} {
+		utils.SetFakeOperatorFault(faulty[i], mode)
+	}
+	defer func() {
+		for _, op := range faulty {
+			utils.SetFakeOperatorFault(op, "none")
+		}
+	}()
+	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendHandleUTXOTx()))
+	time.Sleep(4 * time.Second)
+	fmt.Println(`-------------------- send redeem tx -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")))
+	utxo := findUtxo(utils.GetRedeemingUTXOs(), txid)
+	if utxo == nil {
+		t.Fatalf("UTXO %s is not redeeming", txid)
+	}
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	tx := checkMainnetRedeemed(t, txid, mainHeight)
+	signers := operatorSigners(tx, utxo.TxSigHash, operators)
+	if len(signers) < 7 {
+		t.Fatalf("redeem tx %s is signed by %d operators, need 7", tx.Hash, len(signers))
+	}
+	for _, op := range faulty {
+		if signers[op.Index] {
+			t.Fatalf("redeem tx %s has a signature of the faulty operator #%d", tx.Hash, op.Index)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package testcase
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/testkit/cctester/utils"
+)
+
+// LoadConfig controls TestMultiUserLoad, main sets it from the command line.
+// MinAmount and MaxAmount are in satoshi and must match the MinCCAmount and
+// MaxCCAmount of the smartbchd build under test, the defaults are those of
+// its params_testnet build.
+type LoadConfig struct {
+	Users         int
+	UtxosPerBlock int
+	Blocks        int
+	Seed          int64
+	MinAmount     uint64
+	MaxAmount     uint64
+}
+
+var Load = LoadConfig{
+	Users:         10,
+	UtxosPerBlock: 5,
+	Blocks:        3,
+	Seed:          1,
+	MinAmount:     1_00000000,
+	MaxAmount:     1000_00000000,
+}
+
+const (
+	amountInRange  = "in-range"
+	amountAboveMax = "above-max"
+	amountBelowMin = "below-min"
+)
+
+type loadUtxo struct {
+	txid     string
+	receiver string
+	amount   uint64 // in satoshi
+	class    string
+}
+
+// TestMultiUserLoad is a local counterpart of the pressure tool: it sends
+// cc-UTXOs with random amounts to many side chain users through the fake
+// node, then checks every user got exactly what the cc rules give them.
+func TestMultiUserLoad(t *T) {
+	cfg := Load
+	if cfg.Users <= 0 || cfg.UtxosPerBlock <= 0 || cfg.Blocks <= 0 || cfg.MinAmount < 10 || cfg.MaxAmount <= cfg.MinAmount {
+		t.Fatalf("invalid load config: %+v", cfg)
+	}
+	var covenantAddress = currCovenantAddress()
+	r := rand.New(rand.NewSource(cfg.Seed))
+	users := loadUsers(cfg.Seed, cfg.Users)
+	t.Logf("seed %d, %d users, %d UTXOs per block, %d blocks", cfg.Seed, cfg.Users, cfg.UtxosPerBlock, cfg.Blocks)
+
+	checker := utils.NewBalanceChecker(users...)
+	var utxos []*loadUtxo
+	for blk := 0; blk < cfg.Blocks; blk++ {
+		var batch []*loadUtxo
+		for i := 0; i < cfg.UtxosPerBlock; i++ {
+			class, amount := randLoadAmount(r, cfg)
+			batch = append(batch, &loadUtxo{
+				txid:     t.NewTxid(),
+				receiver: users[r.Intn(len(users))],
+				amount:   amount,
+				class:    class,
+			})
+		}
+		fmt.Printf("-------------------- send %d cc transfer txs of block %d -------------------\n", len(batch), blk)
+		height := utils.GetMainnetBlockCount()
+		var wg sync.WaitGroup
+		for _, u := range batch {
+			wg.Add(1)
+			go func(u *loadUtxo) {
+				defer wg.Done()
+				utils.BuildAndSendTransferTx(u.txid, covenantAddress, u.receiver, formatSatoshi(u.amount))
+			}(u)
+		}
+		wg.Wait()
+		waitMainnetBlockAfter(height + 1)
+		utxos = append(utxos, batch...)
+
+		fmt.Println(`-------------------- send startRescan tx -------------------`)
+		checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendStartRescanTx()))
+		time.Sleep(15 * time.Second)
+		fmt.Println(`-------------------- send handle utxo tx -------------------`)
+		checkTxSucceeded(t, utils.GetTxReceipt(utils.BuildAndSendHandleUTXOTx()))
+		time.Sleep(4 * time.Second)
+	}
+
+	fmt.Println(`-------------------- reconcile balances and utxo records -------------------`)
+	redeemable := utils.GetRedeemableUTXOs()
+	redeeming := utils.GetRedeemingUTXOs()
+	lostAndFound := utils.GetLostAndFoundUTXOs()
+	var mismatches []string
+	for _, u := range utxos {
+		credited := false
+		switch {
+		case findUtxo(redeemable, u.txid) != nil:
+			credited = true
+			if u.class != amountInRange {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%s %d) is redeemable", u.txid, u.class, u.amount))
+			}
+		case findUtxo(lostAndFound, u.txid) != nil:
+			lost := findUtxo(lostAndFound, u.txid)
+			if strings.ToLower(lost.OwnerOfLost.String()) != u.receiver {
+				mismatches = append(mismatches, fmt.Sprintf("%s is lost and found for %s instead of %s", u.txid, lost.OwnerOfLost.String(), u.receiver))
+			}
+			if u.class == amountInRange {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%s %d) is lost and found", u.txid, u.class, u.amount))
+			}
+		case findUtxo(redeeming, u.txid) != nil:
+			// small UTXOs are burnt on main chain when there is enough
+			// pending burning, and the receiver is paid on side chain
+			credited = true
+			if u.class != amountBelowMin {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%s %d) is redeeming", u.txid, u.class, u.amount))
+			}
+		default:
+			mismatches = append(mismatches, fmt.Sprintf("%s (%s %d) has no UTXO record", u.txid, u.class, u.amount))
+		}
+		if credited {
+			checker.Expect(u.receiver, new(big.Int).Mul(new(big.Int).SetUint64(u.amount), big.NewInt(1e10)))
+		}
+	}
+	if err := checker.Check(); err != nil {
+		mismatches = append(mismatches, err.Error())
+	}
+	for _, m := range mismatches {
+		t.Logf("mismatch: %s", m)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("%d mismatches in %d UTXOs, rerun with -load-seed=%d to reproduce", len(mismatches), len(utxos), cfg.Seed)
+	}
+}
+
+// loadUsers derives the side chain addresses of the users from the seed, so
+// that a failed run can be reproduced.
+func loadUsers(seed int64, n int) []string {
+	users := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var buf [16]byte
+		binary.BigEndian.PutUint64(buf[:8], uint64(seed))
+		binary.BigEndian.PutUint64(buf[8:], uint64(i))
+		h := sha256.Sum256(buf[:])
+		key, err := crypto.ToECDSA(h[:])
+		if err != nil {
+			panic(err)
+		}
+		users = append(users, strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).String()))
+	}
+	return users
+}
+
+// randLoadAmount mostly picks amounts within the cc bounds, and sometimes
+// amounts below or above them.
+func randLoadAmount(r *rand.Rand, cfg LoadConfig) (string, uint64) {
+	switch n := r.Intn(10); {
+	case n == 0:
+		return amountBelowMin, cfg.MinAmount/10 + uint64(r.Int63n(int64(cfg.MinAmount*8/10)))
+	case n == 1:
+		return amountAboveMax, cfg.MaxAmount + 1 + uint64(r.Int63n(int64(cfg.MaxAmount)))
+	default:
+		return amountInRange, cfg.MinAmount + uint64(r.Int63n(int64(cfg.MaxAmount-cfg.MinAmount+1)))
+	}
+}
+
+func formatSatoshi(amount uint64) string {
+	return fmt.Sprintf("%d.%08d", amount/1e8, amount%1e8)
+}
+
+func waitMainnetBlockAfter(height int64) {
+	for utils.GetMainnetBlockCount() <= height {
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,210 @@
+package testcase
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/holiman/uint256"
+
+	"github.com/smartbch/testkit/cctester/utils"
+)
+
+// The cases below feed smartbchd with main chain txs it should ignore or
+// reject. The sender of the side chain txs is also the receiver in the
+// happy paths, so its balance must only change by the gas it paid.
+
+func TestTransferWithMalformedOpReturn(t *T) {
+	var txid = t.NewTxid()
+	var covenantAddress = currCovenantAddress()
+	var sender string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var receiver string = "not-an-address"
+	var amount string = "1"
+	fmt.Println(`-------------------- send cc transfer tx with malformed OP_RETURN -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	checker := utils.NewBalanceChecker(sender)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	checkNoUtxoRecord(t, txid)
+}
+
+func TestTransferToWrongCovenantAddress(t *T) {
+	var txid = t.NewTxid()
+	var wrongCovenantAddress = "0x0000000000000000000000000000000000000003"
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	fmt.Println(`-------------------- send cc transfer tx to wrong covenant address -------------------`)
+	utils.BuildAndSendTransferTx(txid, wrongCovenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	checker := utils.NewBalanceChecker(receiver)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	checkNoUtxoRecord(t, txid)
+}
+
+// TestTransferWithDuplicateTxid sends the same cc tx in two main chain
+// blocks, the receiver must only be paid once.
+func TestTransferWithDuplicateTxid(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e8), uint256.NewInt(1e10))
+	fmt.Println(`-------------------- send the same cc transfer tx twice -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	checker := utils.NewBalanceChecker(receiver)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	checker.Expect(receiver, amountInSideChain.ToBig())
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	count := 0
+	for _, utxo := range utils.GetRedeemableUTXOs() {
+		if utxo.Txid.String() == txid {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 redeemable UTXO for duplicate txid, got %d", count)
+	}
+	fmt.Println(`-------------------- send redeem tx -------------------`)
+	checker = utils.NewBalanceChecker(receiver)
+	checkTxSucceeded(t, checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")))
+	time.Sleep(4 * time.Second)
+	checker.Expect(receiver, new(big.Int).Neg(amountInSideChain.ToBig()))
+	checkBalances(t, checker)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
+}
+
+func TestRedeemAlreadyRedeemed(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e8), uint256.NewInt(1e10))
+	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	utils.BuildAndSendHandleUTXOTx()
+	time.Sleep(4 * time.Second)
+	fmt.Println(`-------------------- send redeem tx twice -------------------`)
+	checker := utils.NewBalanceChecker(receiver)
+	checkTxSucceeded(t, checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")))
+	time.Sleep(4 * time.Second)
+	checkTxFailed(t, checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")), "already redeemed")
+	time.Sleep(4 * time.Second)
+	// the value of the failed redeem must be given back
+	checker.Expect(receiver, new(big.Int).Neg(amountInSideChain.ToBig()))
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	utxoRecords := utils.GetRedeemingUTXOs()
+	if len(utxoRecords) != 1 {
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
+	}
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
+}
+
+// TestRedeemLostAndFoundByNonOwner makes a lost-and-found UTXO owned by
+// another address, only that address can get it back. Redeemable UTXOs can
+// be redeemed by anyone who burns the amount, so they are not tested here.
+func TestRedeemLostAndFoundByNonOwner(t *T) {
+	var txid = t.NewTxid()
+	var covenantAddress = currCovenantAddress()
+	var sender string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var owner string = "0x00000000000000000000000000000000000012ab"
+	var amount string = "2000"
+	fmt.Println(`-------------------- send cc transfer tx above max amount -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, owner, amount)
+	time.Sleep(5 * time.Second)
+	fmt.Println(`-------------------- send startRescan tx -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(10 * time.Second)
+	checker := utils.NewBalanceChecker(sender, owner)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	utxo := findUtxo(utils.GetLostAndFoundUTXOs(), txid)
+	if utxo == nil {
+		t.Fatalf("UTXO above max amount is not lost and found")
+	}
+	if strings.ToLower(utxo.OwnerOfLost.String()) != owner {
+		t.Fatalf("owner of lost not match: %s, %s", utxo.OwnerOfLost.String(), owner)
+	}
+	fmt.Println(`-------------------- send redeem tx by non-owner -------------------`)
+	checkTxFailed(t, checker.AddTx(utils.BuildAndSendRedeemTx(txid, sender, "0")), "not loser")
+	time.Sleep(4 * time.Second)
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	if findUtxo(utils.GetRedeemingUTXOs(), txid) != nil {
+		t.Fatalf("lost-and-found UTXO is redeemed by non-owner")
+	}
+	if findUtxo(utils.GetLostAndFoundUTXOs(), txid) == nil {
+		t.Fatalf("lost-and-found UTXO disappeared after a failed redeem")
+	}
+}
+
+// TestTransferDroppedByReorg rescans up to the block before the cc tx, then
+// lets the fake node drop the tx by a reorg. smartbchd must never pay for it.
+func TestTransferDroppedByReorg(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
+	var amount string = "1"
+	// leave some blocks between the last rescan height and the cc tx
+	time.Sleep(6 * time.Second)
+	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	txHeight := waitMainnetTx(t, txid, mainHeight)
+	fmt.Println(`-------------------- send startRescan tx before the cc tx block -------------------`)
+	checkTxSucceeded(t, utils.GetTxReceipt(utils.StartRescan(fmt.Sprintf("%d", txHeight-1))))
+	fmt.Println(`-------------------- reorg main chain -------------------`)
+	utils.ReorgMainnet()
+	time.Sleep(3 * time.Second)
+	if utils.FindMainnetTx(txid, mainHeight) >= 0 {
+		t.Fatalf("cc tx %s is still on main chain after reorg", txid)
+	}
+	time.Sleep(7 * time.Second)
+	checker := utils.NewBalanceChecker(receiver)
+	fmt.Println(`-------------------- send handle utxo tx -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	fmt.Println(`--------------------- send startRescan tx after reorg -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(15 * time.Second)
+	fmt.Println(`--------------------- send handle utxo tx after reorg -------------------`)
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
+	time.Sleep(4 * time.Second)
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
+	checkNoUtxoRecord(t, txid)
+}
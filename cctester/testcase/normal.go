@@ -2,60 +2,37 @@ package testcase
 
 import (
 	"fmt"
-	"os"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/holiman/uint256"
+	"github.com/smartbch/smartbch/param"
 
 	"github.com/smartbch/testkit/cctester/utils"
 )
 
-func Test() {
-	fmt.Printf("--------- Test convert -----------\n")
-	TestConvert()
-	time.Sleep(5 * time.Second)
-	fmt.Printf("-------------- TestLostAndFoundWithBelowMinAmount -------------\n")
-	TestLostAndFoundWithBelowMinAmount()
-	time.Sleep(5 * time.Second)
-	fmt.Printf("-------------- TestLostAndFoundWithAboveMaxAmount -------------\n")
-	TestLostAndFoundWithAboveMaxAmount()
-	time.Sleep(5 * time.Second)
-	fmt.Printf("-------------- TestLostAndFoundWithOldCovenantAddress -------------\n")
-	TestLostAndFoundWithOldCovenantAddress()
-	time.Sleep(5 * time.Second)
-	fmt.Printf("-------------- TestNormal -------------\n")
-	TestNormal()
-	fmt.Printf("-------------- TestRedeemableWithBelowMinAmount -------------\n")
-	TestRedeemableWithBelowMinAmount()
-	os.Exit(0)
-}
-
-func TestRedeemableWithBelowMinAmount() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000002"
-	var covenantAddress = "0x0000000000000000000000000000000000000002"
+func TestRedeemableWithBelowMinAmount(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
 	//0xab5d62788e207646fa60eb3eebdc4358c7f5686c
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "0.1"
 	var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e7), uint256.NewInt(1e10))
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
 	fmt.Println(`-------------------- send cc transfer tx -------------------`)
 	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
 	time.Sleep(5 * time.Second)
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
-	balance := utils.GetAccBalance(receiver)
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(5 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.Eq(amountInSideChain) {
-		panic("receive amount not match")
-	}
+	checker.Expect(receiver, amountInSideChain.ToBig())
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	fmt.Printf("utxoRecords: len:%d\n", len(utxoRecords))
@@ -63,19 +40,18 @@ func TestRedeemableWithBelowMinAmount() {
 		fmt.Printf("utxo: txid:%s\n", utxo.Txid.String())
 	}
 	if len(utxoRecords) != 1 {
-		panic("")
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
 	}
 	if utxoRecords[0].Txid.String() != txid {
-		panic("")
+		t.Fatalf("redeeming UTXO txid not match: %s, %s", utxoRecords[0].Txid.String(), txid)
 	}
 	//fmt.Printf("utxoRecords[0].OwnerOfLost:%s\n", utxoRecords[0].OwnerOfLost.String())
 	zeroAddress := common.Address{}
 	if strings.ToLower(utxoRecords[0].OwnerOfLost.String()) != zeroAddress.String() {
-		panic("")
+		t.Fatalf("redeeming UTXO should have no owner of lost: %s", utxoRecords[0].OwnerOfLost.String())
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(txid[2:])
-	time.Sleep(5 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
@@ -84,61 +60,51 @@ func TestRedeemableWithBelowMinAmount() {
 	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 }
 
-func TestLostAndFoundWithAboveMaxAmount() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000001"
-	var covenantAddress = "0x0000000000000000000000000000000000000002"
+func TestLostAndFoundWithAboveMaxAmount(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "2000"
-	//var amountInSatoshi = "0x2e90edd000" //2000_00000000
-	//var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e7), uint256.NewInt(1e10))
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
+	var amountInSatoshi uint64 = 2000_00000000
 	fmt.Println(`-------------------- send cc transfer tx -------------------`)
 	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
 	time.Sleep(5 * time.Second)
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
-	balance := utils.GetAccBalance(receiver)
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(4 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.IsZero() {
-		panic("receive amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- send redeem tx -------------------`)
-	utils.BuildAndSendRedeemTx(txid, receiver, "0")
+	checker = utils.NewBalanceChecker(receiver)
+	checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "0"))
 	time.Sleep(4 * time.Second)
-	balance2 := utils.GetAccBalance(receiver)
-	burnAmount := uint256.NewInt(0).Sub(balance1, uint256.NewInt(0).Add(balance2, normalGasFee))
-	if !burnAmount.IsZero() {
-		panic("burn amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 1 {
-		panic("")
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
 	}
 	if utxoRecords[0].Txid.String() != txid {
-		panic("")
+		t.Fatalf("redeeming UTXO txid not match: %s, %s", utxoRecords[0].Txid.String(), txid)
 	}
 	fmt.Printf("utxoRecords[0].Amount:%s\n", utxoRecords[0].Amount.String())
-	//if amountInSatoshi != utxoRecords[0].Amount.String() {
-	//panic("")
-	//}
+	if uint64(utxoRecords[0].Amount) != amountInSatoshi {
+		t.Fatalf("redeeming UTXO amount not match: %d, %d", uint64(utxoRecords[0].Amount), amountInSatoshi)
+	}
 	//fmt.Printf("utxoRecords[0].OwnerOfLost:%s\n", utxoRecords[0].OwnerOfLost.String())
 	if strings.ToLower(utxoRecords[0].OwnerOfLost.String()) != receiver {
-		panic("")
+		t.Fatalf("owner of lost not match: %s, %s", utxoRecords[0].OwnerOfLost.String(), receiver)
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(txid[2:])
-	time.Sleep(5 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
@@ -147,41 +113,33 @@ func TestLostAndFoundWithAboveMaxAmount() {
 	time.Sleep(5 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 }
 
-func TestLostAndFoundWithBelowMinAmount() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000002"
-	var covenantAddress = "0x0000000000000000000000000000000000000002"
+func TestLostAndFoundWithBelowMinAmount(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "0.9"
 	//var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e7), uint256.NewInt(1e10))
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
 	fmt.Println(`-------------------- send cc transfer tx -------------------`)
 	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
 	time.Sleep(5 * time.Second)
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
-	balance := utils.GetAccBalance(receiver)
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(5 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.IsZero() {
-		panic("receive amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- send redeem tx -------------------`)
-	utils.BuildAndSendRedeemTx(txid, receiver, "0")
+	checker = utils.NewBalanceChecker(receiver)
+	checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "0"))
 	time.Sleep(4 * time.Second)
-	balance2 := utils.GetAccBalance(receiver)
-	burnAmount := uint256.NewInt(0).Sub(balance1, uint256.NewInt(0).Add(balance2, normalGasFee))
-	if !burnAmount.IsZero() {
-		panic("burn amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	fmt.Printf("utxoRecords: len:%d\n", len(utxoRecords))
@@ -189,18 +147,17 @@ func TestLostAndFoundWithBelowMinAmount() {
 		fmt.Printf("utxo: txid:%s\n", utxo.Txid.String())
 	}
 	if len(utxoRecords) != 1 {
-		panic("")
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
 	}
 	if utxoRecords[0].Txid.String() != txid {
-		panic("")
+		t.Fatalf("redeeming UTXO txid not match: %s, %s", utxoRecords[0].Txid.String(), txid)
 	}
 	//fmt.Printf("utxoRecords[0].OwnerOfLost:%s\n", utxoRecords[0].OwnerOfLost.String())
 	if strings.ToLower(utxoRecords[0].OwnerOfLost.String()) != receiver {
-		panic("")
+		t.Fatalf("owner of lost not match: %s, %s", utxoRecords[0].OwnerOfLost.String(), receiver)
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(txid[2:])
-	time.Sleep(5 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
@@ -209,16 +166,16 @@ func TestLostAndFoundWithBelowMinAmount() {
 	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 }
 
-func TestLostAndFoundWithOldCovenantAddress() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000003"
+func TestLostAndFoundWithOldCovenantAddress(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "1"
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
-	var lastCovenantAddress = "0x0000000000000000000000000000000000000001"
+	var lastCovenantAddress = lastCovenantAddress(t)
 
 	fmt.Println(`-------------------- send cc transfer tx -------------------`)
 	utils.BuildAndSendTransferTx(txid, lastCovenantAddress, receiver, amount)
@@ -226,40 +183,31 @@ func TestLostAndFoundWithOldCovenantAddress() {
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
-	balance := utils.GetAccBalance(receiver)
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(4 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.IsZero() {
-		panic("receive amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- send redeem tx -------------------`)
-	utils.BuildAndSendRedeemTx(txid, receiver, "0")
+	checker = utils.NewBalanceChecker(receiver)
+	checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "0"))
 	time.Sleep(4 * time.Second)
-	balance2 := utils.GetAccBalance(receiver)
-	burnAmount := uint256.NewInt(0).Sub(balance1, uint256.NewInt(0).Add(balance2, normalGasFee))
-	if !burnAmount.IsZero() {
-		panic("burn amount should be zero")
-	}
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	fmt.Println(len(utxoRecords))
 	if len(utxoRecords) != 1 {
-		panic("")
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
 	}
 	if utxoRecords[0].Txid.String() != txid {
-		panic("")
+		t.Fatalf("redeeming UTXO txid not match: %s, %s", utxoRecords[0].Txid.String(), txid)
 	}
 	//fmt.Printf("utxoRecords[0].OwnerOfLost:%s\n", utxoRecords[0].OwnerOfLost.String())
 	if strings.ToLower(utxoRecords[0].OwnerOfLost.String()) != receiver {
-		panic("")
+		t.Fatalf("owner of lost not match: %s, %s", utxoRecords[0].OwnerOfLost.String(), receiver)
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(txid[2:])
-	time.Sleep(5 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
@@ -268,52 +216,45 @@ func TestLostAndFoundWithOldCovenantAddress() {
 	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 }
 
-func TestNormal() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000004"
-	var covenantAddress = "0x0000000000000000000000000000000000000002"
+func TestNormal(t *T) {
+	var txid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "1"
 	var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e8), uint256.NewInt(1e10))
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
 	fmt.Println(`-------------------- send cc transfer tx -------------------`)
 	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
 	time.Sleep(5 * time.Second)
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
-	balance := utils.GetAccBalance(receiver)
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(4 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.Eq(amountInSideChain) {
-		panic("balance not match")
-	}
+	checker.Expect(receiver, amountInSideChain.ToBig())
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- send redeem tx -------------------`)
-	utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000")
+	checker = utils.NewBalanceChecker(receiver)
+	checker.AddTx(utils.BuildAndSendRedeemTx(txid, receiver, "1000000000000000000"))
 	time.Sleep(6 * time.Second)
-	balance2 := utils.GetAccBalance(receiver)
-	burnAddress := uint256.NewInt(0).Sub(balance1, uint256.NewInt(0).Add(balance2, normalGasFee))
-	if !burnAddress.Eq(amountInSideChain) {
-		panic("balance not match after redeem")
-	}
+	checker.Expect(receiver, new(big.Int).Neg(amountInSideChain.ToBig()))
+	checkBalances(t, checker)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 1 {
-		panic("")
+		t.Fatalf("expected 1 redeeming UTXO, got %d", len(utxoRecords))
 	}
 	if utxoRecords[0].Txid.String() != txid {
-		panic("")
+		t.Fatalf("redeeming UTXO txid not match: %s, %s", utxoRecords[0].Txid.String(), txid)
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(txid[2:])
-	time.Sleep(5 * time.Second)
+	fmt.Println(`--------------------- wait main chain redeem tx -------------------`)
+	checkMainnetRedeemed(t, txid, mainHeight)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
@@ -322,119 +263,168 @@ func TestNormal() {
 	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
+	checkSubmittedOnce(t, "redeem", txid, mainHeight)
 }
 
-func TestConvert() {
-	var txid = "0x0000000000000000000000000000000000000000000000000000000000000005"
-	//var newTxid = "0x0000000000000000000000000000000000000000000000000000000000000006"
-	var covenantAddress = "0x0000000000000000000000000000000000000001"
-	var newCovenantAddress = "0x0000000000000000000000000000000000000002"
+// TestConvert sends cc-UTXOs to the covenant before the monitors' vote of
+// main changes it, then checks they are converted to the new one. The vote
+// changes the covenant once, so it fails once the covenant has changed.
+func TestConvert(t *T) {
+	var txid = t.NewTxid()        // converted by operators, through the fake collector
+	var monitorTxid = t.NewTxid() // converted by monitors
+	var convertedByMonitorsTxid = t.NewTxid()
+	var mainHeight = utils.GetMainnetBlockCount()
+	var covenantAddress = currCovenantAddress()
+	var newCovenantAddress string // known once the covenant changed
 
 	var receiver string = "0xab5d62788e207646fa60eb3eebdc4358c7f5686c"
 	var amount string = "1"
+	var amountInSatoshi uint64 = 1_00000000
 	var amountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(1e8), uint256.NewInt(1e10))
-	//var newAmount string = "0.9999"
-	var newAmountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(9999e4), uint256.NewInt(1e10))
+	// the operators pay the miner fee of their convert tx out of the UTXO
+	var newAmountInSatoshi = amountInSatoshi - param.RedeemOrCovertMinerFee
+	var newAmountInSideChain = uint256.NewInt(0).Mul(uint256.NewInt(newAmountInSatoshi), uint256.NewInt(1e10))
 
-	var normalGasFee = uint256.NewInt(0).Mul(uint256.NewInt(4000000) /*gas*/, uint256.NewInt(20000000000) /*gas price*/)
-	fmt.Println(`-------------------- send cc transfer tx -------------------`)
+	fmt.Println(`-------------------- send cc transfer txs -------------------`)
 	utils.BuildAndSendTransferTx(txid, covenantAddress, receiver, amount)
+	utils.BuildAndSendTransferTx(monitorTxid, covenantAddress, receiver, amount)
 	time.Sleep(5 * time.Second)
 	fmt.Println(`-------------------- send startRescan tx -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(10 * time.Second)
-	balance := utils.GetAccBalance(receiver)
-	fmt.Printf("balance: %s\n", balance.String())
+	checker := utils.NewBalanceChecker(receiver)
 	fmt.Println(`-------------------- send handle utxo tx -------------------`)
-	utils.BuildAndSendHandleUTXOTx()
+	checker.AddTx(utils.BuildAndSendHandleUTXOTx())
 	time.Sleep(4 * time.Second)
-	balance1 := utils.GetAccBalance(receiver)
-	fmt.Printf("balance1: %s\n", balance1.String())
-	receiveAmount := uint256.NewInt(0).Sub(uint256.NewInt(0).Add(balance1, normalGasFee), balance)
-	fmt.Printf("balance: %s\n", receiveAmount.String())
-	if !receiveAmount.Eq(amountInSideChain) {
-		panic(fmt.Sprintf("balance not match: %s, %s", receiveAmount.Hex(), amountInSideChain.Hex()))
-	}
+	totalAmountInSideChain := uint256.NewInt(0).Add(amountInSideChain, amountInSideChain)
+	checker.Expect(receiver, totalAmountInSideChain.ToBig())
+	checkBalances(t, checker)
+
+	fmt.Println(`-------------------- stop fake collector, operators cannot sign any more -------------------`)
+	utils.StopFakeCollector()
+	defer func() {
+		// the collector must be back for the following cases even if this one
+		// fails, the one restarted below is stopped first if this one passes
+		utils.StopFakeCollector()
+		go utils.StartFakeCollector()
+		time.Sleep(3 * time.Second)
+	}()
 	fmt.Println(`-------------------- send startRescan tx to change covenant address -------------------`)
-	latestSideChainHeight := utils.GetSideChainBlockHeight()
-	for latestSideChainHeight <= 70 {
-		fmt.Printf("side chain height:%d\n", latestSideChainHeight)
-		time.Sleep(5 * time.Second)
-		latestSideChainHeight = utils.GetSideChainBlockHeight()
-	}
-	utils.BuildAndSendStartRescanTx()
-	time.Sleep(6 * time.Second)
+	newCovenantAddress = changeCovenant(t, covenantAddress)
 	fmt.Println(`-------------------- check utxo record from rpc -------------------`)
 	utxoRecords := utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 	toBeConvertedUtxoRecords := utils.GetToBeConvertedUTXOs()
-	if len(toBeConvertedUtxoRecords) != 1 {
-		panic("")
+	if len(toBeConvertedUtxoRecords) != 2 {
+		t.Fatalf("expected 2 to-be-converted UTXOs, got %d", len(toBeConvertedUtxoRecords))
+	}
+	for _, txid := range []string{txid, monitorTxid} {
+		utxo := findUtxo(toBeConvertedUtxoRecords, txid)
+		if utxo == nil {
+			t.Fatalf("UTXO %s is not to be converted", txid)
+		}
+		if uint64(utxo.Amount) != amountInSatoshi {
+			t.Fatalf("to-be-converted UTXO amount not match: %d, %d", uint64(utxo.Amount), amountInSatoshi)
+		}
 	}
-	if toBeConvertedUtxoRecords[0].Txid.String() != txid {
-		panic("")
+
+	fmt.Println(`--------------------- send main chain convert tx by monitors -------------------`)
+	utils.BuildAndSendConvertByMonitorsTx(monitorTxid, convertedByMonitorsTxid, newCovenantAddress, amount)
+	convertTx := checkMainnetConverted(t, monitorTxid, mainHeight, newCovenantAddress, amountInSatoshi)
+	if convertTx.TxID != convertedByMonitorsTxid[2:] {
+		t.Fatalf("convert tx by monitors not match: %s, %s", convertTx.TxID, convertedByMonitorsTxid)
 	}
-	fmt.Println(`--------------------- send main chain convert tx -------------------`)
-	//utils.BuildAndSendConvertTx(txid[2:], newTxid[2:], newCovenantAddress, newAmount)
-	time.Sleep(5 * time.Second)
 	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
-	latestSideChainHeight = utils.GetSideChainBlockHeight()
-	for latestSideChainHeight <= 100 {
-		fmt.Printf("side chain height:%d\n", latestSideChainHeight)
-		time.Sleep(5 * time.Second)
-		latestSideChainHeight = utils.GetSideChainBlockHeight()
-	}
+	waitSideChainHeight(100)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
 	fmt.Println(`--------------------- send handle utxo tx second time -------------------`)
 	utils.BuildAndSendHandleUTXOTx()
 	time.Sleep(4 * time.Second)
-	utxoRecords = utils.GetRedeemingUTXOs()
-	if len(utxoRecords) != 0 {
-		panic("")
-	}
-	balance2 := utils.GetAccBalance(receiver)
 	redeemableUtxoRecords := utils.GetRedeemableUTXOs()
-	if len(redeemableUtxoRecords) != 1 {
-		panic("")
+	utxo := findUtxo(redeemableUtxoRecords, convertedByMonitorsTxid)
+	if utxo == nil {
+		t.Fatalf("UTXO converted by monitors is not redeemable")
 	}
-	fmt.Println(`-------------------- send redeem tx second time -------------------`)
-	newTxid := redeemableUtxoRecords[0].Txid.String()
-	utils.BuildAndSendRedeemTx(newTxid, receiver, "999900000000000000")
-	time.Sleep(4 * time.Second)
-	balance3 := utils.GetAccBalance(receiver)
-	burnAddress := uint256.NewInt(0).Sub(balance2, uint256.NewInt(0).Add(balance3, normalGasFee))
-	fmt.Println(burnAddress.String())
-	fmt.Println(newAmountInSideChain.String())
-	if !burnAddress.Eq(newAmountInSideChain) {
-		panic("balance not match after redeem")
+	if !strings.EqualFold(utxo.CovenantAddr.String(), newCovenantAddress) {
+		t.Fatalf("covenant address not match: %s, %s", utxo.CovenantAddr.String(), newCovenantAddress)
 	}
-	fmt.Println(`-------------------- check utxo record from rpc second time -------------------`)
+	if uint64(utxo.Amount) != amountInSatoshi {
+		t.Fatalf("UTXO converted by monitors lost value: %d, %d", uint64(utxo.Amount), amountInSatoshi)
+	}
+	toBeConvertedUtxoRecords = utils.GetToBeConvertedUTXOs()
+	if len(toBeConvertedUtxoRecords) != 1 || toBeConvertedUtxoRecords[0].Txid.String() != txid {
+		t.Fatalf("only the UTXO for operators should be to be converted, got %d", len(toBeConvertedUtxoRecords))
+	}
+
+	fmt.Println(`--------------------- restart fake collector to convert by operators -------------------`)
+	go utils.StartFakeCollector()
+	convertTx = checkMainnetConverted(t, txid, mainHeight, newCovenantAddress, newAmountInSatoshi)
+	convertedByOperatorsTxid := "0x" + convertTx.TxID
+	fmt.Println(`--------------------- send startRescan tx third time -------------------`)
+	utils.BuildAndSendStartRescanTx()
+	time.Sleep(15 * time.Second)
+	fmt.Println(`--------------------- send handle utxo tx third time -------------------`)
+	utils.BuildAndSendHandleUTXOTx()
+	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
-	if len(utxoRecords) != 1 {
-		panic("")
+	if len(utxoRecords) != 0 {
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
-	if utxoRecords[0].Txid.String() != newTxid {
-		panic("")
+	if len(utils.GetToBeConvertedUTXOs()) != 0 {
+		t.Fatalf("expected no to-be-converted UTXO")
 	}
-	if utxoRecords[0].CovenantAddr.String() != newCovenantAddress {
-		panic("")
+	redeemableUtxoRecords = utils.GetRedeemableUTXOs()
+	utxo = findUtxo(redeemableUtxoRecords, convertedByOperatorsTxid)
+	if utxo == nil {
+		t.Fatalf("UTXO converted by operators is not redeemable")
 	}
-	fmt.Println(`--------------------- send main chain redeem tx -------------------`)
-	//utils.BuildAndSendMainnetRedeemTx(newTxid[2:])
-	time.Sleep(5 * time.Second)
-	fmt.Println(`--------------------- send startRescan tx second time -------------------`)
+	if !strings.EqualFold(utxo.CovenantAddr.String(), newCovenantAddress) {
+		t.Fatalf("covenant address not match: %s, %s", utxo.CovenantAddr.String(), newCovenantAddress)
+	}
+	if uint64(utxo.Amount) != newAmountInSatoshi {
+		t.Fatalf("UTXO converted by operators has value %d instead of %d", uint64(utxo.Amount), newAmountInSatoshi)
+	}
+	checkSubmittedOnce(t, "convert", txid, mainHeight)
+
+	fmt.Println(`-------------------- send redeem txs -------------------`)
+	checker = utils.NewBalanceChecker(receiver)
+	checker.AddTx(utils.BuildAndSendRedeemTx(convertedByOperatorsTxid, receiver, newAmountInSideChain.ToBig().String()))
+	time.Sleep(4 * time.Second)
+	checker.AddTx(utils.BuildAndSendRedeemTx(convertedByMonitorsTxid, receiver, "1000000000000000000"))
+	time.Sleep(4 * time.Second)
+	checker.Expect(receiver, new(big.Int).Neg(newAmountInSideChain.ToBig()))
+	checker.Expect(receiver, new(big.Int).Neg(amountInSideChain.ToBig()))
+	checkBalances(t, checker)
+	fmt.Println(`-------------------- check utxo record from rpc second time -------------------`)
+	utxoRecords = utils.GetRedeemingUTXOs()
+	if len(utxoRecords) != 2 {
+		t.Fatalf("expected 2 redeeming UTXOs, got %d", len(utxoRecords))
+	}
+	for _, txid := range []string{convertedByOperatorsTxid, convertedByMonitorsTxid} {
+		utxo = findUtxo(utxoRecords, txid)
+		if utxo == nil {
+			t.Fatalf("UTXO %s is not redeeming", txid)
+		}
+		if !strings.EqualFold(utxo.CovenantAddr.String(), newCovenantAddress) {
+			t.Fatalf("covenant address not match: %s, %s", utxo.CovenantAddr.String(), newCovenantAddress)
+		}
+	}
+	fmt.Println(`--------------------- wait main chain redeem txs -------------------`)
+	checkMainnetRedeemed(t, convertedByOperatorsTxid, mainHeight)
+	checkMainnetRedeemed(t, convertedByMonitorsTxid, mainHeight)
+	fmt.Println(`--------------------- send startRescan tx fourth time -------------------`)
 	utils.BuildAndSendStartRescanTx()
 	time.Sleep(15 * time.Second)
-	fmt.Println(`--------------------- send handle utxo tx second time -------------------`)
+	fmt.Println(`--------------------- send handle utxo tx fourth time -------------------`)
 	utils.BuildAndSendHandleUTXOTx()
 	time.Sleep(4 * time.Second)
 	utxoRecords = utils.GetRedeemingUTXOs()
 	if len(utxoRecords) != 0 {
-		panic("")
+		t.Fatalf("expected no redeeming UTXO, got %d", len(utxoRecords))
 	}
 }
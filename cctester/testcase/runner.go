@@ -0,0 +1,262 @@
+package testcase
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/smartbch/testkit/cctester/utils"
+)
+
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// settleTimeout bounds how long the teardown of a case waits for the
+// redeeming and to-be-converted UTXOs it left behind to be processed.
+var settleTimeout = 90 * time.Second
+
+// txidSeq makes every txid handed out by T.NewTxid unique within one run,
+// the high bytes are taken from the start time so that reruns against a
+// fake node which kept its block.log do not collide either.
+var txidSeq uint64
+var txidPrefix = uint64(time.Now().Unix())
+
+type Case struct {
+	Name string
+	Run  func(t *T)
+}
+
+// Cases lists all the scenarios in the order they are run. Each case reads
+// the covenant addresses it needs from sbch_getCcInfo.
+var Cases = []Case{
+	{"TestConvert", TestConvert},
+	{"TestLostAndFoundWithBelowMinAmount", TestLostAndFoundWithBelowMinAmount},
+	{"TestLostAndFoundWithAboveMaxAmount", TestLostAndFoundWithAboveMaxAmount},
+	{"TestLostAndFoundWithOldCovenantAddress", TestLostAndFoundWithOldCovenantAddress},
+	{"TestNormal", TestNormal},
+	{"TestRedeemableWithBelowMinAmount", TestRedeemableWithBelowMinAmount},
+	{"TestCollectorRestart", TestCollectorRestart},
+	{"TestCollectorRejectsTamperedUtxos", TestCollectorRejectsTamperedUtxos},
+	{"TestFakeOperatorSigs", TestFakeOperatorSigs},
+	{"TestTransferWithMalformedOpReturn", TestTransferWithMalformedOpReturn},
+	{"TestTransferToWrongCovenantAddress", TestTransferToWrongCovenantAddress},
+	{"TestTransferWithDuplicateTxid", TestTransferWithDuplicateTxid},
+	{"TestRedeemAlreadyRedeemed", TestRedeemAlreadyRedeemed},
+	{"TestRedeemLostAndFoundByNonOwner", TestRedeemLostAndFoundByNonOwner},
+	{"TestTransferDroppedByReorg", TestTransferDroppedByReorg},
+	{"TestMultiUserLoad", TestMultiUserLoad},
+}
+
+// T is passed to every case. Like testing.T, Fatalf stops the case and marks
+// it as failed, while the runner goes on with the next case.
+type T struct {
+	name    string
+	failed  bool
+	message string
+}
+
+type failNow struct{}
+
+func (t *T) Name() string {
+	return t.name
+}
+
+func (t *T) Logf(format string, args ...interface{}) {
+	fmt.Printf("[%s] %s\n", t.name, fmt.Sprintf(format, args...))
+}
+
+func (t *T) Fatalf(format string, args ...interface{}) {
+	t.failed = true
+	t.message = fmt.Sprintf(format, args...)
+	t.Logf("FAIL: %s", t.message)
+	panic(failNow{})
+}
+
+// NewTxid returns a main chain txid which has not been used by any case yet.
+func (t *T) NewTxid() string {
+	seq := atomic.AddUint64(&txidSeq, 1)
+	return fmt.Sprintf("0x%048x%016x", txidPrefix, seq)
+}
+
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"` // in seconds
+	Message  string  `json:"message,omitempty"`
+}
+
+// Select returns the cases whose names match the pattern, all cases are
+// returned if the pattern is empty.
+func Select(pattern string) ([]Case, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var selected []Case
+	for _, c := range Cases {
+		if re.MatchString(c.Name) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+// Run runs the cases one by one and returns their results.
+func Run(cases []Case) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		fmt.Printf("-------------- %s -------------\n", c.Name)
+		results = append(results, runCase(c))
+	}
+	return results
+}
+
+func runCase(c Case) Result {
+	t := &T{name: c.Name}
+	start := time.Now()
+	t.protect(setup)
+	if !t.failed {
+		t.protect(c.Run)
+	}
+	t.protect(teardown)
+
+	result := Result{
+		Name:     c.Name,
+		Status:   StatusPass,
+		Duration: time.Since(start).Seconds(),
+	}
+	if t.failed {
+		result.Status = StatusFail
+		result.Message = t.message
+	}
+	fmt.Printf("-------------- %s: %s -------------\n", c.Name, result.Status)
+	return result
+}
+
+// protect runs fn and turns both Fatalf and unexpected panics (the utils
+// package panics when a node cannot be reached) into a failure of the case.
+func (t *T) protect(fn func(t *T)) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(failNow); ok {
+				return
+			}
+			if !t.failed {
+				t.failed = true
+				t.message = fmt.Sprintf("panic: %v", r)
+			}
+			t.Logf("PANIC: %v", r)
+		}
+	}()
+	fn(t)
+}
+
+// setup restores the fake collector and the fake operators a former case may
+// have stopped or broken, and makes sure no redeeming or to-be-converted UTXO
+// left by former cases can be mistaken for one of this case.
+func setup(t *T) {
+	if !utils.FakeCollectorRunning() {
+		t.Logf("restarting the fake collector")
+		go utils.StartFakeCollector()
+		time.Sleep(3 * time.Second)
+	}
+	if utils.FakeOperatorsStarted() {
+		for _, op := range utils.GetFakeOperators() {
+			if op.Fault != "none" {
+				utils.SetFakeOperatorFault(op, "none")
+			}
+		}
+	}
+	if !settle() {
+		t.Fatalf("UTXOs of former cases are still pending")
+	}
+}
+
+// teardown lets the fake collector finish the UTXOs this case made redeeming
+// or to be converted, so that the next case starts from a clean state.
+func teardown(t *T) {
+	if !settle() {
+		t.Logf("UTXOs are still pending after %s", settleTimeout)
+	}
+}
+
+func settle() bool {
+	deadline := time.Now().Add(settleTimeout)
+	for len(utils.GetRedeemingUTXOs())+len(utils.GetToBeConvertedUTXOs()) != 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		utils.BuildAndSendStartRescanTx()
+		time.Sleep(15 * time.Second)
+		utils.BuildAndSendHandleUTXOTx()
+		time.Sleep(4 * time.Second)
+	}
+	return true
+}
+
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Status != StatusPass {
+			return true
+		}
+	}
+	return false
+}
+
+func WriteJSONReport(path string, results []Result) error {
+	out, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+func WriteJUnitReport(path string, results []Result) error {
+	suite := junitTestSuite{Name: "cctester", Tests: len(results)}
+	total := 0.0
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			Classname: "cctester",
+			Time:      fmt.Sprintf("%.3f", r.Duration),
+		}
+		if r.Status != StatusPass {
+			tc.Failure = &junitFailure{Message: r.Message}
+			suite.Failures++
+		}
+		total += r.Duration
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	out, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), out...), 0644)
+}
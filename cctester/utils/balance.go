@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// the truffle scripts print "txHash: 0x..." after the tx is mined
+var txHashRegexp = regexp.MustCompile(`txHash: (0x[0-9a-fA-F]{64})`)
+
+func parseTxHash(out string) string {
+	m := txHashRegexp.FindStringSubmatch(out)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+type TxReceipt struct {
+	TransactionHash   common.Hash     `json:"transactionHash"`
+	From              common.Address  `json:"from"`
+	To                *common.Address `json:"to"`
+	Status            hexutil.Uint64  `json:"status"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice"`
+	StatusStr         string          `json:"statusStr"` // only set for failed txs
+	OutData           string          `json:"outData"`   // hex without 0x, only set for failed txs
+}
+
+func (r *TxReceipt) Succeeded() bool {
+	return r.Status == 1
+}
+
+// Reason returns the error message the cc contract put into outData.
+func (r *TxReceipt) Reason() string {
+	bz, err := hex.DecodeString(r.OutData)
+	if err != nil {
+		return r.OutData
+	}
+	return string(bz)
+}
+
+func GetTxReceipt(txHash string) *TxReceipt {
+	if txHash == "" {
+		panic("no tx hash, the tx may not be sent")
+	}
+	args := []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"eth_getTransactionReceipt\",\"params\":[\"%s\"],\"id\":1}", txHash), "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
+	out := Execute("curl", args...)
+	type serverResponse struct {
+		Result *TxReceipt       `json:"result"`
+		Error  interface{}      `json:"error"`
+		Id     *json.RawMessage `json:"id"`
+	}
+	var res serverResponse
+	err := json.Unmarshal([]byte(out), &res)
+	if err != nil {
+		panic(err)
+	}
+	if res.Error != nil {
+		panic(res.Error)
+	}
+	if res.Result == nil {
+		panic("no receipt for tx " + txHash)
+	}
+	return res.Result
+}
+
+// GetTxGasPrice returns the gas price the sender of the tx agreed to pay.
+func GetTxGasPrice(txHash string) *big.Int {
+	args := []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"eth_getTransactionByHash\",\"params\":[\"%s\"],\"id\":1}", txHash), "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
+	out := Execute("curl", args...)
+	type serverResponse struct {
+		Result *struct {
+			GasPrice *hexutil.Big `json:"gasPrice"`
+		} `json:"result"`
+		Error interface{}      `json:"error"`
+		Id    *json.RawMessage `json:"id"`
+	}
+	var res serverResponse
+	err := json.Unmarshal([]byte(out), &res)
+	if err != nil {
+		panic(err)
+	}
+	if res.Error != nil {
+		panic(res.Error)
+	}
+	if res.Result == nil || res.Result.GasPrice == nil {
+		panic("no gas price for tx " + txHash)
+	}
+	return res.Result.GasPrice.ToInt()
+}
+
+// GetTxCost returns how much the sender of the tx paid for gas, in wei.
+// smartBCH may not fill effectiveGasPrice, so the gas price is taken from
+// the tx itself in that case.
+func GetTxCost(txHash string) *big.Int {
+	receipt := GetTxReceipt(txHash)
+	gasPrice := GetTxGasPrice(txHash)
+	if receipt.EffectiveGasPrice != nil {
+		gasPrice = receipt.EffectiveGasPrice.ToInt()
+	}
+	return new(big.Int).Mul(new(big.Int).SetUint64(uint64(receipt.GasUsed)), gasPrice)
+}
+
+// BalanceChecker records the balances of some accounts and checks later that
+// each of them changed by exactly the expected amount, after the gas paid
+// by the txs given to AddTx is taken into account.
+type BalanceChecker struct {
+	addrs    []string
+	before   map[string]*big.Int
+	expected map[string]*big.Int
+	gasCost  map[string]*big.Int
+}
+
+func NewBalanceChecker(addrs ...string) *BalanceChecker {
+	c := &BalanceChecker{
+		before:   make(map[string]*big.Int),
+		expected: make(map[string]*big.Int),
+		gasCost:  make(map[string]*big.Int),
+	}
+	for _, addr := range addrs {
+		addr = strings.ToLower(addr)
+		c.addrs = append(c.addrs, addr)
+		c.before[addr] = GetAccBalance(addr).ToBig()
+		c.expected[addr] = big.NewInt(0)
+		c.gasCost[addr] = big.NewInt(0)
+	}
+	return c
+}
+
+// Expect adds delta, which may be negative, to the expected balance change of addr.
+func (c *BalanceChecker) Expect(addr string, delta *big.Int) {
+	addr = strings.ToLower(addr)
+	if _, ok := c.expected[addr]; !ok {
+		panic("account not tracked: " + addr)
+	}
+	c.expected[addr].Add(c.expected[addr], delta)
+}
+
+// AddTx charges the gas cost of the tx to its sender, if the sender is tracked.
+func (c *BalanceChecker) AddTx(txHash string) *TxReceipt {
+	receipt := GetTxReceipt(txHash)
+	from := strings.ToLower(receipt.From.String())
+	if cost, ok := c.gasCost[from]; ok {
+		cost.Add(cost, GetTxCost(txHash))
+	}
+	return receipt
+}
+
+// Delta returns how much the balance of addr changed apart from gas.
+func (c *BalanceChecker) Delta(addr string) *big.Int {
+	addr = strings.ToLower(addr)
+	delta := new(big.Int).Sub(GetAccBalance(addr).ToBig(), c.before[addr])
+	return delta.Add(delta, c.gasCost[addr])
+}
+
+// Check returns an error describing the first account whose balance did not
+// change as expected.
+func (c *BalanceChecker) Check() error {
+	for _, addr := range c.addrs {
+		delta := c.Delta(addr)
+		fmt.Printf("balance delta of %s: %s (gas %s)\n", addr, delta.String(), c.gasCost[addr].String())
+		if delta.Cmp(c.expected[addr]) != 0 {
+			return fmt.Errorf("balance delta of %s not match: %s, expected %s", addr, delta.String(), c.expected[addr].String())
+		}
+	}
+	return nil
+}
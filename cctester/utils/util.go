@@ -1,22 +1,48 @@
 package utils
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/holiman/uint256"
 
+	"github.com/smartbch/testkit/bchnode/generator/types"
 	"github.com/smartbch/testkit/cctester/config"
 )
 
-func ExecuteWithContinuousOutPut(exe string, params ...string) {
-	cmd := exec.Command(exe, params...)
+var collectorCmd *exec.Cmd
+var collectorLock sync.Mutex
+
+// rpcPubkey is the pubkey of the key given to SetRpcKey, the fake collector
+// only accepts UtxoInfos signed by it.
+var rpcPubkey string
+
+// fakeOperators is set by StartFakeOperators, the fake collector then asks
+// each of them at its own url instead of the single cc-operator.
+var fakeOperators bool
+
+// FakeOperatorUrl is the url of fake operator #0, operator i listens on the
+// port of it plus i.
+const FakeOperatorUrl = "http://127.0.0.1:8801"
+
+// ExecuteWithContinuousOutPut prints the output of the command while it is
+// running, and returns the whole output once it exits.
+func ExecuteWithContinuousOutPut(exe string, params ...string) string {
+	return runWithContinuousOutPut(exec.Command(exe, params...))
+}
+
+func runWithContinuousOutPut(cmd *exec.Cmd) string {
+	exe := cmd.Path
 	stdout, err := cmd.StdoutPipe()
 	cmd.Stderr = cmd.Stdout
 	if err != nil {
@@ -29,25 +55,32 @@ func ExecuteWithContinuousOutPut(exe string, params ...string) {
 	}
 
 	_, exeFile := path.Split(exe)
+	var output strings.Builder
 	for {
 		tmp := make([]byte, 1024)
-		_, err := stdout.Read(tmp)
+		n, err := stdout.Read(tmp)
+		output.Write(tmp[:n])
 		//_out := string(tmp)
-		_out := strings.ReplaceAll(string(tmp), "\n", "\n"+exeFile+": ")
+		_out := strings.ReplaceAll(string(tmp[:n]), "\n", "\n"+exeFile+": ")
 		fmt.Print(_out)
 		if err != nil {
 			break
 		}
 	}
+	return output.String()
 }
 
 func Execute(exe string, params ...string) string {
-	cmd := exec.Command(exe, params...)
-	out, err := cmd.Output()
+	out, err := execute(exe, params...)
 	if err != nil {
 		panic(err.Error())
 	}
-	return string(out)
+	return out
+}
+
+func execute(exe string, params ...string) (string, error) {
+	out, err := exec.Command(exe, params...).Output()
+	return string(out), err
 }
 
 func StartSideChainNode() {
@@ -66,6 +99,11 @@ func StartSideChainNode() {
 }
 
 func SetRpcKey(key string) {
+	ecdsaKey, err := crypto.HexToECDSA(key)
+	if err != nil {
+		panic(err)
+	}
+	rpcPubkey = hex.EncodeToString(crypto.FromECDSAPub(&ecdsaKey.PublicKey))
 	args := []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"sbch_setRpcKey\",\"params\":[\"%s\"],\"id\":1}", key), "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
 	out := Execute("curl", args...)
 	//fmt.Println(out)
@@ -76,7 +114,7 @@ func SetRpcKey(key string) {
 	}
 	var res serverResponse
 	fmt.Println(out)
-	err := json.Unmarshal([]byte(out), &res)
+	err = json.Unmarshal([]byte(out), &res)
 	if err != nil {
 		panic(err)
 	}
@@ -134,6 +172,8 @@ func InitSbchNodesGov(govAddr string) {
 	fmt.Println(output)
 }
 
+// StartOperators runs one cc-operator, which can not make the quorum of
+// signatures alone, so the fake collector is run in its single operator mode.
 func StartOperators(nodesGovAddr string) {
 	ExecuteWithContinuousOutPut(config.OperatorPath,
 		"--listenAddr=0.0.0.0:8801",
@@ -142,8 +182,135 @@ func StartOperators(nodesGovAddr string) {
 	)
 }
 
-func StartFakeCollector() {
-	ExecuteWithContinuousOutPut(config.CollectorPath)
+// StartFakeOperators runs the fake operators of this repo instead of
+// cc-operator, keysFile holds the private keys of the operators smartbchd
+// knows, one per line.
+func StartFakeOperators(keysFile string) {
+	fakeOperators = true
+	ExecuteWithContinuousOutPut(config.FakeOperatorPath,
+		"-listen="+strings.TrimPrefix(FakeOperatorUrl, "http://"),
+		"-keys="+keysFile,
+	)
+}
+
+// StartFakeCollector runs the fake collector until StopFakeCollector is
+// called, args are passed to it besides the state file and the rpc pubkey.
+func StartFakeCollector(args ...string) {
+	args = append([]string{"-state=" + config.CollectorStatePath}, args...)
+	if fakeOperators {
+		args = append(args, "-operator-urls="+strings.Join(fakeOperatorUrls(), ","))
+	} else {
+		args = append(args, "-single-operator")
+	}
+	if rpcPubkey != "" {
+		args = append(args, "-rpc-pubkey="+rpcPubkey)
+	}
+	cmd := exec.Command(config.CollectorPath, args...)
+	collectorLock.Lock()
+	collectorCmd = cmd
+	collectorLock.Unlock()
+	runWithContinuousOutPut(cmd)
+}
+
+// FakeOperatorsStarted tells if the fake operators run instead of cc-operator.
+func FakeOperatorsStarted() bool {
+	return fakeOperators
+}
+
+// FakeOperatorInfo is what the fake operators return for /pubkeys.
+type FakeOperatorInfo struct {
+	Index  int    `json:"index"`
+	Pubkey string `json:"pubkey"`
+	RpcUrl string `json:"rpcUrl"`
+	Fault  string `json:"fault"`
+}
+
+func GetFakeOperators() []*FakeOperatorInfo {
+	out := Execute("curl", FakeOperatorUrl+"/pubkeys")
+	var res struct {
+		Result []*FakeOperatorInfo `json:"result"`
+		Error  string              `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		panic(err)
+	}
+	if res.Error != "" {
+		panic(res.Error)
+	}
+	return res.Result
+}
+
+// SetFakeOperatorFault sets the fault mode of a fake operator, one of none,
+// wrong-sig, delay and error.
+func SetFakeOperatorFault(operator *FakeOperatorInfo, mode string) {
+	fmt.Println(Execute("curl", "-X", "POST", fmt.Sprintf("%s/fault?mode=%s", operator.RpcUrl, mode)))
+}
+
+// fakeOperatorUrls returns the urls of the fake operators in the order of the
+// operators in ccInfo, as the fake collector takes them. The operators do not
+// change in cctester, so the order also holds for the old operators.
+func fakeOperatorUrls() []string {
+	urlOf := make(map[string]string)
+	for _, op := range GetFakeOperators() {
+		urlOf[strings.ToLower(op.Pubkey)] = op.RpcUrl
+	}
+	var urls []string
+	for _, op := range GetCcInfo().Operators {
+		urls = append(urls, urlOf[strings.ToLower(strings.TrimPrefix(op.Pubkey.String(), "0x"))])
+	}
+	return urls
+}
+
+// FakeCollectorRunning tells if the fake collector has been started and not
+// stopped since.
+func FakeCollectorRunning() bool {
+	collectorLock.Lock()
+	defer collectorLock.Unlock()
+	return collectorCmd != nil
+}
+
+// StopFakeCollector kills the fake collector started by StartFakeCollector,
+// which stands for the operators being unable to sign anything.
+func StopFakeCollector() {
+	collectorLock.Lock()
+	defer collectorLock.Unlock()
+	if collectorCmd != nil && collectorCmd.Process != nil {
+		_ = collectorCmd.Process.Kill()
+	}
+	collectorCmd = nil
+}
+
+// CollectorSubmission is a redeem or convert tx recorded in the state file of
+// the fake collector.
+type CollectorSubmission struct {
+	Kind        string `json:"kind"`
+	Txid        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	MainTxid    string `json:"mainTxid"`
+	SubmittedAt int64  `json:"submittedAt"`
+}
+
+// GetCollectorSubmissions returns the submissions of the fake collector for
+// the cc-UTXO (txid, vout), kind is "redeem" or "convert".
+func GetCollectorSubmissions(kind, txid string, vout uint32) []*CollectorSubmission {
+	data, err := os.ReadFile(config.CollectorStatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic(err)
+	}
+	var all []*CollectorSubmission
+	if err = json.Unmarshal(data, &all); err != nil {
+		panic(err)
+	}
+	var res []*CollectorSubmission
+	for _, s := range all {
+		if s.Kind == kind && strings.EqualFold(s.Txid, txid) && s.Vout == vout {
+			res = append(res, s)
+		}
+	}
+	return res
 }
 
 func SendCcTxToFakeNode(tx string) {
@@ -154,6 +321,35 @@ func SendCcTxToFakeNode(tx string) {
 	ExecuteWithContinuousOutPut("curl", args...)
 }
 
+// sendCcTx is SendCcTxToFakeNode returning the errors of curl and of the
+// fake node.
+func sendCcTx(tx string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "cc",
+		"params":  []string{tx},
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+	args := []string{"-sS", "-X", "POST", "--data", string(data), "-H", "Content-Type: application/json", "http://127.0.0.1:1234"}
+	out, err := execute("curl", args...)
+	if err != nil {
+		return fmt.Errorf("failed to send the tx to the fake node: %w", err)
+	}
+	var res struct {
+		Error *JsonRpcError `json:"error"`
+	}
+	if err = json.Unmarshal([]byte(out), &res); err != nil {
+		return fmt.Errorf("invalid response of the fake node: %s", out)
+	}
+	if res.Error != nil && res.Error.Message != "" {
+		return fmt.Errorf("fake node refused the tx: %s", res.Error.Message)
+	}
+	return nil
+}
+
 func SendMonitorVoteToFakeNode(monitorPubkey string) {
 	data := fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"monitor\",\"params\":[\"%s\"],\"id\":1}", monitorPubkey)
 	fmt.Println(data)
@@ -161,40 +357,55 @@ func SendMonitorVoteToFakeNode(monitorPubkey string) {
 	ExecuteWithContinuousOutPut("curl", args...)
 }
 
-func StartRescan(mainHeight string) {
+// StartRescan sends the startRescan tx and returns its hash.
+func StartRescan(mainHeight string) string {
 	args := []string{"exec", "scripts/startrescan.js", "--network=sbch_local", mainHeight}
-	ExecuteWithContinuousOutPut("truffle", args...)
+	return parseTxHash(ExecuteWithContinuousOutPut("truffle", args...))
 }
 
-func BuildAndSendHandleUTXOTx() {
+// BuildAndSendHandleUTXOTx sends the handleUTXOs tx and returns its hash.
+func BuildAndSendHandleUTXOTx() string {
 	args := []string{"exec", "scripts/handleutxo.js", "--network=sbch_local"}
-	ExecuteWithContinuousOutPut("truffle", args...)
+	return parseTxHash(ExecuteWithContinuousOutPut("truffle", args...))
 }
 
-func BuildAndSendRedeemTx(txid, receiver, amount string) {
+// BuildAndSendRedeemTx sends the redeem tx and returns its hash.
+func BuildAndSendRedeemTx(txid, receiver, amount string) string {
 	args := []string{"exec", "scripts/redeem.js", "--network=sbch_local", txid, "0", receiver, amount}
-	ExecuteWithContinuousOutPut("truffle", args...)
+	return parseTxHash(ExecuteWithContinuousOutPut("truffle", args...))
 }
 
-func BuildAndSendStartRescanTx() {
+func BuildAndSendStartRescanTx() string {
 	height := GetLatestMainnetBlockHeight()
 	fmt.Println(height)
-	StartRescan(height)
+	return StartRescan(height)
 }
 
-func BuildAndSendMainnetRedeemTx(txid string) {
+// BuildAndSendMainnetRedeemTx spends the cc-UTXO on the fake node, scriptSig
+// is the hex of the covenant unlocking script and may be empty. It is used by
+// the fake collector, so it returns the errors instead of panicking.
+func BuildAndSendMainnetRedeemTx(txid, scriptSig string) error {
 	if strings.HasPrefix(txid, "0x") {
 		txid = txid[2:]
 	}
-	out := Execute(config.TxMakerPath, "redeem-cc-utxo",
+	args := []string{"redeem-cc-utxo",
 		fmt.Sprintf("--in-txid=%s", txid),
 		fmt.Sprintf("--txid=%s", txid),
-		"--in-vout=0")
+		"--in-vout=0"}
+	if scriptSig != "" {
+		args = append(args, fmt.Sprintf("--script-sig-hex=%s", scriptSig))
+	}
+	out, err := execute(config.TxMakerPath, args...)
+	if err != nil {
+		return fmt.Errorf("txmaker failed: %w", err)
+	}
 	fmt.Println(out)
-	SendCcTxToFakeNode(out)
+	return sendCcTx(out)
 }
 
-func BuildAndSendConvertTx(inTxid, txid, covenantAddress, amount string) {
+// BuildAndSendConvertTx moves the cc-UTXO to the new covenant on the fake
+// node, like BuildAndSendMainnetRedeemTx it returns the errors.
+func BuildAndSendConvertTx(inTxid, txid, covenantAddress, amount, scriptSig string) error {
 	if strings.HasPrefix(inTxid, "0x") {
 		inTxid = inTxid[2:]
 	}
@@ -202,13 +413,35 @@ func BuildAndSendConvertTx(inTxid, txid, covenantAddress, amount string) {
 		txid = txid[2:]
 	}
 	fmt.Println("txid in testcase:", txid)
-	out := Execute(config.TxMakerPath, "convert-by-operators",
+	args := []string{"convert-by-operators",
+		fmt.Sprintf("--txid=%s", txid),
+		fmt.Sprintf("--in-txid=%s", inTxid),
+		"--in-vout=0",
+		fmt.Sprintf("--cc-covenant-addr=%s", covenantAddress),
+		fmt.Sprintf("--amt=%s", amount)}
+	if scriptSig != "" {
+		args = append(args, fmt.Sprintf("--script-sig-hex=%s", scriptSig))
+	}
+	out, err := execute(config.TxMakerPath, args...)
+	if err != nil {
+		return fmt.Errorf("txmaker failed: %w", err)
+	}
+	return sendCcTx(out)
+}
+
+func BuildAndSendConvertByMonitorsTx(inTxid, txid, covenantAddress, amount string) {
+	if strings.HasPrefix(inTxid, "0x") {
+		inTxid = inTxid[2:]
+	}
+	if strings.HasPrefix(txid, "0x") {
+		txid = txid[2:]
+	}
+	out := Execute(config.TxMakerPath, "convert-by-monitors",
 		fmt.Sprintf("--txid=%s", txid),
 		fmt.Sprintf("--in-txid=%s", inTxid),
 		"--in-vout=0",
 		fmt.Sprintf("--cc-covenant-addr=%s", covenantAddress),
 		fmt.Sprintf("--amt=%s", amount))
-	//fmt.Printf(out)
 	SendCcTxToFakeNode(out)
 }
 
@@ -239,6 +472,32 @@ type UtxoInfos struct {
 	Signature hexutil.Bytes `json:"signature"`
 }
 
+// CcInfo is the part of sbch_getCcInfo used by the cases.
+type CcInfo struct {
+	Operators           []*OperatorInfo `json:"operators"`
+	LastCovenantAddress string          `json:"lastCovenantAddress"`
+	CurrCovenantAddress string          `json:"currCovenantAddress"`
+}
+
+func GetCcInfo() *CcInfo {
+	args := []string{"-X", "POST", "--data", "{\"jsonrpc\":\"2.0\",\"method\":\"sbch_getCcInfo\",\"params\":[],\"id\":1}", "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
+	out := Execute("curl", args...)
+	type serverResponse struct {
+		Result *CcInfo          `json:"result"`
+		Error  interface{}      `json:"error"`
+		Id     *json.RawMessage `json:"id"`
+	}
+	var res serverResponse
+	err := json.Unmarshal([]byte(out), &res)
+	if err != nil {
+		panic(err)
+	}
+	if res.Error != nil {
+		panic(res.Error)
+	}
+	return res.Result
+}
+
 func GetRedeemingUTXOs() []*UtxoInfo {
 	args := []string{"-X", "POST", "--data", "{\"jsonrpc\":\"2.0\",\"method\":\"sbch_getRedeemingUtxosForMonitors\",\"params\":[],\"id\":1}", "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
 	out := Execute("curl", args...)
@@ -302,6 +561,26 @@ func GetToBeConvertedUTXOs() []*UtxoInfo {
 	return res.Result.Infos
 }
 
+func GetLostAndFoundUTXOs() []*UtxoInfo {
+	args := []string{"-X", "POST", "--data", "{\"jsonrpc\":\"2.0\",\"method\":\"sbch_getLostAndFoundUtxos\",\"params\":[],\"id\":1}", "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
+	out := Execute("curl", args...)
+	type serverResponse struct {
+		Result *UtxoInfos       `json:"result"`
+		Error  interface{}      `json:"error"`
+		Id     *json.RawMessage `json:"id"`
+	}
+	var res serverResponse
+	fmt.Println(out)
+	err := json.Unmarshal([]byte(out), &res)
+	if err != nil {
+		panic(err)
+	}
+	if res.Error != nil {
+		panic(res.Error)
+	}
+	return res.Result.Infos
+}
+
 func GetAccBalance(address string) *uint256.Int {
 	args := []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"eth_getBalance\",\"params\":[\"%s\",\"latest\"],\"id\":1}", address), "-H", "Content-Type: application/json", "http://127.0.0.1:8545"}
 	out := Execute("curl", args...)
@@ -345,6 +624,10 @@ func GetSideChainBlockHeight() uint64 {
 }
 
 func GetLatestMainnetBlockHeight() string {
+	return fmt.Sprintf("%d", GetMainnetBlockCount())
+}
+
+func GetMainnetBlockCount() int64 {
 	args := []string{"-X", "POST", "--data", "{\"jsonrpc\":\"2.0\",\"method\":\"getblockcount\",\"params\":[],\"id\":1}", "-H", "Content-Type: application/json", "http://127.0.0.1:1234", "-v"}
 	out := Execute("curl", args...)
 	//fmt.Println(out)
@@ -358,7 +641,129 @@ func GetLatestMainnetBlockHeight() string {
 	if err != nil {
 		panic("not get the block height")
 	}
-	return fmt.Sprintf("%d", int64(res.Result))
+	return int64(res.Result)
+}
+
+func GetMainnetBlockByHeight(height int64) *types.BlockInfo {
+	args := []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"getblockhash\",\"params\":[%d],\"id\":1}", height), "-H", "Content-Type: application/json", "http://127.0.0.1:1234"}
+	out := Execute("curl", args...)
+	type hashResponse struct {
+		Result string           `json:"result"`
+		Error  *JsonRpcError    `json:"error"`
+		Id     *json.RawMessage `json:"id"`
+	}
+	var hashRes hashResponse
+	err := json.Unmarshal([]byte(out), &hashRes)
+	if err != nil {
+		panic(err)
+	}
+	if hashRes.Error != nil && hashRes.Error.Message != "" {
+		panic(hashRes.Error.Message)
+	}
+
+	args = []string{"-X", "POST", "--data", fmt.Sprintf("{\"jsonrpc\":\"2.0\",\"method\":\"getblock\",\"params\":[\"%s\"],\"id\":1}", hashRes.Result), "-H", "Content-Type: application/json", "http://127.0.0.1:1234"}
+	out = Execute("curl", args...)
+	type blockResponse struct {
+		Result *types.BlockInfo `json:"result"`
+		Error  *JsonRpcError    `json:"error"`
+		Id     *json.RawMessage `json:"id"`
+	}
+	var blockRes blockResponse
+	err = json.Unmarshal([]byte(out), &blockRes)
+	if err != nil {
+		panic(err)
+	}
+	if blockRes.Error != nil && blockRes.Error.Message != "" {
+		panic(blockRes.Error.Message)
+	}
+	return blockRes.Result
+}
+
+// FindMainnetSpendingTx scans the fake node's blocks from fromHeight on and
+// returns the tx which spends the UTXO (inTxid, inVout), or nil if it is not
+// mined yet.
+func FindMainnetSpendingTx(inTxid string, inVout uint32, fromHeight int64) *types.TxInfo {
+	txs := FindMainnetSpendingTxs(inTxid, inVout, fromHeight)
+	if len(txs) == 0 {
+		return nil
+	}
+	return txs[0]
+}
+
+// FindMainnetSpendingTxs returns all the txs of the fake node which spend the
+// outpoint, the fake node does not reject double spends so there may be more
+// than one.
+func FindMainnetSpendingTxs(inTxid string, inVout uint32, fromHeight int64) []*types.TxInfo {
+	inTxid = strings.ToLower(strings.TrimPrefix(inTxid, "0x"))
+	var txs []*types.TxInfo
+	latest := GetMainnetBlockCount()
+	for h := fromHeight; h <= latest; h++ {
+		blk := GetMainnetBlockByHeight(h)
+		for i := range blk.Tx {
+			tx := &blk.Tx[i]
+			for _, vin := range tx.VinList {
+				txid, _ := vin["txid"].(string)
+				vout, _ := vin["vout"].(float64)
+				if strings.ToLower(strings.TrimPrefix(txid, "0x")) == inTxid && uint32(vout) == inVout {
+					txs = append(txs, tx)
+				}
+			}
+		}
+	}
+	return txs
+}
+
+// FindMainnetTx returns the height of the fake node's block which contains
+// the tx, or -1 if it is not mined or has been dropped by a reorg.
+func FindMainnetTx(txid string, fromHeight int64) int64 {
+	txid = strings.ToLower(strings.TrimPrefix(txid, "0x"))
+	latest := GetMainnetBlockCount()
+	for h := fromHeight; h <= latest; h++ {
+		blk := GetMainnetBlockByHeight(h)
+		for _, tx := range blk.Tx {
+			if strings.ToLower(strings.TrimPrefix(tx.Hash, "0x")) == txid {
+				return h
+			}
+		}
+	}
+	return -1
+}
+
+// ReorgMainnet asks the fake node to replace its latest 8 blocks, the cc txs
+// in them are dropped.
+func ReorgMainnet() {
+	data := "{\"jsonrpc\":\"2.0\",\"method\":\"reorg\",\"params\":[1],\"id\":1}"
+	args := []string{"-X", "POST", "--data", data, "-H", "Content-Type: application/json", "http://127.0.0.1:1234"}
+	fmt.Println(Execute("curl", args...))
+}
+
+// WaitMainnetSpendingTx waits for the UTXO (inTxid, inVout) to be spent on
+// the fake node, e.g. by a redeem or convert tx sent by the fake collector.
+func WaitMainnetSpendingTx(inTxid string, inVout uint32, fromHeight int64, timeout time.Duration) *types.TxInfo {
+	deadline := time.Now().Add(timeout)
+	for {
+		tx := FindMainnetSpendingTx(inTxid, inVout, fromHeight)
+		if tx != nil || time.Now().After(deadline) {
+			return tx
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// GetCovenantAddrOfVout returns the cc-covenant address in a vout built by
+// bchutxomaker, whose asm looks like "OP_HASH160 <addr> OP_EQUAL".
+func GetCovenantAddrOfVout(vout types.Vout) string {
+	asm, _ := vout.ScriptPubKey["asm"].(string)
+	fields := strings.Fields(asm)
+	if len(fields) != 3 || fields[0] != "OP_HASH160" || fields[2] != "OP_EQUAL" {
+		return ""
+	}
+	return fields[1]
+}
+
+type JsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type OperatorInfo struct {
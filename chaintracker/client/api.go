@@ -1,11 +1,27 @@
 package client
 
 import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
+// API is what the chaintracker tools need from a smartBCH node. The heights
+// passed to QueryTxBySrc, QueryTxByDst and Call mean the latest block if 0.
 type API interface {
-	BlockNumber() (uint64, error)
-	SendRawTransaction(tx *types.Transaction) error
-	GetTxListByHeight(height uint64) (RpcTxs, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	ChainID(ctx context.Context) (*big.Int, error)
+	SendRawTransaction(ctx context.Context, tx *types.Transaction) error
+	GetBlockByNumber(ctx context.Context, height uint64) (*Block, error)
+	GetReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	GetLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+
+	GetTxListByHeight(ctx context.Context, height uint64) (RpcTxs, error)
+	GetTxListByHeightWithRange(ctx context.Context, height, start, end uint64) (RpcTxs, error)
+	QueryTxBySrc(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error)
+	QueryTxByDst(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error)
+	Call(ctx context.Context, args CallArgs, height uint64) (*CallDetail, error)
 }
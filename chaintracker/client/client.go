@@ -2,6 +2,12 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 
 	"github.com/ethereum/go-ethereum/core/types"
@@ -16,23 +22,108 @@ type Client struct {
 	Rpc       *rpc.Client
 }
 
-func (c Client) BlockNumber() (uint64, error) {
-	return c.ethClient.BlockNumber(context.Background())
+func (c Client) BlockNumber(ctx context.Context) (uint64, error) {
+	return c.ethClient.BlockNumber(ctx)
+}
+
+func (c Client) ChainID(ctx context.Context) (*big.Int, error) {
+	return c.ethClient.ChainID(ctx)
+}
+
+func (c Client) SendRawTransaction(ctx context.Context, tx *types.Transaction) error {
+	return c.ethClient.SendTransaction(ctx, tx)
+}
+
+// GetBlockByNumber returns the block with its full txs, the txs carry their
+// signatures, which sbch_getTxListByHeight does not return since smartBCH v0.4.
+func (c Client) GetBlockByNumber(ctx context.Context, height uint64) (*Block, error) {
+	var block *Block
+	err := c.Rpc.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.Uint64(height), true)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", height)
+	}
+	return block, nil
+}
+
+func (c Client) GetReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return c.ethClient.TransactionReceipt(ctx, txHash)
+}
+
+func (c Client) GetLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return c.ethClient.FilterLogs(ctx, q)
+}
+
+func (c Client) GetTxListByHeight(ctx context.Context, height uint64) (RpcTxs, error) {
+	var r RpcTxs
+	err := c.Rpc.CallContext(ctx, &r, "sbch_getTxListByHeight", hexutil.Uint64(height))
+	if err != nil {
+		return nil, err
+	}
+	return r, err
+}
+
+// GetTxListByHeightWithRange returns the txs with index in [start, end) of
+// the block.
+func (c Client) GetTxListByHeightWithRange(ctx context.Context, height, start, end uint64) (RpcTxs, error) {
+	var r RpcTxs
+	err := c.Rpc.CallContext(ctx, &r, "sbch_getTxListByHeightWithRange",
+		hexutil.Uint64(height), hexutil.Uint64(start), hexutil.Uint64(end))
+	if err != nil {
+		return nil, err
+	}
+	return r, err
 }
 
-func (c Client) SendRawTransaction(tx *types.Transaction) error {
-	return c.ethClient.SendTransaction(context.Background(), tx)
+func (c Client) QueryTxBySrc(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error) {
+	return c.queryTx(ctx, "sbch_queryTxBySrc", addr, startHeight, endHeight, limit)
 }
 
-func (c Client) GetTxListByHeight(height uint64) (RpcTxs, error) {
+func (c Client) QueryTxByDst(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error) {
+	return c.queryTx(ctx, "sbch_queryTxByDst", addr, startHeight, endHeight, limit)
+}
+
+func (c Client) queryTx(ctx context.Context, method string, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error) {
 	var r RpcTxs
-	err := c.Rpc.CallContext(context.Background(), &r, "sbch_getTxListByHeight", hexutil.Uint64(height))
+	err := c.Rpc.CallContext(ctx, &r, method, addr, blockArg(startHeight), blockArg(endHeight), hexutil.Uint64(limit))
 	if err != nil {
 		return nil, err
 	}
 	return r, err
 }
 
+// Call runs sbch_call, which returns the logs and internal txs besides the
+// return data of eth_call.
+func (c Client) Call(ctx context.Context, args CallArgs, height uint64) (*CallDetail, error) {
+	var detail *CallDetail
+	err := c.Rpc.CallContext(ctx, &detail, "sbch_call", args, blockArg(height))
+	if err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// CallRaw sends the params as they are and returns the raw result, for the
+// tools which compare the responses of two nodes.
+func (c Client) CallRaw(ctx context.Context, method string, params []json.RawMessage) (json.RawMessage, error) {
+	args := make([]interface{}, len(params))
+	for i, param := range params {
+		args[i] = param
+	}
+	var result json.RawMessage
+	err := c.Rpc.CallContext(ctx, &result, method, args...)
+	return result, err
+}
+
+func blockArg(height uint64) interface{} {
+	if height == 0 {
+		return "latest"
+	}
+	return hexutil.Uint64(height)
+}
+
 func (c Client) Close() {
 	c.ethClient.Close()
 }
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var _ API = &FakeAPI{}
+
+// FakeAPI keeps a chain in memory, so the tools built on API can be tested
+// offline. The blocks and receipts are added with AddBlock, the results of
+// sbch_call with SetCall, and the sent txs are kept in Sent.
+type FakeAPI struct {
+	lock     sync.Mutex
+	chainID  *big.Int
+	latest   uint64
+	blocks   map[uint64]*Block
+	receipts map[common.Hash]*types.Receipt
+	calls    map[string]*CallDetail
+
+	Sent []*types.Transaction
+	// SendErr, if set, decides the error of SendRawTransaction
+	SendErr func(tx *types.Transaction) error
+}
+
+func NewFakeAPI(chainID *big.Int) *FakeAPI {
+	return &FakeAPI{
+		chainID:  chainID,
+		blocks:   make(map[uint64]*Block),
+		receipts: make(map[common.Hash]*types.Receipt),
+		calls:    make(map[string]*CallDetail),
+	}
+}
+
+// AddBlock adds the block and the receipts of its txs, the block fields of
+// the receipts and their logs are filled from the block.
+func (f *FakeAPI) AddBlock(block *Block, receipts ...*types.Receipt) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	height := uint64(block.Number)
+	f.blocks[height] = block
+	if height > f.latest {
+		f.latest = height
+	}
+	for i, receipt := range receipts {
+		receipt.BlockNumber = new(big.Int).SetUint64(height)
+		receipt.BlockHash = block.Hash
+		receipt.TransactionIndex = uint(i)
+		for _, log := range receipt.Logs {
+			log.BlockNumber = height
+			log.BlockHash = block.Hash
+			log.TxHash = receipt.TxHash
+			log.TxIndex = uint(i)
+		}
+		f.receipts[receipt.TxHash] = receipt
+	}
+}
+
+func (f *FakeAPI) SetCall(args CallArgs, detail *CallDetail) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls[callKey(args)] = detail
+}
+
+func callKey(args CallArgs) string {
+	var to common.Address
+	if args.To != nil {
+		to = *args.To
+	}
+	return fmt.Sprintf("%s:%x", to, []byte(args.Data))
+}
+
+func (f *FakeAPI) BlockNumber(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.latest, nil
+}
+
+func (f *FakeAPI) ChainID(ctx context.Context) (*big.Int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(f.chainID), nil
+}
+
+func (f *FakeAPI) SendRawTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.SendErr != nil {
+		if err := f.SendErr(tx); err != nil {
+			return err
+		}
+	}
+	f.Sent = append(f.Sent, tx)
+	return nil
+}
+
+func (f *FakeAPI) GetBlockByNumber(ctx context.Context, height uint64) (*Block, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	block, ok := f.blocks[height]
+	if !ok {
+		return nil, fmt.Errorf("block %d not found", height)
+	}
+	return block, nil
+}
+
+func (f *FakeAPI) GetReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	receipt, ok := f.receipts[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+// GetLogs supports the same filters as eth_getLogs, a nil ToBlock means the
+// latest block.
+func (f *FakeAPI) GetLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	from, to := uint64(0), f.latest
+	if q.FromBlock != nil {
+		from = q.FromBlock.Uint64()
+	}
+	if q.ToBlock != nil {
+		to = q.ToBlock.Uint64()
+	}
+	var logs []types.Log
+	for h := from; h <= to; h++ {
+		block, ok := f.blocks[h]
+		if !ok || (q.BlockHash != nil && *q.BlockHash != block.Hash) {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			receipt, ok := f.receipts[tx.Hash]
+			if !ok {
+				continue
+			}
+			for _, log := range receipt.Logs {
+				if matchLog(log, q) {
+					logs = append(logs, *log)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+func matchLog(log *types.Log, q ethereum.FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, addr := range q.Addresses {
+			found = found || addr == log.Address
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, choices := range q.Topics {
+		if len(choices) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range choices {
+			found = found || topic == log.Topics[i]
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *FakeAPI) GetTxListByHeight(ctx context.Context, height uint64) (RpcTxs, error) {
+	block, err := f.GetBlockByNumber(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return block.Transactions, nil
+}
+
+func (f *FakeAPI) GetTxListByHeightWithRange(ctx context.Context, height, start, end uint64) (RpcTxs, error) {
+	txs, err := f.GetTxListByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	if end == 0 || end > uint64(len(txs)) {
+		end = uint64(len(txs))
+	}
+	if start >= end {
+		return RpcTxs{}, nil
+	}
+	return txs[start:end], nil
+}
+
+func (f *FakeAPI) QueryTxBySrc(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error) {
+	return f.queryTx(ctx, startHeight, endHeight, limit, func(tx Transaction) bool {
+		return tx.From == addr
+	})
+}
+
+func (f *FakeAPI) QueryTxByDst(ctx context.Context, addr common.Address, startHeight, endHeight, limit uint64) (RpcTxs, error) {
+	return f.queryTx(ctx, startHeight, endHeight, limit, func(tx Transaction) bool {
+		return tx.To != nil && *tx.To == addr
+	})
+}
+
+// queryTx walks the heights upwards, unlike smartbchd it does not support a
+// start height larger than the end height.
+func (f *FakeAPI) queryTx(ctx context.Context, startHeight, endHeight, limit uint64, match func(Transaction) bool) (RpcTxs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if endHeight == 0 {
+		endHeight = f.latest
+	}
+	txs := RpcTxs{}
+	for h := startHeight; h <= endHeight; h++ {
+		block, ok := f.blocks[h]
+		if !ok {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if match(tx) {
+				txs = append(txs, tx)
+				if limit > 0 && uint64(len(txs)) >= limit {
+					return txs, nil
+				}
+			}
+		}
+	}
+	return txs, nil
+}
+
+func (f *FakeAPI) Call(ctx context.Context, args CallArgs, height uint64) (*CallDetail, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	detail, ok := f.calls[callKey(args)]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	return detail, nil
+}
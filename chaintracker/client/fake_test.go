@@ -0,0 +1,127 @@
+package client_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+var (
+	alice    = common.HexToAddress("0xa11ce")
+	bob      = common.HexToAddress("0xb0b")
+	token    = common.HexToAddress("0x2711")
+	transfer = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+)
+
+func fakeChain() *client.FakeAPI {
+	f := client.NewFakeAPI(big.NewInt(10000))
+	for h := uint64(1); h <= 3; h++ {
+		var txs client.RpcTxs
+		var receipts []*types.Receipt
+		for i := uint64(0); i < h; i++ {
+			hash := common.BigToHash(new(big.Int).SetUint64(h*100 + i))
+			to := bob
+			if i == 1 {
+				to = token
+			}
+			txs = append(txs, client.Transaction{Hash: hash, From: alice, To: &to, Nonce: hexutil.Uint64(h*10 + i)})
+			receipt := &types.Receipt{TxHash: hash, Status: types.ReceiptStatusSuccessful}
+			if to == token {
+				receipt.Logs = []*types.Log{{Address: token, Topics: []common.Hash{transfer, alice.Hash(), bob.Hash()}}}
+			}
+			receipts = append(receipts, receipt)
+		}
+		f.AddBlock(&client.Block{
+			Number:       hexutil.Uint64(h),
+			Hash:         common.BigToHash(new(big.Int).SetUint64(h)),
+			Transactions: txs,
+		}, receipts...)
+	}
+	return f
+}
+
+func TestFakeBlocksAndReceipts(t *testing.T) {
+	f := fakeChain()
+	ctx := context.Background()
+
+	latest, err := f.BlockNumber(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), latest)
+
+	block, err := f.GetBlockByNumber(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, block.Transactions, 2)
+	_, err = f.GetBlockByNumber(ctx, 4)
+	require.Error(t, err)
+
+	receipt, err := f.GetReceipt(ctx, block.Transactions[1].Hash)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), receipt.BlockNumber.Uint64())
+	require.Equal(t, block.Hash, receipt.Logs[0].BlockHash)
+	_, err = f.GetReceipt(ctx, common.Hash{})
+	require.Equal(t, ethereum.NotFound, err)
+
+	txs, err := f.GetTxListByHeightWithRange(ctx, 3, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+	require.Equal(t, common.BigToHash(big.NewInt(301)), txs[0].Hash)
+}
+
+func TestFakeLogsAndQueries(t *testing.T) {
+	f := fakeChain()
+	ctx := context.Background()
+
+	logs, err := f.GetLogs(ctx, ethereum.FilterQuery{Addresses: []common.Address{token}})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	logs, err = f.GetLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(3), Topics: [][]common.Hash{{transfer}}})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, uint64(3), logs[0].BlockNumber)
+	logs, err = f.GetLogs(ctx, ethereum.FilterQuery{Topics: [][]common.Hash{{}, {bob.Hash()}}})
+	require.NoError(t, err)
+	require.Empty(t, logs)
+
+	txs, err := f.QueryTxBySrc(ctx, alice, 1, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, txs, 6)
+	txs, err = f.QueryTxByDst(ctx, token, 1, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, txs, 1)
+	require.Equal(t, hexutil.Uint64(21), txs[0].Nonce)
+	txs, err = f.QueryTxBySrc(ctx, bob, 1, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, txs)
+}
+
+func TestFakeCallAndSend(t *testing.T) {
+	f := client.NewFakeAPI(big.NewInt(10000))
+	ctx := context.Background()
+
+	args := client.CallArgs{To: &token, Data: hexutil.MustDecode("0x18160ddd")}
+	_, err := f.Call(ctx, args, 0)
+	require.Error(t, err)
+	f.SetCall(args, &client.CallDetail{Status: 1, ReturnData: hexutil.MustDecode("0x01")})
+	detail, err := f.Call(ctx, args, 0)
+	require.NoError(t, err)
+	require.Equal(t, hexutil.Bytes{1}, detail.ReturnData)
+
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1})
+	require.NoError(t, f.SendRawTransaction(ctx, tx))
+	require.Len(t, f.Sent, 1)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(t, f.SendRawTransaction(canceled, tx))
+	_, err = f.BlockNumber(canceled)
+	require.Error(t, err)
+}
@@ -2,6 +2,10 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -9,38 +13,181 @@ import (
 
 type RpcTxs []Transaction
 
+// Block is a block as returned by eth_getBlockByNumber with full txs.
+type Block struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	Miner        common.Address `json:"miner"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	GasLimit     hexutil.Uint64 `json:"gasLimit"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Transactions RpcTxs         `json:"transactions"`
+}
+
+// CallArgs is the tx given to sbch_call.
+type CallArgs struct {
+	From     *common.Address `json:"from,omitempty"`
+	To       *common.Address `json:"to,omitempty"`
+	Gas      *hexutil.Uint64 `json:"gas,omitempty"`
+	GasPrice *hexutil.Big    `json:"gasPrice,omitempty"`
+	Value    *hexutil.Big    `json:"value,omitempty"`
+	Data     hexutil.Bytes   `json:"data,omitempty"`
+}
+
+// CallDetail is the result of sbch_call, the internal txs and the read/write
+// lists are kept as they are.
+type CallDetail struct {
+	Status          int             `json:"status"`
+	GasUsed         hexutil.Uint64  `json:"gasUsed"`
+	ReturnData      hexutil.Bytes   `json:"returnData"`
+	Logs            []CallLog       `json:"logs"`
+	ContractAddress common.Address  `json:"contractAddress"`
+	InternalTxs     json.RawMessage `json:"internalTransactions,omitempty"`
+	RwLists         json.RawMessage `json:"rwLists,omitempty"`
+}
+
+type CallLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
 func (t *Transaction) PrintJson() ([]byte, error) {
 	return json.Marshal(t)
 }
 
+// Transaction is a tx as returned by eth_getBlockByNumber. smartBCH only
+// returns the legacy fields, the others are filled by nodes which support
+// EIP-2930 and EIP-1559 txs.
 type Transaction struct {
-	BlockHash        *common.Hash    `json:"blockHash"`
-	BlockNumber      *hexutil.Big    `json:"blockNumber"`
-	From             common.Address  `json:"from"`
-	Gas              hexutil.Uint64  `json:"gas"`
-	GasPrice         *hexutil.Big    `json:"gasPrice"`
-	Hash             common.Hash     `json:"hash"`
-	Input            hexutil.Bytes   `json:"input"`
-	Nonce            hexutil.Uint64  `json:"nonce"`
-	To               *common.Address `json:"to"`
-	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
-	Value            *hexutil.Big    `json:"value"`
-	V                *hexutil.Big    `json:"v"`
-	R                *hexutil.Big    `json:"r"`
-	S                *hexutil.Big    `json:"s"`
-}
-
-func ConvertTx(tx Transaction) *types.Transaction {
-	t := &types.LegacyTx{
-		Nonce:    uint64(tx.Nonce),
-		GasPrice: tx.GasPrice.ToInt(),
-		Gas:      uint64(tx.Gas),
-		To:       tx.To,
-		Value:    tx.Value.ToInt(),
-		Data:     tx.Input,
-		//V:        tx.V.ToInt(),
-		//R:        tx.R.ToInt(),
-		//S:        tx.S.ToInt(),
-	}
-	return types.NewTx(t)
+	BlockHash            *common.Hash      `json:"blockHash"`
+	BlockNumber          *hexutil.Big      `json:"blockNumber"`
+	From                 common.Address    `json:"from"`
+	Gas                  hexutil.Uint64    `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	Hash                 common.Hash       `json:"hash"`
+	Input                hexutil.Bytes     `json:"input"`
+	Nonce                hexutil.Uint64    `json:"nonce"`
+	To                   *common.Address   `json:"to"`
+	TransactionIndex     *hexutil.Uint64   `json:"transactionIndex"`
+	Value                *hexutil.Big      `json:"value"`
+	V                    *hexutil.Big      `json:"v"`
+	R                    *hexutil.Big      `json:"r"`
+	S                    *hexutil.Big      `json:"s"`
+	Type                 *hexutil.Uint64   `json:"type,omitempty"`
+	ChainID              *hexutil.Big      `json:"chainId,omitempty"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+}
+
+// ConvertTx rebuilds the signed tx from its RPC form, the hash of the result
+// equals tx.Hash. smartBCH only keeps the lowest byte of V, so the chain ID
+// is needed to restore the V of EIP-155 txs.
+func ConvertTx(tx Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return nil, errors.New("no signature in tx " + tx.Hash.String())
+	}
+	txType := uint64(types.LegacyTxType)
+	if tx.Type != nil {
+		txType = uint64(*tx.Type)
+	}
+	if tx.ChainID != nil {
+		chainID = tx.ChainID.ToInt()
+	}
+	switch txType {
+	case types.LegacyTxType:
+		return convertLegacyTx(tx, chainID)
+	case types.AccessListTxType:
+		if chainID == nil {
+			return nil, errors.New("no chain ID for access list tx " + tx.Hash.String())
+		}
+		return checkHash(tx, types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      uint64(tx.Nonce),
+			GasPrice:   toInt(tx.GasPrice),
+			Gas:        uint64(tx.Gas),
+			To:         tx.To,
+			Value:      toInt(tx.Value),
+			Data:       tx.Input,
+			AccessList: accessList(tx),
+			V:          tx.V.ToInt(),
+			R:          tx.R.ToInt(),
+			S:          tx.S.ToInt(),
+		}))
+	case types.DynamicFeeTxType:
+		if chainID == nil {
+			return nil, errors.New("no chain ID for dynamic fee tx " + tx.Hash.String())
+		}
+		return checkHash(tx, types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      uint64(tx.Nonce),
+			GasTipCap:  toInt(tx.MaxPriorityFeePerGas),
+			GasFeeCap:  toInt(tx.MaxFeePerGas),
+			Gas:        uint64(tx.Gas),
+			To:         tx.To,
+			Value:      toInt(tx.Value),
+			Data:       tx.Input,
+			AccessList: accessList(tx),
+			V:          tx.V.ToInt(),
+			R:          tx.R.ToInt(),
+			S:          tx.S.ToInt(),
+		}))
+	default:
+		return nil, fmt.Errorf("unsupported type %d of tx %s", txType, tx.Hash)
+	}
+}
+
+// convertLegacyTx tries V as it is, then the EIP-155 values whose lowest byte
+// equals V, and takes the one giving the original hash.
+func convertLegacyTx(tx Transaction, chainID *big.Int) (*types.Transaction, error) {
+	v := tx.V.ToInt()
+	candidates := []*big.Int{v}
+	if chainID != nil && v.IsUint64() && v.Uint64() < 256 {
+		for recID := int64(0); recID < 2; recID++ {
+			full := new(big.Int).Mul(chainID, big.NewInt(2))
+			full.Add(full, big.NewInt(35+recID))
+			if full.Cmp(v) != 0 && full.Uint64()&0xff == v.Uint64() {
+				candidates = append(candidates, full)
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		signed := types.NewTx(&types.LegacyTx{
+			Nonce:    uint64(tx.Nonce),
+			GasPrice: toInt(tx.GasPrice),
+			Gas:      uint64(tx.Gas),
+			To:       tx.To,
+			Value:    toInt(tx.Value),
+			Data:     tx.Input,
+			V:        candidate,
+			R:        tx.R.ToInt(),
+			S:        tx.S.ToInt(),
+		})
+		if signed.Hash() == tx.Hash {
+			return signed, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot rebuild tx %s with V %s and chain ID %v", tx.Hash, v, chainID)
+}
+
+func checkHash(tx Transaction, signed *types.Transaction) (*types.Transaction, error) {
+	if signed.Hash() != tx.Hash {
+		return nil, fmt.Errorf("rebuilt tx hash %s does not match %s", signed.Hash(), tx.Hash)
+	}
+	return signed, nil
+}
+
+func toInt(b *hexutil.Big) *big.Int {
+	if b == nil {
+		return new(big.Int)
+	}
+	return b.ToInt()
+}
+
+func accessList(tx Transaction) types.AccessList {
+	if tx.AccessList == nil {
+		return nil
+	}
+	return *tx.AccessList
 }
@@ -0,0 +1,137 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+// testdata/txs.json holds txs in the form smartbchd returns them for chain
+// 10000, with V of the legacy txs cut to its lowest byte: EIP-155 transfers,
+// a contract creation, a pre-EIP-155 tx, and one tx of each typed kind. They
+// are signed locally, their block hashes and heights are made up. Run
+// TestUpdateFixtures against a mainnet smartbchd to replace them with mainnet
+// txs, which keep their hashes and heights in the file.
+//
+// fixturesChainID is the chain id the fixtures are signed for, the one of
+// smartBCH mainnet, which TestUpdateFixtures checks.
+var fixturesChainID = big.NewInt(10000)
+
+var (
+	fixturesRpcUrl = flag.String("fixtures-rpc-url", "",
+		"RPC URL of a mainnet smartbchd, TestUpdateFixtures rewrites testdata/txs.json with the txs found on it")
+	fixturesFrom   = flag.Uint64("fixtures-from", 1, "the height TestUpdateFixtures starts to search from")
+	fixturesBlocks = flag.Uint64("fixtures-blocks", 100000, "the number of blocks TestUpdateFixtures searches")
+)
+
+func loadFixtures(t *testing.T) []client.Transaction {
+	data, err := os.ReadFile("testdata/txs.json")
+	require.NoError(t, err)
+	var txs []client.Transaction
+	require.NoError(t, json.Unmarshal(data, &txs))
+	require.NotEmpty(t, txs)
+	return txs
+}
+
+func TestConvertTx(t *testing.T) {
+	for _, rpcTx := range loadFixtures(t) {
+		tx, err := client.ConvertTx(rpcTx, fixturesChainID)
+		require.NoError(t, err)
+		require.Equal(t, rpcTx.Hash, tx.Hash())
+
+		sender, err := types.LatestSignerForChainID(fixturesChainID).Sender(tx)
+		require.NoError(t, err)
+		require.Equal(t, rpcTx.From, sender)
+
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		decoded := new(types.Transaction)
+		require.NoError(t, decoded.UnmarshalBinary(raw))
+		require.Equal(t, rpcTx.Hash, decoded.Hash())
+	}
+}
+
+func TestConvertTxWrongChainID(t *testing.T) {
+	for _, rpcTx := range loadFixtures(t) {
+		if rpcTx.Type != nil || rpcTx.V.ToInt().Uint64() < 35 {
+			continue // typed and pre-EIP-155 txs do not depend on the given chain ID
+		}
+		_, err := client.ConvertTx(rpcTx, big.NewInt(1))
+		require.Error(t, err)
+	}
+}
+
+func TestConvertTxNoSignature(t *testing.T) {
+	rpcTx := loadFixtures(t)[0]
+	rpcTx.R = nil
+	_, err := client.ConvertTx(rpcTx, fixturesChainID)
+	require.Error(t, err)
+}
+
+// TestUpdateFixtures writes the first tx of each kind found on mainnet into
+// testdata/txs.json:
+//
+//	go test ./chaintracker/client -run TestUpdateFixtures -fixtures-rpc-url=<url>
+func TestUpdateFixtures(t *testing.T) {
+	if *fixturesRpcUrl == "" {
+		t.Skip("no -fixtures-rpc-url")
+	}
+	c, err := client.New(*fixturesRpcUrl)
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+	chainID, err := c.ChainID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, fixturesChainID, chainID)
+	latest, err := c.BlockNumber(ctx)
+	require.NoError(t, err)
+
+	kinds := []string{"eip155", "creation", "pre-eip155", "access-list", "dynamic-fee"}
+	found := make(map[string]client.Transaction)
+	for h := *fixturesFrom; h < *fixturesFrom+*fixturesBlocks && h <= latest && len(found) < len(kinds); h++ {
+		block, err := c.GetBlockByNumber(ctx, h)
+		require.NoError(t, err)
+		for _, tx := range block.Transactions {
+			kind := txKind(tx)
+			if _, ok := found[kind]; ok {
+				continue
+			}
+			_, err = client.ConvertTx(tx, fixturesChainID)
+			require.NoError(t, err, "tx %s at height %d", tx.Hash, h)
+			found[kind] = tx
+			t.Logf("%s tx %s at height %d", kind, tx.Hash, h)
+		}
+	}
+	var txs []client.Transaction
+	for _, kind := range kinds {
+		tx, ok := found[kind]
+		require.True(t, ok, "no %s tx found, search more blocks with -fixtures-from and -fixtures-blocks", kind)
+		txs = append(txs, tx)
+	}
+	data, err := json.MarshalIndent(txs, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile("testdata/txs.json", append(data, '\n'), 0644))
+}
+
+func txKind(tx client.Transaction) string {
+	switch {
+	case tx.Type != nil && *tx.Type == types.AccessListTxType:
+		return "access-list"
+	case tx.Type != nil && *tx.Type == types.DynamicFeeTxType:
+		return "dynamic-fee"
+	case tx.V.ToInt().Uint64() < 35:
+		return "pre-eip155"
+	case tx.To == nil:
+		return "creation"
+	}
+	return "eip155"
+}
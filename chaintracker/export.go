@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+// exportedTx is one line of the file written by export, Raw is the signed tx
+// which can be sent to another node as it is.
+type exportedTx struct {
+	Height uint64          `json:"height"`
+	Index  uint64          `json:"index"`
+	Hash   common.Hash     `json:"hash"`
+	From   common.Address  `json:"from"`
+	To     *common.Address `json:"to"`
+	Nonce  uint64          `json:"nonce"`
+	Raw    hexutil.Bytes   `json:"raw"`
+}
+
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "write the signed txs of a range of blocks to a file, one JSON per line",
+		Example: `chaintracker export \
+	--url=http://127.0.0.1:8545 \
+	--from=1 \
+	--to=100000 \
+	--out=txs.jsonl`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			return export(viper.GetString(flagUrl), viper.GetUint64(flagFrom), viper.GetUint64(flagTo), viper.GetString(flagOut))
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagUrl, "http://127.0.0.1:8545", "RPC URL of the source node")
+	cmd.Flags().Uint64(flagFrom, 1, "first height")
+	cmd.Flags().Uint64(flagTo, 0, "last height, the latest block if 0")
+	cmd.Flags().String(flagOut, "txs.jsonl", "output file")
+	return cmd
+}
+
+func export(url string, from, to uint64, out string) error {
+	c, err := client.New(url)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if to == 0 {
+		rctx, cancel := rpcCtx(ctx)
+		to, err = c.BlockNumber(rctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	defer w.Flush()
+
+	total, failed, err := exportTxs(ctx, c, from, to, w)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d txs of heights [%d, %d], %d could not be rebuilt\n", total, from, to, failed)
+	return nil
+}
+
+func exportTxs(ctx context.Context, c client.API, from, to uint64, w io.Writer) (total, failed int, err error) {
+	rctx, cancel := rpcCtx(ctx)
+	chainID, err := c.ChainID(rctx)
+	cancel()
+	if err != nil {
+		return 0, 0, err
+	}
+	for h := from; h <= to; h++ {
+		if h%1000 == 0 {
+			fmt.Printf("height: %d, txs: %d\n", h, total)
+		}
+		rctx, cancel := rpcCtx(ctx)
+		block, err := c.GetBlockByNumber(rctx, h)
+		cancel()
+		if err != nil {
+			return total, failed, fmt.Errorf("failed to get txs at height %d: %w", h, err)
+		}
+		for i, tx := range block.Transactions {
+			signed, err := client.ConvertTx(tx, chainID)
+			if err != nil {
+				// it could not be replayed as it is
+				fmt.Printf("failed to rebuild tx at height %d: %s\n", h, err.Error())
+				failed++
+				continue
+			}
+			raw, err := signed.MarshalBinary()
+			if err != nil {
+				return total, failed, err
+			}
+			line, _ := json.Marshal(exportedTx{
+				Height: h,
+				Index:  uint64(i),
+				Hash:   tx.Hash,
+				From:   tx.From,
+				To:     tx.To,
+				Nonce:  uint64(tx.Nonce),
+				Raw:    raw,
+			})
+			if _, err = w.Write(append(line, '\n')); err != nil {
+				return total, failed, err
+			}
+			total++
+		}
+	}
+	return total, failed, nil
+}
+
+// readExportedTxs reads the file of export, the old format with one hex
+// encoded raw tx per line is supported too.
+func readExportedTxs(path string) ([]*exportedTx, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var txs []*exportedTx
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var etx exportedTx
+		if line[0] == '{' {
+			if err = json.Unmarshal(line, &etx); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			txs = append(txs, &etx)
+			continue
+		}
+		raw, err := hex.DecodeString(strings.TrimPrefix(string(line), "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		tx, err := DecodeTx(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		from, err := txSender(tx)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		txs = append(txs, &exportedTx{Hash: tx.Hash(), From: from, To: tx.To(), Nonce: tx.Nonce(), Raw: raw})
+	}
+	return txs, scanner.Err()
+}
+
+// DecodeTx decodes both legacy and typed raw txs.
+func DecodeTx(data []byte) (*types.Transaction, error) {
+	tx := &types.Transaction{}
+	err := tx.UnmarshalBinary(data)
+	return tx, err
+}
+
+func txSender(tx *types.Transaction) (common.Address, error) {
+	if !tx.Protected() {
+		return types.Sender(types.HomesteadSigner{}, tx)
+	}
+	return types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+var testChainID = big.NewInt(10000)
+
+// rpcTx turns a signed tx into what smartbchd returns for it.
+func rpcTx(t *testing.T, tx *types.Transaction) client.Transaction {
+	from, err := types.Sender(types.LatestSignerForChainID(testChainID), tx)
+	require.NoError(t, err)
+	v, r, s := tx.RawSignatureValues()
+	return client.Transaction{
+		From:     from,
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Hash:     tx.Hash(),
+		Input:    tx.Data(),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		To:       tx.To(),
+		Value:    (*hexutil.Big)(tx.Value()),
+		V:        (*hexutil.Big)(big.NewInt(int64(byte(v.Uint64())))),
+		R:        (*hexutil.Big)(r),
+		S:        (*hexutil.Big)(s),
+	}
+}
+
+// fakeChain has 3 blocks, block h holds h transfers, and every receipt is
+// successful.
+func fakeChain(t *testing.T) (*client.FakeAPI, []*types.Transaction) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0xb0b")
+	f := client.NewFakeAPI(testChainID)
+	var signed []*types.Transaction
+	nonce := uint64(0)
+	for h := uint64(1); h <= 3; h++ {
+		block := &client.Block{Number: hexutil.Uint64(h), Hash: common.BigToHash(new(big.Int).SetUint64(h))}
+		var receipts []*types.Receipt
+		for i := uint64(0); i < h; i++ {
+			tx := types.MustSignNewTx(key, types.NewEIP155Signer(testChainID), &types.LegacyTx{
+				Nonce:    nonce,
+				GasPrice: big.NewInt(1e10),
+				Gas:      21000,
+				To:       &to,
+				Value:    big.NewInt(1),
+			})
+			nonce++
+			signed = append(signed, tx)
+			block.Transactions = append(block.Transactions, rpcTx(t, tx))
+			receipts = append(receipts, &types.Receipt{TxHash: tx.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000})
+		}
+		f.AddBlock(block, receipts...)
+	}
+	return f, signed
+}
+
+func exportToFile(t *testing.T, c client.API) []*exportedTx {
+	var buf bytes.Buffer
+	total, failed, err := exportTxs(context.Background(), c, 1, 3, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 6, total)
+	require.Zero(t, failed)
+	path := filepath.Join(t.TempDir(), "txs.jsonl")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	txs, err := readExportedTxs(path)
+	require.NoError(t, err)
+	return txs
+}
+
+func TestExport(t *testing.T) {
+	f, signed := fakeChain(t)
+	txs := exportToFile(t, f)
+	require.Len(t, txs, len(signed))
+	for i, etx := range txs {
+		require.Equal(t, signed[i].Hash(), etx.Hash)
+		tx, err := DecodeTx(etx.Raw)
+		require.NoError(t, err)
+		require.Equal(t, signed[i].Hash(), tx.Hash())
+		from, err := txSender(tx)
+		require.NoError(t, err)
+		require.Equal(t, etx.From, from)
+	}
+	require.Equal(t, uint64(3), txs[5].Height)
+	require.Equal(t, uint64(2), txs[5].Index)
+}
+
+func TestReplayAndVerify(t *testing.T) {
+	source, _ := fakeChain(t)
+	txs := exportToFile(t, source)
+
+	target := client.NewFakeAPI(testChainID)
+	for _, etx := range txs {
+		require.NoError(t, sendWithRetry(target, etx, 0))
+	}
+	require.Len(t, target.Sent, len(txs))
+
+	// the target mined all of them but the last, and the first one failed
+	for i, tx := range target.Sent[:len(txs)-1] {
+		receipt := &types.Receipt{TxHash: tx.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000}
+		if i == 0 {
+			receipt.Status = types.ReceiptStatusFailed
+		}
+		target.AddBlock(&client.Block{Number: hexutil.Uint64(i + 1)}, receipt)
+	}
+	mismatches, err := verifyTxs(context.Background(), source, target, txs)
+	require.NoError(t, err)
+	require.Equal(t, 2, mismatches)
+
+	mismatches, err = verifyTxs(context.Background(), source, source, txs)
+	require.NoError(t, err)
+	require.Zero(t, mismatches)
+}
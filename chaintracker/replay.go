@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+// smartbchd only accepts the tx whose nonce is the account nonce, so the next
+// tx of a sender is retried until the previous one is in a block.
+const (
+	errNonceTooLarge = "tx nonce is larger than the account nonce"
+	errNonceTooSmall = "tx nonce is smaller than the account nonce"
+	retryInterval    = 500 * time.Millisecond
+)
+
+func replayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "send the exported txs to the target node, keeping the nonce order of every sender",
+		Example: `chaintracker replay \
+	--file=txs.jsonl \
+	--target-url=http://127.0.0.1:8545 \
+	--rate=50 \
+	--workers=4`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			return replay(viper.GetString(flagFile), viper.GetString(flagTargetUrl),
+				viper.GetFloat64(flagRate), viper.GetInt(flagWorkers), viper.GetInt(flagRetries))
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagFile, "txs.jsonl", "file written by export")
+	cmd.Flags().String(flagTargetUrl, "http://127.0.0.1:8545", "RPC URL of the target node")
+	cmd.Flags().Float64(flagRate, 50, "max txs sent per second, 0 means no limit")
+	cmd.Flags().Int(flagWorkers, 1, "senders replayed concurrently, 1 keeps the order of the txs across senders")
+	cmd.Flags().Int(flagRetries, 120, "how many times a tx is retried before it is given up")
+	return cmd
+}
+
+type replayStats struct {
+	sent    int64
+	skipped int64
+	failed  int64
+}
+
+func replay(path, targetUrl string, rate float64, workers, retries int) error {
+	txs, err := readExportedTxs(path)
+	if err != nil {
+		return err
+	}
+	c, err := client.New(targetUrl)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if workers < 1 {
+		workers = 1
+	}
+
+	var limiter <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+	var stats replayStats
+	send := func(etx *exportedTx) {
+		if limiter != nil {
+			<-limiter
+		}
+		switch err := sendWithRetry(c, etx, retries); {
+		case err == nil:
+			if n := atomic.AddInt64(&stats.sent, 1); n%1000 == 0 {
+				fmt.Printf("another 1000 txs sent, total %d\n", n)
+			}
+		case strings.Contains(err.Error(), errNonceTooSmall):
+			// already replayed by a former run
+			atomic.AddInt64(&stats.skipped, 1)
+		default:
+			fmt.Printf("failed to send tx %s from %s: %s\n", etx.Hash, etx.From, err.Error())
+			atomic.AddInt64(&stats.failed, 1)
+		}
+	}
+
+	if workers == 1 {
+		for _, etx := range txs {
+			send(etx)
+		}
+	} else {
+		// each sender is handled by one worker, so its txs keep their order
+		var senders []common.Address
+		queues := make(map[common.Address][]*exportedTx)
+		for _, etx := range txs {
+			if _, ok := queues[etx.From]; !ok {
+				senders = append(senders, etx.From)
+			}
+			queues[etx.From] = append(queues[etx.From], etx)
+		}
+		senderCh := make(chan common.Address)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for sender := range senderCh {
+					for _, etx := range queues[sender] {
+						send(etx)
+					}
+				}
+			}()
+		}
+		for _, sender := range senders {
+			senderCh <- sender
+		}
+		close(senderCh)
+		wg.Wait()
+	}
+	fmt.Printf("replayed %d txs: %d sent, %d already on chain, %d failed\n",
+		len(txs), stats.sent, stats.skipped, stats.failed)
+	if stats.failed > 0 {
+		return fmt.Errorf("%d txs failed", stats.failed)
+	}
+	return nil
+}
+
+func sendWithRetry(c client.API, etx *exportedTx, retries int) error {
+	tx, err := DecodeTx(etx.Raw)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		ctx, cancel := rpcCtx(context.Background())
+		err = c.SendRawTransaction(ctx, tx)
+		cancel()
+		if err == nil || i >= retries || !isRetryable(err) {
+			return err
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+func isRetryable(err error) bool {
+	msg := err.Error()
+	return msg == "method handler crashed" ||
+		strings.Contains(msg, errNonceTooLarge) ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "timeout")
+}
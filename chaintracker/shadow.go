@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+const (
+	classMatch        = "match"
+	classResult       = "result-differs"
+	classError        = "error-differs"
+	classSourceError  = "source-error-only"
+	classTargetError  = "target-error-only"
+	classTransport    = "transport-error"
+	maxExampleBytes   = 512
+	maxLogsBlockRange = 1000
+)
+
+// the methods never replayed whatever the request log holds: the ones which
+// change the state, and the filters whose ids only mean something to one node
+var skippedMethods = map[string]bool{
+	"eth_sendRawTransaction":          true,
+	"eth_sendTransaction":             true,
+	"eth_sign":                        true,
+	"eth_signTransaction":             true,
+	"personal_sendTransaction":        true,
+	"personal_unlockAccount":          true,
+	"sbch_setRpcKey":                  true,
+	"sbch_injectFaultForTest":         true,
+	"eth_newFilter":                   true,
+	"eth_newBlockFilter":              true,
+	"eth_newPendingTransactionFilter": true,
+	"eth_getFilterChanges":            true,
+	"eth_getFilterLogs":               true,
+	"eth_uninstallFilter":             true,
+	"eth_subscribe":                   true,
+	"eth_unsubscribe":                 true,
+}
+
+func shadowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "shadow",
+		Short: "send the same read-only requests to two nodes and report the responses which differ",
+		Example: `chaintracker shadow \
+	--url=http://127.0.0.1:8545 \
+	--target-url=http://127.0.0.1:8546 \
+	--requests=requests.jsonl \
+	--synthesize=10000 \
+	--out=shadow_report.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			cfg := shadowConfig{
+				sourceUrl:  viper.GetString(flagUrl),
+				targetUrl:  viper.GetString(flagTargetUrl),
+				requests:   viper.GetString(flagRequests),
+				synthesize: viper.GetInt(flagSynthesize),
+				blocks:     viper.GetUint64(flagBlocks),
+				seed:       viper.GetInt64(flagSeed),
+				workers:    viper.GetInt(flagWorkers),
+				rate:       viper.GetFloat64(flagRate),
+				ignore:     viper.GetStringSlice(flagIgnore),
+				examples:   viper.GetInt(flagExamples),
+				out:        viper.GetString(flagOut),
+			}
+			return shadow(cfg)
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagUrl, "http://127.0.0.1:8545", "RPC URL of the reference node")
+	cmd.Flags().String(flagTargetUrl, "http://127.0.0.1:8546", "RPC URL of the node under test")
+	cmd.Flags().String(flagRequests, "", "recorded JSON-RPC requests, one request or batch per line")
+	cmd.Flags().Int(flagSynthesize, 0, "how many queries to synthesize over the addresses in recent blocks")
+	cmd.Flags().Uint64(flagBlocks, 200, "how many recent blocks the addresses are taken from")
+	cmd.Flags().Int64(flagSeed, 1, "seed of the synthesized queries")
+	cmd.Flags().Int(flagWorkers, 8, "requests sent concurrently")
+	cmd.Flags().Float64(flagRate, 0, "max requests per second to each node, 0 means no limit")
+	cmd.Flags().StringSlice(flagIgnore, nil, "fields dropped from the responses before comparing, at any depth")
+	cmd.Flags().Int(flagExamples, 5, "how many examples are kept for every method and class")
+	cmd.Flags().String(flagOut, "shadow_report.json", "report file")
+	return cmd
+}
+
+type shadowConfig struct {
+	sourceUrl  string
+	targetUrl  string
+	requests   string
+	synthesize int
+	blocks     uint64
+	seed       int64
+	workers    int
+	rate       float64
+	ignore     []string
+	examples   int
+	out        string
+}
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// rawCaller is what shadow needs from a node, client.Client implements it.
+type rawCaller interface {
+	CallRaw(ctx context.Context, method string, params []json.RawMessage) (json.RawMessage, error)
+}
+
+type shadowExample struct {
+	Params []json.RawMessage `json:"params"`
+	Diff   string            `json:"diff"`
+	Source string            `json:"source"`
+	Target string            `json:"target"`
+}
+
+type classReport struct {
+	Count    int             `json:"count"`
+	Examples []shadowExample `json:"examples,omitempty"`
+}
+
+type shadowReport struct {
+	Requests   int                                `json:"requests"`
+	Skipped    int                                `json:"skipped"`
+	Matched    int                                `json:"matched"`
+	Mismatched int                                `json:"mismatched"`
+	Transport  int                                `json:"transportErrors"`
+	Methods    map[string]map[string]*classReport `json:"methods"`
+
+	lock     sync.Mutex
+	examples int
+}
+
+func newShadowReport(examples int) *shadowReport {
+	return &shadowReport{Methods: make(map[string]map[string]*classReport), examples: examples}
+}
+
+func (r *shadowReport) add(req rpcRequest, class string, example shadowExample) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Requests++
+	switch class {
+	case classMatch:
+		r.Matched++
+	case classTransport:
+		r.Transport++
+	default:
+		r.Mismatched++
+	}
+	classes, ok := r.Methods[req.Method]
+	if !ok {
+		classes = make(map[string]*classReport)
+		r.Methods[req.Method] = classes
+	}
+	cr, ok := classes[class]
+	if !ok {
+		cr = &classReport{}
+		classes[class] = cr
+	}
+	cr.Count++
+	if class != classMatch && len(cr.Examples) < r.examples {
+		example.Params = req.Params
+		cr.Examples = append(cr.Examples, example)
+	}
+}
+
+func (r *shadowReport) print() {
+	methods := make([]string, 0, len(r.Methods))
+	for method := range r.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		classes := make([]string, 0, len(r.Methods[method]))
+		for class := range r.Methods[method] {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Printf("%-40s %-20s %d\n", method, class, r.Methods[method][class].Count)
+		}
+	}
+	fmt.Printf("%d requests: %d matched, %d mismatched, %d transport errors, %d requests skipped\n",
+		r.Requests, r.Matched, r.Mismatched, r.Transport, r.Skipped)
+}
+
+func shadow(cfg shadowConfig) error {
+	if cfg.requests == "" && cfg.synthesize <= 0 {
+		return errors.New("nothing to send, give --requests or --synthesize")
+	}
+	source, err := client.New(cfg.sourceUrl)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := client.New(cfg.targetUrl)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	report := newShadowReport(cfg.examples)
+	var reqs []rpcRequest
+	if cfg.requests != "" {
+		recorded, skipped, err := readRequestLog(cfg.requests)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, recorded...)
+		report.Skipped = skipped
+		fmt.Printf("read %d requests from %s, %d skipped\n", len(recorded), cfg.requests, skipped)
+	}
+	if cfg.synthesize > 0 {
+		synthesized, err := synthesizeRequests(context.Background(), source, target, cfg.synthesize, cfg.blocks, cfg.seed)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, synthesized...)
+	}
+
+	runShadow(context.Background(), source, target, reqs, cfg.workers, cfg.rate, cfg.ignore, report)
+	report.print()
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(cfg.out, data, 0644); err != nil {
+		return err
+	}
+	if report.Mismatched > 0 {
+		return fmt.Errorf("%d responses differ, see %s", report.Mismatched, cfg.out)
+	}
+	return nil
+}
+
+// readRequestLog reads one JSON-RPC request or batch per line, the requests
+// of skippedMethods are skipped.
+func readRequestLog(path string) (reqs []rpcRequest, skipped int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var batch []rpcRequest
+		if line[0] == '[' {
+			err = json.Unmarshal(line, &batch)
+		} else {
+			var req rpcRequest
+			err = json.Unmarshal(line, &req)
+			batch = append(batch, req)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", n, err)
+		}
+		for _, req := range batch {
+			if req.Method == "" || skippedMethods[req.Method] {
+				skipped++
+				continue
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs, skipped, scanner.Err()
+}
+
+// synthesizeRequests makes queries over the senders, receivers and contracts
+// of recent blocks. They are pinned to a height both nodes have, so the two
+// responses come from the same state.
+func synthesizeRequests(ctx context.Context, source, target client.API, n int, blocks uint64, seed int64) ([]rpcRequest, error) {
+	height, err := commonHeight(ctx, source, target)
+	if err != nil {
+		return nil, err
+	}
+	if blocks == 0 || blocks > height {
+		blocks = height
+	}
+	type call struct {
+		from common.Address
+		to   common.Address
+		data hexutil.Bytes
+	}
+	isAccount := make(map[common.Address]bool)
+	isContract := make(map[common.Address]bool)
+	var accounts, contracts []common.Address
+	var calls []call
+	for h := height - blocks + 1; h <= height; h++ {
+		rctx, cancel := rpcCtx(ctx)
+		block, err := source.GetBlockByNumber(rctx, h)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", h, err)
+		}
+		for _, tx := range block.Transactions {
+			if !isAccount[tx.From] {
+				isAccount[tx.From] = true
+				accounts = append(accounts, tx.From)
+			}
+			switch {
+			case tx.To == nil:
+			case len(tx.Input) > 0:
+				if !isContract[*tx.To] {
+					isContract[*tx.To] = true
+					contracts = append(contracts, *tx.To)
+				}
+				calls = append(calls, call{from: tx.From, to: *tx.To, data: tx.Input})
+			case !isAccount[*tx.To]:
+				isAccount[*tx.To] = true
+				accounts = append(accounts, *tx.To)
+			}
+		}
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no tx in blocks [%d, %d]", height-blocks+1, height)
+	}
+	fmt.Printf("synthesizing %d queries at height %d over %d accounts and %d contracts\n",
+		n, height, len(accounts), len(contracts))
+
+	param := func(v interface{}) json.RawMessage {
+		bz, _ := json.Marshal(v)
+		return bz
+	}
+	at := param(hexutil.Uint64(height))
+	rnd := rand.New(rand.NewSource(seed))
+	reqs := make([]rpcRequest, 0, n)
+	for len(reqs) < n {
+		account := accounts[rnd.Intn(len(accounts))]
+		switch kind := rnd.Intn(5); {
+		case kind == 0:
+			reqs = append(reqs, rpcRequest{Method: "eth_getBalance", Params: []json.RawMessage{param(account), at}})
+		case kind == 1:
+			reqs = append(reqs, rpcRequest{Method: "eth_getTransactionCount", Params: []json.RawMessage{param(account), at}})
+		case kind == 2 && len(contracts) > 0:
+			contract := contracts[rnd.Intn(len(contracts))]
+			reqs = append(reqs, rpcRequest{Method: "eth_getCode", Params: []json.RawMessage{param(contract), at}})
+		case kind == 3 && len(calls) > 0:
+			c := calls[rnd.Intn(len(calls))]
+			msg := map[string]interface{}{"from": c.from, "to": c.to, "data": c.data}
+			reqs = append(reqs, rpcRequest{Method: "eth_call", Params: []json.RawMessage{param(msg), at}})
+		case kind == 4 && len(contracts) > 0:
+			contract := contracts[rnd.Intn(len(contracts))]
+			span := uint64(rnd.Intn(maxLogsBlockRange)) + 1
+			if span > height {
+				span = height
+			}
+			filter := map[string]interface{}{
+				"address":   contract,
+				"fromBlock": hexutil.Uint64(height - span + 1),
+				"toBlock":   hexutil.Uint64(height),
+			}
+			reqs = append(reqs, rpcRequest{Method: "eth_getLogs", Params: []json.RawMessage{param(filter)}})
+		}
+	}
+	return reqs, nil
+}
+
+func commonHeight(ctx context.Context, source, target client.API) (uint64, error) {
+	var heights [2]uint64
+	for i, c := range []client.API{source, target} {
+		rctx, cancel := rpcCtx(ctx)
+		h, err := c.BlockNumber(rctx)
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+		heights[i] = h
+	}
+	if heights[1] < heights[0] {
+		return heights[1], nil
+	}
+	return heights[0], nil
+}
+
+func runShadow(ctx context.Context, source, target rawCaller, reqs []rpcRequest, workers int, rate float64, ignore []string, report *shadowReport) {
+	if workers < 1 {
+		workers = 1
+	}
+	var limiter <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+	ignored := make(map[string]bool)
+	for _, field := range ignore {
+		ignored[field] = true
+	}
+	reqCh := make(chan rpcRequest)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range reqCh {
+				class, example := compareCall(ctx, source, target, req, ignored)
+				report.add(req, class, example)
+			}
+		}()
+	}
+	for i, req := range reqs {
+		if limiter != nil {
+			<-limiter
+		}
+		if i > 0 && i%1000 == 0 {
+			fmt.Printf("sent %d requests\n", i)
+		}
+		reqCh <- req
+	}
+	close(reqCh)
+	wg.Wait()
+}
+
+// compareCall sends the request to both nodes at once and classifies the
+// difference of the normalized responses.
+func compareCall(ctx context.Context, source, target rawCaller, req rpcRequest, ignored map[string]bool) (string, shadowExample) {
+	var results [2]json.RawMessage
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, node := range []rawCaller{source, target} {
+		wg.Add(1)
+		go func(i int, node rawCaller) {
+			defer wg.Done()
+			rctx, cancel := rpcCtx(ctx)
+			defer cancel()
+			results[i], errs[i] = node.CallRaw(rctx, req.Method, req.Params)
+		}(i, node)
+	}
+	wg.Wait()
+
+	example := shadowExample{Source: describe(results[0], errs[0]), Target: describe(results[1], errs[1])}
+	if isTransportError(errs[0]) || isTransportError(errs[1]) {
+		return classTransport, example
+	}
+	switch {
+	case errs[0] == nil && errs[1] == nil:
+		example.Diff = diffJSON(normalizeJSON(results[0], ignored), normalizeJSON(results[1], ignored), "$")
+		if example.Diff == "" {
+			return classMatch, example
+		}
+		return classResult, example
+	case errs[0] == nil:
+		return classTargetError, example
+	case errs[1] == nil:
+		return classSourceError, example
+	}
+	if errorKey(errs[0]) == errorKey(errs[1]) {
+		return classMatch, example
+	}
+	example.Diff = fmt.Sprintf("%s vs %s", errorKey(errs[0]), errorKey(errs[1]))
+	return classError, example
+}
+
+// isTransportError tells the errors of the connection from the errors
+// returned by the node.
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
+
+func errorKey(err error) string {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return fmt.Sprintf("%d: %s", rpcErr.ErrorCode(), strings.ToLower(rpcErr.Error()))
+	}
+	return err.Error()
+}
+
+func describe(result json.RawMessage, err error) string {
+	s := string(result)
+	if err != nil {
+		s = "error: " + err.Error()
+	}
+	if len(s) > maxExampleBytes {
+		s = s[:maxExampleBytes] + "..."
+	}
+	return s
+}
+
+// normalizeJSON drops the ignored fields and lowers the case of hex strings,
+// the numbers are kept as they are written.
+func normalizeJSON(raw json.RawMessage, ignored map[string]bool) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return string(raw)
+	}
+	return normalizeValue(v, ignored)
+}
+
+func normalizeValue(v interface{}, ignored map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if ignored[k] {
+				delete(v, k)
+				continue
+			}
+			v[k] = normalizeValue(child, ignored)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeValue(child, ignored)
+		}
+		return v
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			return strings.ToLower(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// diffJSON returns the path of the first difference, or "" if a equals b.
+func diffJSON(a, b interface{}, path string) string {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok {
+			return path
+		}
+		keys := make([]string, 0, len(a)+len(bm))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d := diffJSON(a[k], bm[k], path+"."+k); d != "" {
+				return d
+			}
+		}
+		return ""
+	case []interface{}:
+		bs, ok := b.([]interface{})
+		if !ok {
+			return path
+		}
+		if len(a) != len(bs) {
+			return fmt.Sprintf("%s (length %d vs %d)", path, len(a), len(bs))
+		}
+		for i := range a {
+			if d := diffJSON(a[i], bs[i], fmt.Sprintf("%s[%d]", path, i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	default:
+		if !reflect.DeepEqual(a, b) {
+			return path
+		}
+		return ""
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e rpcError) Error() string  { return e.msg }
+func (e rpcError) ErrorCode() int { return e.code }
+
+// fakeNode answers every method with the same result or error.
+type fakeNode map[string]struct {
+	result string
+	err    error
+}
+
+func (n fakeNode) CallRaw(_ context.Context, method string, _ []json.RawMessage) (json.RawMessage, error) {
+	resp := n[method]
+	return json.RawMessage(resp.result), resp.err
+}
+
+func TestCompareCall(t *testing.T) {
+	source := fakeNode{
+		"eth_getBalance":   {result: `"0xAB"`},
+		"eth_getBlock":     {result: `{"hash":"0x01","timestamp":"0x10","txs":[1,2]}`},
+		"eth_getLogs":      {result: `[{"data":"0x"}]`},
+		"eth_call":         {err: rpcError{3, "execution reverted"}},
+		"eth_estimateGas":  {err: rpcError{-32000, "out of gas"}},
+		"eth_getCode":      {result: `"0x"`},
+		"eth_chainId":      {result: `"0x2710"`},
+		"sbch_getCcInfo":   {err: errors.New("connection refused")},
+		"eth_gasPrice":     {result: `"0x1"`},
+		"eth_blockNumber":  {err: rpcError{-32601, "Method not found"}},
+		"eth_getStorageAt": {result: `"0x00"`},
+	}
+	target := fakeNode{
+		"eth_getBalance":   {result: `"0xab"`},
+		"eth_getBlock":     {result: `{"hash":"0x01","timestamp":"0x11","txs":[1,2]}`},
+		"eth_getLogs":      {result: `[{"data":"0x"},{"data":"0x"}]`},
+		"eth_call":         {err: rpcError{3, "execution reverted"}},
+		"eth_estimateGas":  {err: rpcError{-32000, "gas required exceeds allowance"}},
+		"eth_getCode":      {err: rpcError{-32000, "header not found"}},
+		"eth_chainId":      {result: `"0x2710"`},
+		"sbch_getCcInfo":   {result: `{}`},
+		"eth_gasPrice":     {err: rpcError{-32000, "busy"}},
+		"eth_blockNumber":  {err: rpcError{-32601, "method not found"}},
+		"eth_getStorageAt": {result: `"0x01"`},
+	}
+	cases := []struct {
+		method string
+		class  string
+		diff   string
+	}{
+		{"eth_getBalance", classMatch, ""},
+		{"eth_getBlock", classResult, "$.timestamp"},
+		{"eth_getLogs", classResult, "$ (length 1 vs 2)"},
+		{"eth_call", classMatch, ""},
+		{"eth_estimateGas", classError, "-32000: out of gas vs -32000: gas required exceeds allowance"},
+		{"eth_getCode", classTargetError, ""},
+		{"eth_gasPrice", classTargetError, ""},
+		{"sbch_getCcInfo", classTransport, ""},
+		{"eth_blockNumber", classMatch, ""},
+		{"eth_getStorageAt", classResult, "$"},
+	}
+	for _, c := range cases {
+		class, example := compareCall(context.Background(), source, target, rpcRequest{Method: c.method}, nil)
+		require.Equal(t, c.class, class, c.method)
+		require.Equal(t, c.diff, example.Diff, c.method)
+	}
+
+	class, _ := compareCall(context.Background(), source, target, rpcRequest{Method: "eth_getBlock"},
+		map[string]bool{"timestamp": true})
+	require.Equal(t, classMatch, class)
+}
+
+func TestShadowReport(t *testing.T) {
+	source := fakeNode{"eth_getBalance": {result: `"0x1"`}, "eth_getCode": {result: `"0x"`}}
+	target := fakeNode{"eth_getBalance": {result: `"0x2"`}, "eth_getCode": {result: `"0x"`}}
+	var reqs []rpcRequest
+	for i := 0; i < 10; i++ {
+		reqs = append(reqs, rpcRequest{Method: "eth_getBalance"}, rpcRequest{Method: "eth_getCode"})
+	}
+	report := newShadowReport(3)
+	runShadow(context.Background(), source, target, reqs, 4, 0, nil, report)
+	require.Equal(t, 20, report.Requests)
+	require.Equal(t, 10, report.Matched)
+	require.Equal(t, 10, report.Mismatched)
+	require.Equal(t, 10, report.Methods["eth_getBalance"][classResult].Count)
+	require.Len(t, report.Methods["eth_getBalance"][classResult].Examples, 3)
+	require.Empty(t, report.Methods["eth_getCode"][classMatch].Examples)
+}
+
+func TestReadRequestLog(t *testing.T) {
+	log := `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x01","latest"]}
+
+[{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":3,"method":"eth_sendRawTransaction","params":["0x00"]}]
+{"jsonrpc":"2.0","id":4,"method":"eth_getFilterChanges","params":["0x1"]}
+`
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(log), 0644))
+	reqs, skipped, err := readRequestLog(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, skipped)
+	require.Len(t, reqs, 2)
+	require.Equal(t, "eth_getBalance", reqs[0].Method)
+	require.Len(t, reqs[0].Params, 2)
+	require.Equal(t, "eth_blockNumber", reqs[1].Method)
+}
+
+func TestSynthesizeRequests(t *testing.T) {
+	contract := common.HexToAddress("0x2711")
+	receiver := common.HexToAddress("0xb0b")
+	source := client.NewFakeAPI(big.NewInt(10000))
+	target := client.NewFakeAPI(big.NewInt(10000))
+	for h := uint64(1); h <= 5; h++ {
+		sender := common.BigToAddress(new(big.Int).SetUint64(h))
+		block := &client.Block{Number: hexutil.Uint64(h), Transactions: client.RpcTxs{
+			{From: sender, To: &receiver},
+			{From: sender, To: &contract, Input: hexutil.MustDecode("0x18160ddd")},
+		}}
+		source.AddBlock(block)
+		if h <= 4 {
+			target.AddBlock(block)
+		}
+	}
+
+	reqs, err := synthesizeRequests(context.Background(), source, target, 200, 10, 1)
+	require.NoError(t, err)
+	require.Len(t, reqs, 200)
+	methods := make(map[string]int)
+	for _, req := range reqs {
+		methods[req.Method]++
+		switch req.Method {
+		case "eth_getBalance", "eth_getTransactionCount", "eth_getCode", "eth_call":
+			// pinned to the height both nodes have
+			require.Equal(t, `"0x4"`, string(req.Params[1]))
+		case "eth_getLogs":
+			var filter map[string]string
+			require.NoError(t, json.Unmarshal(req.Params[0], &filter))
+			require.Equal(t, "0x4", filter["toBlock"])
+			require.Equal(t, contract, common.HexToAddress(filter["address"]))
+		}
+	}
+	require.Len(t, methods, 5)
+
+	again, err := synthesizeRequests(context.Background(), source, target, 200, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, reqs, again)
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+func statsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "walk the blocks with a pool of workers and collect statistics, resuming from the checkpoint if any",
+		Example: `chaintracker stats \
+	--urls=http://127.0.0.1:8545,http://127.0.0.1:8546 \
+	--from=1 \
+	--workers=16 \
+	--out=stats \
+	--format=csv`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			cfg := statsConfig{
+				urls:            viper.GetStringSlice(flagUrls),
+				from:            viper.GetUint64(flagFrom),
+				to:              viper.GetUint64(flagTo),
+				workers:         viper.GetInt(flagWorkers),
+				retries:         viper.GetInt(flagRetries),
+				out:             viper.GetString(flagOut),
+				format:          viper.GetString(flagFormat),
+				checkpoint:      viper.GetString(flagCheckpoint),
+				checkpointEvery: viper.GetUint64(flagCheckpointEvery),
+				top:             viper.GetInt(flagTop),
+			}
+			return walkStats(cfg)
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringSlice(flagUrls, []string{"http://127.0.0.1:8545"}, "RPC URLs of the nodes, the workers are spread over them")
+	cmd.Flags().Uint64(flagFrom, 1, "first height")
+	cmd.Flags().Uint64(flagTo, 0, "last height, the latest block if 0")
+	cmd.Flags().Int(flagWorkers, 8, "blocks fetched concurrently")
+	cmd.Flags().Int(flagRetries, 5, "how many times fetching a block is retried before the walk stops")
+	cmd.Flags().String(flagOut, "stats", "output directory")
+	cmd.Flags().String(flagFormat, formatCSV, "output format, csv or json")
+	cmd.Flags().String(flagCheckpoint, "", "checkpoint file, <out>/checkpoint.json if empty")
+	cmd.Flags().Uint64(flagCheckpointEvery, 10000, "save the checkpoint every this many blocks")
+	cmd.Flags().Int(flagTop, 20, "how many top senders and contracts are written")
+	return cmd
+}
+
+type statsConfig struct {
+	urls            []string
+	from, to        uint64
+	workers         int
+	retries         int
+	out             string
+	format          string
+	checkpoint      string
+	checkpointEvery uint64
+	top             int
+}
+
+// chainStats holds what has been collected from the blocks in [From, Next),
+// it is saved as the checkpoint, so an interrupted walk goes on from Next.
+type chainStats struct {
+	From         uint64 `json:"from"`
+	Next         uint64 `json:"next"`
+	BlocksOffset int64  `json:"blocksOffset"` // size of the blocks file up to Next
+
+	Blocks       uint64 `json:"blocks"`
+	EmptyBlocks  uint64 `json:"emptyBlocks"`
+	Txs          uint64 `json:"txs"`
+	GasUsed      uint64 `json:"gasUsed"`
+	MaxGasUsed   uint64 `json:"maxGasUsed"`
+	MaxGasHeight uint64 `json:"maxGasHeight"`
+
+	// by envelope: legacy, access-list, dynamic-fee
+	TxTypes map[string]uint64 `json:"txTypes"`
+	// by what the tx does: transfer, contract-call, contract-creation
+	TxKinds map[string]uint64 `json:"txKinds"`
+	// txs sent by every address, and txs with input data sent to every address
+	Senders   map[common.Address]uint64 `json:"senders"`
+	Contracts map[common.Address]uint64 `json:"contracts"`
+
+	// the day being walked, only its addresses are kept
+	Day       string                  `json:"day"`
+	DayTxs    uint64                  `json:"dayTxs"`
+	DayActive map[common.Address]bool `json:"dayActive"`
+	Daily     []dailyStats            `json:"daily"`
+}
+
+type dailyStats struct {
+	Date            string `json:"date"`
+	Txs             uint64 `json:"txs"`
+	ActiveAddresses int    `json:"activeAddresses"`
+}
+
+type blockStats struct {
+	Height    uint64 `json:"height"`
+	Timestamp uint64 `json:"timestamp"`
+	Txs       int    `json:"txs"`
+	GasUsed   uint64 `json:"gasUsed"`
+	GasLimit  uint64 `json:"gasLimit"`
+}
+
+type addressCount struct {
+	Address common.Address `json:"address"`
+	Txs     uint64         `json:"txs"`
+}
+
+func newChainStats(from uint64) *chainStats {
+	return &chainStats{
+		From:      from,
+		Next:      from,
+		TxTypes:   make(map[string]uint64),
+		TxKinds:   make(map[string]uint64),
+		Senders:   make(map[common.Address]uint64),
+		Contracts: make(map[common.Address]uint64),
+		DayActive: make(map[common.Address]bool),
+	}
+}
+
+func loadCheckpoint(path string, from uint64) (*chainStats, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newChainStats(from), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats := newChainStats(from)
+	if err = json.Unmarshal(data, stats); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if stats.From != from {
+		return nil, fmt.Errorf("checkpoint %s starts at height %d, remove it to start from %d", path, stats.From, from)
+	}
+	fmt.Printf("resuming from height %d, %d blocks walked\n", stats.Next, stats.Blocks)
+	return stats, nil
+}
+
+// saveCheckpoint writes to a temp file first, a crash must not leave a
+// truncated checkpoint.
+func (stats *chainStats) saveCheckpoint(path string) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// apply must be called in the order of heights, the daily stats rely on it.
+func (stats *chainStats) apply(block *client.Block) {
+	height := uint64(block.Number)
+	gasUsed := uint64(block.GasUsed)
+	stats.Blocks++
+	stats.GasUsed += gasUsed
+	if gasUsed > stats.MaxGasUsed {
+		stats.MaxGasUsed, stats.MaxGasHeight = gasUsed, height
+	}
+	if len(block.Transactions) == 0 {
+		stats.EmptyBlocks++
+	}
+
+	day := time.Unix(int64(block.Timestamp), 0).UTC().Format("2006-01-02")
+	if day != stats.Day {
+		if stats.Day != "" {
+			stats.Daily = append(stats.Daily, stats.currentDay())
+		}
+		stats.Day, stats.DayTxs = day, 0
+		stats.DayActive = make(map[common.Address]bool)
+	}
+
+	for _, tx := range block.Transactions {
+		stats.Txs++
+		stats.DayTxs++
+		stats.TxTypes[txTypeName(tx)]++
+		stats.Senders[tx.From]++
+		stats.DayActive[tx.From] = true
+		switch {
+		case tx.To == nil:
+			stats.TxKinds["contract-creation"]++
+		case len(tx.Input) > 0:
+			stats.TxKinds["contract-call"]++
+			stats.Contracts[*tx.To]++
+			stats.DayActive[*tx.To] = true
+		default:
+			stats.TxKinds["transfer"]++
+			stats.DayActive[*tx.To] = true
+		}
+	}
+	stats.Next = height + 1
+}
+
+func (stats *chainStats) currentDay() dailyStats {
+	return dailyStats{Date: stats.Day, Txs: stats.DayTxs, ActiveAddresses: len(stats.DayActive)}
+}
+
+func (stats *chainStats) daily() []dailyStats {
+	if stats.Day == "" {
+		return stats.Daily
+	}
+	return append(append([]dailyStats{}, stats.Daily...), stats.currentDay())
+}
+
+func txTypeName(tx client.Transaction) string {
+	if tx.Type == nil {
+		return "legacy"
+	}
+	switch *tx.Type {
+	case 0:
+		return "legacy"
+	case 1:
+		return "access-list"
+	case 2:
+		return "dynamic-fee"
+	default:
+		return "type-" + strconv.FormatUint(uint64(*tx.Type), 10)
+	}
+}
+
+func topAddresses(counts map[common.Address]uint64, n int) []addressCount {
+	list := make([]addressCount, 0, len(counts))
+	for addr, txs := range counts {
+		list = append(list, addressCount{Address: addr, Txs: txs})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Txs != list[j].Txs {
+			return list[i].Txs > list[j].Txs
+		}
+		return list[i].Address.Hex() < list[j].Address.Hex()
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+type fetchResult struct {
+	height uint64
+	block  *client.Block
+	err    error
+}
+
+func walkStats(cfg statsConfig) error {
+	if len(cfg.urls) == 0 {
+		return errors.New("no RPC URL")
+	}
+	if cfg.format != formatCSV && cfg.format != formatJSON {
+		return fmt.Errorf("unknown format: %s", cfg.format)
+	}
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+	if cfg.checkpointEvery == 0 {
+		cfg.checkpointEvery = 10000
+	}
+	if cfg.checkpoint == "" {
+		cfg.checkpoint = filepath.Join(cfg.out, "checkpoint.json")
+	}
+	clients := make([]client.API, len(cfg.urls))
+	for i, url := range cfg.urls {
+		c, err := client.New(url)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		clients[i] = c
+	}
+	return collectStats(cfg, clients)
+}
+
+// collectStats spreads the workers over clients.
+func collectStats(cfg statsConfig, clients []client.API) error {
+	if cfg.to == 0 {
+		rctx, cancel := rpcCtx(context.Background())
+		latest, err := clients[0].BlockNumber(rctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		cfg.to = latest
+	}
+	if err := os.MkdirAll(cfg.out, 0755); err != nil {
+		return err
+	}
+	stats, err := loadCheckpoint(cfg.checkpoint, cfg.from)
+	if err != nil {
+		return err
+	}
+
+	// the blocks walked after the last checkpoint are walked again, so they
+	// are cut off the blocks file
+	blocksFile, err := os.OpenFile(filepath.Join(cfg.out, "blocks."+blocksExt(cfg.format)), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer blocksFile.Close()
+	if err = blocksFile.Truncate(stats.BlocksOffset); err != nil {
+		return err
+	}
+	if _, err = blocksFile.Seek(stats.BlocksOffset, 0); err != nil {
+		return err
+	}
+	blocksWriter := bufio.NewWriter(blocksFile)
+	if stats.BlocksOffset == 0 && cfg.format == formatCSV {
+		n, _ := blocksWriter.WriteString("height,timestamp,txs,gas_used,gas_limit\n")
+		stats.BlocksOffset += int64(n)
+	}
+	checkpoint := func() error {
+		if err := blocksWriter.Flush(); err != nil {
+			return err
+		}
+		return stats.saveCheckpoint(cfg.checkpoint)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a worker can only run ahead of the slowest one by the size of window,
+	// which bounds the blocks waiting to be applied in order
+	window := make(chan struct{}, cfg.workers*16)
+	heights := make(chan uint64)
+	results := make(chan fetchResult, cfg.workers)
+	go func() {
+		defer close(heights)
+		for h := stats.Next; h <= cfg.to; h++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case heights <- h:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+		go func(c client.API) {
+			defer wg.Done()
+			for h := range heights {
+				block, err := fetchBlock(ctx, c, h, cfg.retries)
+				select {
+				case results <- fetchResult{height: h, block: block, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(clients[i%len(clients)])
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	started, startNext := time.Now(), stats.Next
+	pending := make(map[uint64]*client.Block)
+	var walkErr error
+	for res := range results {
+		if res.err != nil {
+			if walkErr == nil && ctx.Err() == nil {
+				walkErr = fmt.Errorf("failed to get block %d: %w", res.height, res.err)
+			}
+			cancel()
+			continue
+		}
+		if walkErr != nil {
+			continue
+		}
+		pending[res.height] = res.block
+		for block := pending[stats.Next]; block != nil; block = pending[stats.Next] {
+			delete(pending, stats.Next)
+			stats.apply(block)
+			n, err := writeBlockStats(blocksWriter, cfg.format, block)
+			if err != nil {
+				walkErr = err
+				cancel()
+				break
+			}
+			stats.BlocksOffset += int64(n)
+			<-window
+			if walked := stats.Next - startNext; walked%cfg.checkpointEvery == 0 {
+				if err = checkpoint(); err != nil {
+					walkErr = err
+					cancel()
+					break
+				}
+				speed := float64(walked) / time.Since(started).Seconds()
+				fmt.Printf("height: %d, txs: %d, %.1f blocks/s\n", stats.Next-1, stats.Txs, speed)
+			}
+		}
+	}
+
+	if err = checkpoint(); err != nil {
+		return err
+	}
+	if err = writeStats(cfg, stats); err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return fmt.Errorf("%w, run again to resume from height %d", walkErr, stats.Next)
+	}
+	if stats.Next <= cfg.to {
+		fmt.Printf("interrupted, run again to resume from height %d\n", stats.Next)
+		return nil
+	}
+	fmt.Printf("walked heights [%d, %d]: %d txs, statistics written to %s\n", stats.From, cfg.to, stats.Txs, cfg.out)
+	return nil
+}
+
+func fetchBlock(ctx context.Context, c client.API, height uint64, retries int) (*client.Block, error) {
+	for i := 0; ; i++ {
+		rctx, cancel := rpcCtx(ctx)
+		block, err := c.GetBlockByNumber(rctx, height)
+		cancel()
+		if err == nil || i >= retries || ctx.Err() != nil {
+			return block, err
+		}
+		select {
+		case <-time.After(retryInterval * time.Duration(i+1)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func blocksExt(format string) string {
+	if format == formatJSON {
+		return "jsonl"
+	}
+	return formatCSV
+}
+
+func writeBlockStats(w *bufio.Writer, format string, block *client.Block) (int, error) {
+	bs := blockStats{
+		Height:    uint64(block.Number),
+		Timestamp: uint64(block.Timestamp),
+		Txs:       len(block.Transactions),
+		GasUsed:   uint64(block.GasUsed),
+		GasLimit:  uint64(block.GasLimit),
+	}
+	if format == formatJSON {
+		line, _ := json.Marshal(bs)
+		return w.Write(append(line, '\n'))
+	}
+	return fmt.Fprintf(w, "%d,%d,%d,%d,%d\n", bs.Height, bs.Timestamp, bs.Txs, bs.GasUsed, bs.GasLimit)
+}
+
+type statsSummary struct {
+	From           uint64            `json:"from"`
+	To             uint64            `json:"to"`
+	Blocks         uint64            `json:"blocks"`
+	EmptyBlocks    uint64            `json:"emptyBlocks"`
+	Txs            uint64            `json:"txs"`
+	GasUsed        uint64            `json:"gasUsed"`
+	AvgGasPerBlock uint64            `json:"avgGasPerBlock"`
+	MaxGasUsed     uint64            `json:"maxGasUsed"`
+	MaxGasHeight   uint64            `json:"maxGasHeight"`
+	Senders        int               `json:"senders"`
+	Contracts      int               `json:"contracts"`
+	TxTypes        map[string]uint64 `json:"txTypes"`
+	TxKinds        map[string]uint64 `json:"txKinds"`
+	Daily          []dailyStats      `json:"daily"`
+	TopSenders     []addressCount    `json:"topSenders"`
+	TopContracts   []addressCount    `json:"topContracts"`
+}
+
+func (stats *chainStats) summary(top int) statsSummary {
+	s := statsSummary{
+		From:         stats.From,
+		To:           stats.Next - 1,
+		Blocks:       stats.Blocks,
+		EmptyBlocks:  stats.EmptyBlocks,
+		Txs:          stats.Txs,
+		GasUsed:      stats.GasUsed,
+		MaxGasUsed:   stats.MaxGasUsed,
+		MaxGasHeight: stats.MaxGasHeight,
+		Senders:      len(stats.Senders),
+		Contracts:    len(stats.Contracts),
+		TxTypes:      stats.TxTypes,
+		TxKinds:      stats.TxKinds,
+		Daily:        stats.daily(),
+		TopSenders:   topAddresses(stats.Senders, top),
+		TopContracts: topAddresses(stats.Contracts, top),
+	}
+	if stats.Blocks > 0 {
+		s.AvgGasPerBlock = stats.GasUsed / stats.Blocks
+	}
+	return s
+}
+
+// writeStats writes stats.json, or summary.csv, daily.csv, top_senders.csv
+// and top_contracts.csv.
+func writeStats(cfg statsConfig, stats *chainStats) error {
+	s := stats.summary(cfg.top)
+	if cfg.format == formatJSON {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(cfg.out, "stats.json"), data, 0644)
+	}
+
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	summary := [][]string{
+		{"metric", "value"},
+		{"from", u(s.From)},
+		{"to", u(s.To)},
+		{"blocks", u(s.Blocks)},
+		{"empty_blocks", u(s.EmptyBlocks)},
+		{"txs", u(s.Txs)},
+		{"gas_used", u(s.GasUsed)},
+		{"avg_gas_per_block", u(s.AvgGasPerBlock)},
+		{"max_gas_used", u(s.MaxGasUsed)},
+		{"max_gas_height", u(s.MaxGasHeight)},
+		{"senders", strconv.Itoa(s.Senders)},
+		{"contracts", strconv.Itoa(s.Contracts)},
+	}
+	for _, m := range []map[string]uint64{s.TxTypes, s.TxKinds} {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			summary = append(summary, []string{name, u(m[name])})
+		}
+	}
+	daily := [][]string{{"date", "txs", "active_addresses"}}
+	for _, d := range s.Daily {
+		daily = append(daily, []string{d.Date, u(d.Txs), strconv.Itoa(d.ActiveAddresses)})
+	}
+	addresses := func(list []addressCount) [][]string {
+		records := [][]string{{"address", "txs"}}
+		for _, ac := range list {
+			records = append(records, []string{ac.Address.Hex(), u(ac.Txs)})
+		}
+		return records
+	}
+
+	files := map[string][][]string{
+		"summary.csv":       summary,
+		"daily.csv":         daily,
+		"top_senders.csv":   addresses(s.TopSenders),
+		"top_contracts.csv": addresses(s.TopContracts),
+	}
+	for name, records := range files {
+		if err := writeCSV(filepath.Join(cfg.out, name), records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(path string, records [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	if err = w.WriteAll(records); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+func TestCollectStats(t *testing.T) {
+	f, _ := fakeChain(t)
+	out := t.TempDir()
+	cfg := statsConfig{from: 1, to: 2, workers: 2, out: out, format: formatCSV, checkpointEvery: 1, top: 5}
+	cfg.checkpoint = filepath.Join(out, "checkpoint.json")
+	blocksPath := filepath.Join(out, "blocks.csv")
+	require.NoError(t, collectStats(cfg, []client.API{f}))
+	stats, err := loadCheckpoint(cfg.checkpoint, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), stats.Next)
+	require.Equal(t, uint64(3), stats.Txs)
+
+	// the block written after the last checkpoint is cut off before resuming
+	blocksFile, err := os.OpenFile(blocksPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = blocksFile.WriteString("3,0,3,0,0\n")
+	require.NoError(t, err)
+	require.NoError(t, blocksFile.Close())
+	cfg.to = 3
+	require.NoError(t, collectStats(cfg, []client.API{f}))
+	bz, err := os.ReadFile(blocksPath)
+	require.NoError(t, err)
+	require.Equal(t, "height,timestamp,txs,gas_used,gas_limit\n1,0,1,0,0\n2,0,2,0,0\n3,0,3,0,0\n", string(bz))
+	stats, err = loadCheckpoint(cfg.checkpoint, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), stats.Next)
+	require.Equal(t, uint64(3), stats.Blocks)
+	require.Equal(t, uint64(6), stats.Txs)
+	require.Equal(t, int64(len(bz)), stats.BlocksOffset)
+	require.Equal(t, map[string]uint64{"transfer": 6}, stats.TxKinds)
+
+	// fails at the missing block and keeps the checkpoint before it
+	cfg.to = 4
+	err = collectStats(cfg, []client.API{f})
+	require.EqualError(t, err, "failed to get block 4: block 4 not found, run again to resume from height 4")
+
+	_, err = loadCheckpoint(cfg.checkpoint, 2)
+	require.EqualError(t, err, "checkpoint "+cfg.checkpoint+" starts at height 1, remove it to start from 2")
+}
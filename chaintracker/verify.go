@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/smartbch/testkit/chaintracker/client"
+)
+
+func verifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "compare the receipts of the exported txs on the source and the target node",
+		Example: `chaintracker verify \
+	--file=txs.jsonl \
+	--url=http://127.0.0.1:8545 \
+	--target-url=http://127.0.0.1:8546`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			return verify(viper.GetString(flagFile), viper.GetString(flagUrl), viper.GetString(flagTargetUrl))
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagFile, "txs.jsonl", "file written by export")
+	cmd.Flags().String(flagUrl, "http://127.0.0.1:8545", "RPC URL of the source node")
+	cmd.Flags().String(flagTargetUrl, "http://127.0.0.1:8546", "RPC URL of the target node")
+	return cmd
+}
+
+func verify(path, sourceUrl, targetUrl string) error {
+	txs, err := readExportedTxs(path)
+	if err != nil {
+		return err
+	}
+	source, err := client.New(sourceUrl)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := client.New(targetUrl)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	mismatches, err := verifyTxs(context.Background(), source, target, txs)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("verified %d txs, %d mismatches\n", len(txs), mismatches)
+	if mismatches > 0 {
+		return fmt.Errorf("%d receipts do not match", mismatches)
+	}
+	return nil
+}
+
+func verifyTxs(ctx context.Context, source, target client.API, txs []*exportedTx) (mismatches int, err error) {
+	for i, etx := range txs {
+		if i > 0 && i%1000 == 0 {
+			fmt.Printf("verified %d txs, %d mismatches\n", i, mismatches)
+		}
+		rctx, cancel := rpcCtx(ctx)
+		want, err := source.GetReceipt(rctx, etx.Hash)
+		cancel()
+		if err != nil {
+			return mismatches, fmt.Errorf("failed to get receipt of %s from source: %w", etx.Hash, err)
+		}
+		rctx, cancel = rpcCtx(ctx)
+		got, err := target.GetReceipt(rctx, etx.Hash)
+		cancel()
+		if err != nil {
+			fmt.Printf("tx %s: no receipt on target: %s\n", etx.Hash, err.Error())
+			mismatches++
+			continue
+		}
+		if diff := diffReceipts(want, got); diff != "" {
+			fmt.Printf("tx %s: %s\n", etx.Hash, diff)
+			mismatches++
+		}
+	}
+	return mismatches, nil
+}
+
+// diffReceipts compares what the txs did, the block fields are expected to
+// differ between the two chains.
+func diffReceipts(want, got *types.Receipt) string {
+	if want.Status != got.Status {
+		return fmt.Sprintf("status %d, target %d", want.Status, got.Status)
+	}
+	if want.GasUsed != got.GasUsed {
+		return fmt.Sprintf("gas used %d, target %d", want.GasUsed, got.GasUsed)
+	}
+	if want.ContractAddress != got.ContractAddress {
+		return fmt.Sprintf("contract address %s, target %s", want.ContractAddress, got.ContractAddress)
+	}
+	if len(want.Logs) != len(got.Logs) {
+		return fmt.Sprintf("%d logs, target %d", len(want.Logs), len(got.Logs))
+	}
+	for i := range want.Logs {
+		w, g := want.Logs[i], got.Logs[i]
+		if w.Address != g.Address || !bytes.Equal(w.Data, g.Data) || len(w.Topics) != len(g.Topics) {
+			return fmt.Sprintf("log #%d differs", i)
+		}
+		for j := range w.Topics {
+			if w.Topics[j] != g.Topics[j] {
+				return fmt.Sprintf("topic #%d of log #%d differs", j, i)
+			}
+		}
+	}
+	return ""
+}
@@ -1,60 +1,97 @@
 package main
 
 import (
-	"crypto/sha256"
-	"crypto/tls"
+	"context"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"math/rand"
-	"net/http"
 	"time"
 
 	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/smartbch/param"
 	"github.com/smartbch/smartbch/rpc/types"
 	"github.com/smartbch/testkit/cctester/utils"
 )
 
-var redeemUtxoCache map[[32]byte]bool
-var convertUtxoCache map[[32]byte]bool
+var submitted *dedupStore
 
-func run(sbchRpcUrl, operatorUrl string) {
-	redeemUtxoCache = make(map[[32]byte]bool)
-	convertUtxoCache = make(map[[32]byte]bool)
-	sbchClient, err := NewSbchClient(sbchRpcUrl)
+// pendingTimeout is how long a pending submission whose tx is not on the fake
+// node is kept, the fake node mines the txs it got every few seconds.
+var pendingTimeout = 30 * time.Second
+
+// minerFee is taken from the value of a converted UTXO, in satoshi.
+var minerFee int64 = param.RedeemOrCovertMinerFee
+
+// collectorConfig is filled from the command line by main.
+type collectorConfig struct {
+	sbchRpcUrl string
+	statePath  string
+	rpcPubkey  []byte
+	mitm       bool
+	interval   time.Duration
+	once       bool
+}
+
+// run handles the pending UTXOs every interval until ctx is done, or only
+// once in one-shot mode. It returns how many UTXOs failed in the last round.
+func run(ctx context.Context, cfg collectorConfig) (int, error) {
+	var err error
+	submitted, err = loadDedupStore(cfg.statePath)
 	if err != nil {
-		fmt.Println("failed to create smartBCH RPC client:", err.Error())
-		return
+		return 0, fmt.Errorf("failed to load dedup state: %w", err)
+	}
+	sbchClient, err := NewSbchClient(cfg.sbchRpcUrl, cfg.rpcPubkey, cfg.mitm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create smartBCH RPC client: %w", err)
 	}
 	for {
-		handleAllPendingUTXOs(sbchClient, operatorUrl)
-		time.Sleep(1 * time.Second)
+		reconcile()
+		failed := handleAllPendingUTXOs(ctx, sbchClient)
+		if cfg.once {
+			return failed, nil
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("fakecollector stopped")
+			return failed, nil
+		case <-time.After(cfg.interval):
+		}
 	}
 }
 
-func handleAllPendingUTXOs(sbchClient *SbchClient, operatorUrl string) {
-	//fmt.Println("handleAllPendingUTXOs...")
-
+// handleAllPendingUTXOs returns the number of UTXOs which could not be
+// handled. Once ctx is done no more UTXO is started, while the one in flight
+// is finished so that it is recorded in the dedup store.
+func handleAllPendingUTXOs(ctx context.Context, sbchClient *SbchClient) int {
+	failed := 0
 	//fmt.Println("GetRedeemingUtxosForOperators...")
 	redeemingUtxos, err := sbchClient.GetRedeemingUtxosForOperators()
 	if err != nil {
 		fmt.Println("failed to get redeeming UTXOs:", err.Error())
-		return
+		return 1
 	}
 	//utxosJson, _ := json.MarshalIndent(redeemingUtxos, "", "  ")
 	//fmt.Println("UTXOS:", string(utxosJson))
 	if len(redeemingUtxos.Infos) > 0 {
+		ccInfo, err := sbchClient.GetCcInfo()
+		if err != nil {
+			fmt.Println("failed to get ccCovenantInfo:", err.Error())
+			return 1
+		}
 		for _, utxo := range redeemingUtxos.Infos {
-			handleRedeemingUTXO(operatorUrl, utxo)
+			if ctx.Err() != nil {
+				return failed
+			}
+			if err = handleRedeemingUTXO(ccInfo, utxo); err != nil {
+				fmt.Printf("failed to redeem UTXO, txid:%s, err:%s\n", utxo.Txid.String(), err.Error())
+				failed++
+			}
 		}
 	}
 	//fmt.Println("GetToBeConvertedUtxosForOperators...")
 	toBeConvertedUtxos, err := sbchClient.GetToBeConvertedUtxosForOperators()
 	if err != nil {
-		fmt.Println("failed to get redeeming UTXOs:", err.Error())
-		return
+		fmt.Println("failed to get to-be-converted UTXOs:", err.Error())
+		return failed + 1
 	}
 	//utxosJson, _ = json.MarshalIndent(toBeConvertedUtxos, "", "  ")
 	//fmt.Println("UTXOS:", string(utxosJson))
@@ -62,74 +99,118 @@ func handleAllPendingUTXOs(sbchClient *SbchClient, operatorUrl string) {
 		ccInfo, err := sbchClient.GetCcInfo()
 		if err != nil {
 			fmt.Println("failed to get ccCovenantInfo:", err.Error())
+			return failed + 1
 		}
 		for _, utxo := range toBeConvertedUtxos.Infos {
-			handleToBeConvertedUTXO(ccInfo, operatorUrl, utxo)
+			if ctx.Err() != nil {
+				return failed
+			}
+			if err = handleToBeConvertedUTXO(ccInfo, utxo); err != nil {
+				fmt.Printf("failed to convert UTXO, txid:%s, err:%s\n", utxo.Txid.String(), err.Error())
+				failed++
+			}
 		}
 	}
+	return failed
 }
 
-func handleRedeemingUTXO(operatorUrl string, utxo *types.UtxoInfo) {
-	out, err := json.Marshal(utxo)
-	hash := sha256.Sum256(out)
-	if _, exist := redeemUtxoCache[hash]; exist {
-		//fmt.Println("already exist")
-		return
-	}
-	sig, err := getSigByHash(operatorUrl, utxo.TxSigHash)
-	for err != nil {
-		fmt.Println("failed to get sig by hash, retry:", err.Error())
-		time.Sleep(2 * time.Second)
-		sig, err = getSigByHash(operatorUrl, utxo.TxSigHash)
-	}
-	fmt.Printf("handleRedeemingUTXO, txid:%s, txSigHash:%s, sig:%s\n", utxo.Txid.String(), utxo.TxSigHash.String(), hex.EncodeToString(sig))
-	utils.BuildAndSendMainnetRedeemTx(hex.EncodeToString(utxo.Txid[:]))
-	redeemUtxoCache[hash] = true
+// reconcile settles the submissions left pending by a crash between recording
+// them and sending their tx, or by a failed send. The ones whose tx is on the
+// fake node are marked sent, the others are dropped after pendingTimeout so
+// that their UTXO is handled again.
+func reconcile() {
+	for _, s := range submitted.pendingList() {
+		txid := gethcmn.HexToHash(s.Txid)
+		var height int64
+		err := catch(func() { height = utils.FindMainnetTx(s.MainTxid, s.FromHeight) })
+		switch {
+		case err != nil:
+			fmt.Printf("failed to find the %s tx %s: %s\n", s.Kind, s.MainTxid, err.Error())
+			continue
+		case height >= 0:
+			err = submitted.markSent(s.Kind, txid, s.Vout)
+		case time.Since(time.Unix(s.SubmittedAt, 0)) > pendingTimeout:
+			fmt.Printf("%s tx %s of %s:%d is not on the fake node, dropping it\n", s.Kind, s.MainTxid, s.Txid, s.Vout)
+			err = submitted.remove(s.Kind, txid, s.Vout)
+		}
+		if err != nil {
+			fmt.Println("failed to update dedup state:", err.Error())
+		}
+	}
 }
 
-func handleToBeConvertedUTXO(info *types.CcInfo, operatorUrl string, utxo *types.UtxoInfo) {
-	out, err := json.Marshal(utxo)
-	hash := sha256.Sum256(out)
-	if _, exist := convertUtxoCache[hash]; exist {
-		//fmt.Println("already exist")
-		return
-	}
-	sig, err := getSigByHash(operatorUrl, utxo.TxSigHash)
-	for err != nil {
-		fmt.Println("failed to get sig by hash, retry:", err.Error())
-		time.Sleep(2 * time.Second)
-		sig, err = getSigByHash(operatorUrl, utxo.TxSigHash)
-	}
-	txidB := [32]byte{}
-	rand.Read(txidB[:])
-	txid := gethcmn.Hash(txidB)
-	fmt.Printf("handleRedeemingUTXO, txid:%s, txSigHash:%s, sig:%s, inTxid:%s\n", txid.String(), utxo.TxSigHash.String(), hex.EncodeToString(sig), utxo.Txid.String())
-	utils.BuildAndSendConvertTx(utxo.Txid.String(), txid.String(), info.CurrCovenantAddress, "0.9999" /*hard code*/)
-	convertUtxoCache[hash] = true
+// catch turns the panics of the utils package, which panics when the fake
+// node can not be reached, into an error.
+func catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
 }
 
-func getSigByHash(operatorUrl string, txSigHash []byte) ([]byte, error) {
-	fullUrl := operatorUrl + "/sig?hash=" + hex.EncodeToString(txSigHash)
-	fmt.Println("getSigByHash:", fullUrl)
-	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 3 * time.Second}
-	resp, err := client.Get(fullUrl)
-	if err != nil {
-		return nil, err
+// send records the submission as pending, then sends the tx and marks it sent.
+// If the collector dies in between, reconcile finds out whether the tx got
+// to the fake node.
+func send(kind string, utxo *types.UtxoInfo, mainTxid string, sendTx func() error) error {
+	var fromHeight int64
+	if err := catch(func() { fromHeight = utils.GetMainnetBlockCount() }); err != nil {
+		return err
+	}
+	if err := submitted.addPending(kind, utxo.Txid, utxo.Index, mainTxid, fromHeight); err != nil {
+		return err
+	}
+	if err := sendTx(); err != nil {
+		return err
 	}
+	return submitted.markSent(kind, utxo.Txid, utxo.Index)
+}
 
-	defer resp.Body.Close()
-	respBytes, err := io.ReadAll(resp.Body)
+// handleRedeemingUTXO only lets the fake node mine the redeem tx after enough
+// operators signed it correctly, otherwise it is retried in the next round.
+func handleRedeemingUTXO(info *types.CcInfo, utxo *types.UtxoInfo) error {
+	if submitted.has(submitRedeem, utxo.Txid, utxo.Index) {
+		return nil
+	}
+	scriptSig, err := buildRedeemScriptSig(info, utxo)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var respJson OperatorResp
-	err = json.Unmarshal(respBytes, &respJson)
+	fmt.Printf("handleRedeemingUTXO, txid:%s, txSigHash:%s, scriptSig:%s\n", utxo.Txid.String(), utxo.TxSigHash.String(), hex.EncodeToString(scriptSig))
+	// the fake node gives the redeem tx the txid of the UTXO
+	return send(submitRedeem, utxo, utxo.Txid.String(), func() error {
+		return utils.BuildAndSendMainnetRedeemTx(hex.EncodeToString(utxo.Txid[:]), hex.EncodeToString(scriptSig))
+	})
+}
+
+// handleToBeConvertedUTXO sends the convert tx signed by the operators to
+// the fake node, with the txid and the value of the real tx.
+func handleToBeConvertedUTXO(info *types.CcInfo, utxo *types.UtxoInfo) error {
+	if submitted.has(submitConvert, utxo.Txid, utxo.Index) {
+		return nil
+	}
+	if int64(utxo.Amount) <= minerFee {
+		return fmt.Errorf("UTXO too small to pay the miner fee: %d", uint64(utxo.Amount))
+	}
+	tx, err := buildConvertTx(info, utxo)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if respJson.Error != "" {
-		return nil, errors.New(respJson.Error)
+	// the covenant takes the fee smartbchd uses in txSigHash, ours must agree
+	amount := int64(utxo.Amount) - minerFee
+	if tx.TxOut[0].Value != amount {
+		return fmt.Errorf("miner fee mismatch, convert tx value:%d, expected:%d", tx.TxOut[0].Value, amount)
 	}
+	scriptSig := tx.TxIn[0].SignatureScript
+	txid := tx.TxHash().String()
+	fmt.Printf("handleToBeConvertedUTXO, txid:%s, txSigHash:%s, scriptSig:%s, inTxid:%s, amount:%d\n", txid, utxo.TxSigHash.String(), hex.EncodeToString(scriptSig), utxo.Txid.String(), amount)
+	return send(submitConvert, utxo, txid, func() error {
+		return utils.BuildAndSendConvertTx(utxo.Txid.String(), txid, info.CurrCovenantAddress, formatSatoshi(amount), hex.EncodeToString(scriptSig))
+	})
+}
 
-	return gethcmn.FromHex(respJson.Result), nil
+func formatSatoshi(amount int64) string {
+	return fmt.Sprintf("%d.%08d", amount/1e8, amount%1e8)
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/gcash/bchd/bchec"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/gcash/bchutil"
+	"github.com/smartbch/smartbch/crosschain/covenant"
+	"github.com/smartbch/smartbch/rpc/types"
+)
+
+// the operators sign the covenant txs with this hash type
+const sigHashType = txscript.SigHashAll | txscript.SigHashForkID
+
+// signerSet is a cc-covenant together with the operators who can unlock it.
+type signerSet struct {
+	covenant  *covenant.CcCovenant
+	operators []*types.OperatorInfo
+}
+
+func newSignerSet(operators []*types.OperatorInfo, monitors []*types.MonitorInfo) (*signerSet, error) {
+	ccc, err := covenant.NewDefaultCcCovenant(getOperatorPubkeys(operators), getMonitorPubkeys(monitors))
+	if err != nil {
+		return nil, err
+	}
+	return &signerSet{covenant: ccc, operators: operators}, nil
+}
+
+// getCurrSignerSet returns the signers of the current covenant, which also
+// receive the converted UTXOs.
+func getCurrSignerSet(info *types.CcInfo) (*signerSet, error) {
+	return newSignerSet(info.Operators, info.Monitors)
+}
+
+// getOldSignerSet returns the signers of the last covenant, smartbchd falls
+// back to the current ones when there was no change yet.
+func getOldSignerSet(info *types.CcInfo) (*signerSet, error) {
+	operators, monitors := info.OldOperators, info.OldMonitors
+	if len(operators) == 0 {
+		operators = info.Operators
+	}
+	if len(monitors) == 0 {
+		monitors = info.Monitors
+	}
+	return newSignerSet(operators, monitors)
+}
+
+// findSignerSet returns the signers of the covenant which locks the UTXO.
+func findSignerSet(info *types.CcInfo, covenantAddr gethcmn.Address) (*signerSet, error) {
+	curr, err := getCurrSignerSet(info)
+	if err != nil {
+		return nil, err
+	}
+	if addr, err := curr.covenant.GetP2SHAddress20(); err == nil && addr == covenantAddr {
+		return curr, nil
+	}
+	old, err := getOldSignerSet(info)
+	if err != nil {
+		return nil, err
+	}
+	if addr, err := old.covenant.GetP2SHAddress20(); err == nil && addr == covenantAddr {
+		return old, nil
+	}
+	return nil, fmt.Errorf("unknown covenant address: %s", covenantAddr.String())
+}
+
+// verifyOperatorSig checks a DER signature followed by the hash type byte.
+func verifyOperatorSig(pubkey, hash, sig []byte) error {
+	if len(sig) < 2 {
+		return errors.New("signature too short")
+	}
+	if txscript.SigHashType(sig[len(sig)-1]) != sigHashType {
+		return fmt.Errorf("invalid sighash type: %#x", sig[len(sig)-1])
+	}
+	parsedSig, err := bchec.ParseDERSignature(sig[:len(sig)-1], bchec.S256())
+	if err != nil {
+		return err
+	}
+	pk, err := bchec.ParsePubKey(pubkey, bchec.S256())
+	if err != nil {
+		return err
+	}
+	if !parsedSig.Verify(hash, pk) {
+		return errors.New("signature does not match operator pubkey")
+	}
+	return nil
+}
+
+// buildRedeemScriptSig rebuilds the redeem tx smartbchd asked the operators
+// to sign, and returns its unlocking script, which is nil in the single
+// operator mode.
+func buildRedeemScriptSig(info *types.CcInfo, utxo *types.UtxoInfo) ([]byte, error) {
+	signers, err := findSignerSet(info, utxo.CovenantAddr)
+	if err != nil {
+		return nil, err
+	}
+	toAddr, err := bchutil.NewAddressPubKeyHash(utxo.RedeemTarget[:], signers.covenant.Net())
+	if err != nil {
+		return nil, err
+	}
+	unsignedTx, hash, err := signers.covenant.GetRedeemByUserTxSigHash(
+		utxo.Txid[:], utxo.Index, int64(utxo.Amount), toAddr.EncodeAddress())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hash, utxo.TxSigHash) {
+		return nil, fmt.Errorf("txSigHash mismatch, smartbchd: %x, rebuilt: %x", []byte(utxo.TxSigHash), hash)
+	}
+	if singleOperator {
+		return nil, signers.checkSingleSig(hash)
+	}
+	sigs, err := signers.collectSigs(hash)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, _, err := signers.covenant.FinishRedeemByUserTx(unsignedTx, sigs)
+	if err != nil {
+		return nil, err
+	}
+	return signedTx.TxIn[0].SignatureScript, nil
+}
+
+// buildConvertTx rebuilds the convert tx from the old covenant to the current
+// one, and returns it signed by the operators, or unsigned in the single
+// operator mode.
+func buildConvertTx(info *types.CcInfo, utxo *types.UtxoInfo) (*wire.MsgTx, error) {
+	signers, err := getOldSignerSet(info)
+	if err != nil {
+		return nil, err
+	}
+	newOperatorPks, newMonitorPks := getOperatorPubkeys(info.Operators), getMonitorPubkeys(info.Monitors)
+	unsignedTx, hash, err := signers.covenant.GetConvertByOperatorsTxSigHash(
+		utxo.Txid[:], utxo.Index, int64(utxo.Amount), newOperatorPks, newMonitorPks)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hash, utxo.TxSigHash) {
+		return nil, fmt.Errorf("txSigHash mismatch, smartbchd: %x, rebuilt: %x", []byte(utxo.TxSigHash), hash)
+	}
+	if singleOperator {
+		return unsignedTx, signers.checkSingleSig(hash)
+	}
+	sigs, err := signers.collectSigs(hash)
+	if err != nil {
+		return nil, err
+	}
+	signedTx, _, err := signers.covenant.FinishConvertByOperatorsTx(unsignedTx, newOperatorPks, newMonitorPks, sigs)
+	return signedTx, err
+}
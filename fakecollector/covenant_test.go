@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gcash/bchd/bchec"
+	"github.com/gcash/bchd/txscript"
+	"github.com/smartbch/smartbch/param"
+	"github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyOperatorSig(t *testing.T) {
+	key, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	pubkey := key.PubKey().SerializeCompressed()
+	hash := sha256.Sum256([]byte("tx"))
+	sign := func(key *bchec.PrivateKey, hash []byte, hashType txscript.SigHashType) []byte {
+		sig, err := key.SignECDSA(hash)
+		require.NoError(t, err)
+		return append(sig.Serialize(), byte(hashType))
+	}
+	require.NoError(t, verifyOperatorSig(pubkey, hash[:], sign(key, hash[:], sigHashType)))
+
+	err = verifyOperatorSig(pubkey, hash[:], sign(key, hash[:], txscript.SigHashAll))
+	require.EqualError(t, err, "invalid sighash type: 0x1")
+	other := sha256.Sum256(hash[:])
+	err = verifyOperatorSig(pubkey, hash[:], sign(key, other[:], sigHashType))
+	require.EqualError(t, err, "signature does not match operator pubkey")
+	otherKey, err := bchec.NewPrivateKey(bchec.S256())
+	require.NoError(t, err)
+	err = verifyOperatorSig(pubkey, hash[:], sign(otherKey, hash[:], sigHashType))
+	require.EqualError(t, err, "signature does not match operator pubkey")
+	require.EqualError(t, verifyOperatorSig(pubkey, hash[:], []byte{0x41}), "signature too short")
+	require.Error(t, verifyOperatorSig(pubkey, hash[:], []byte{0x30, 0x00, byte(sigHashType)}))
+}
+
+func TestCollectSigs(t *testing.T) {
+	hash := sha256.Sum256([]byte("tx"))
+	signers := &signerSet{}
+	var urls []string
+	for i := 0; i < 10; i++ {
+		key, err := bchec.NewPrivateKey(bchec.S256())
+		require.NoError(t, err)
+		signers.operators = append(signers.operators, &types.OperatorInfo{Pubkey: key.PubKey().SerializeCompressed()})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sig, err := key.SignECDSA(hash[:])
+			require.NoError(t, err)
+			sigHex := hex.EncodeToString(append(sig.Serialize(), byte(sigHashType)))
+			_ = json.NewEncoder(w).Encode(OperatorResp{Success: true, Result: sigHex})
+		}))
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+	defer func() { operatorUrls, defaultOperatorUrl = nil, "" }()
+
+	operatorUrls = urls
+	sigs, err := signers.collectSigs(hash[:])
+	require.NoError(t, err)
+	require.Len(t, sigs, param.MinOperatorSigCount)
+
+	// one url signs for one operator only
+	operatorUrls, defaultOperatorUrl = nil, urls[0]
+	_, err = signers.collectSigs(hash[:])
+	require.EqualError(t, err, "only 1 of 10 operators signed, need 7")
+	require.NoError(t, signers.checkSingleSig(hash[:]))
+}
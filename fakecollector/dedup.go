@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	submitRedeem  = "redeem"
+	submitConvert = "convert"
+)
+
+// submission records a main chain tx the collector asked the fake node to mine.
+// It is recorded as pending before the tx is sent, a pending submission is
+// settled by reconcile.
+type submission struct {
+	Kind        string `json:"kind"`
+	Txid        string `json:"txid"`
+	Vout        uint32 `json:"vout"`
+	MainTxid    string `json:"mainTxid,omitempty"`
+	SubmittedAt int64  `json:"submittedAt"`
+	Pending     bool   `json:"pending,omitempty"`
+	FromHeight  int64  `json:"fromHeight,omitempty"` // the fake node's height before sending
+}
+
+// dedupStore makes sure every cc-UTXO is spent at most once, even across
+// restarts of the collector. It is keyed by the outpoint, so changes in other
+// fields of the UtxoInfo, like ExpectedSignTime, do not matter.
+type dedupStore struct {
+	path        string
+	lock        sync.Mutex
+	submissions map[string]*submission
+}
+
+func outpointKey(kind string, txid gethcmn.Hash, vout uint32) string {
+	return fmt.Sprintf("%s:%s:%d", kind, txid.String(), vout)
+}
+
+func loadDedupStore(path string) (*dedupStore, error) {
+	store := &dedupStore{path: path, submissions: make(map[string]*submission)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*submission
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid dedup file %s: %w", path, err)
+	}
+	for _, s := range list {
+		store.submissions[outpointKey(s.Kind, gethcmn.HexToHash(s.Txid), s.Vout)] = s
+	}
+	fmt.Printf("loaded %d submissions from %s\n", len(list), path)
+	return store, nil
+}
+
+func (store *dedupStore) has(kind string, txid gethcmn.Hash, vout uint32) bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	_, ok := store.submissions[outpointKey(kind, txid, vout)]
+	return ok
+}
+
+// addPending records the intent to send the tx mainTxid spending the
+// outpoint, and flushes the store before the tx is sent to the fake node.
+func (store *dedupStore) addPending(kind string, txid gethcmn.Hash, vout uint32, mainTxid string, fromHeight int64) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.submissions[outpointKey(kind, txid, vout)] = &submission{
+		Kind:        kind,
+		Txid:        txid.String(),
+		Vout:        vout,
+		MainTxid:    mainTxid,
+		SubmittedAt: time.Now().Unix(),
+		Pending:     true,
+		FromHeight:  fromHeight,
+	}
+	return store.flush()
+}
+
+// markSent records that the tx of the pending submission reached the fake node.
+func (store *dedupStore) markSent(kind string, txid gethcmn.Hash, vout uint32) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	s, ok := store.submissions[outpointKey(kind, txid, vout)]
+	if !ok {
+		return fmt.Errorf("no %s submission of %s:%d", kind, txid.String(), vout)
+	}
+	s.Pending = false
+	return store.flush()
+}
+
+// remove drops a pending submission whose tx never reached the fake node, so
+// that the UTXO is handled again.
+func (store *dedupStore) remove(kind string, txid gethcmn.Hash, vout uint32) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.submissions, outpointKey(kind, txid, vout))
+	return store.flush()
+}
+
+func (store *dedupStore) pendingList() []submission {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	var list []submission
+	for _, s := range store.submissions {
+		if s.Pending {
+			list = append(list, *s)
+		}
+	}
+	return list
+}
+
+func (store *dedupStore) flush() error {
+	list := make([]*submission, 0, len(store.submissions))
+	for _, s := range store.submissions {
+		list = append(list, s)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temp file first, a crash must not leave a truncated store
+	tmp, err := os.CreateTemp(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), store.path)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := loadDedupStore(path)
+	require.NoError(t, err)
+	txid := gethcmn.HexToHash("0x01")
+	require.NoError(t, store.addPending(submitRedeem, txid, 0, txid.String(), 100))
+	require.True(t, store.has(submitRedeem, txid, 0))
+	require.False(t, store.has(submitConvert, txid, 0))
+
+	// the intent survives a crash before the tx is sent
+	store, err = loadDedupStore(path)
+	require.NoError(t, err)
+	pending := store.pendingList()
+	require.Len(t, pending, 1)
+	require.Equal(t, int64(100), pending[0].FromHeight)
+
+	require.NoError(t, store.markSent(submitRedeem, txid, 0))
+	store, err = loadDedupStore(path)
+	require.NoError(t, err)
+	require.Empty(t, store.pendingList())
+	require.True(t, store.has(submitRedeem, txid, 0))
+
+	require.NoError(t, store.remove(submitRedeem, txid, 0))
+	require.False(t, store.has(submitRedeem, txid, 0))
+	require.Error(t, store.markSent(submitRedeem, txid, 0))
+}
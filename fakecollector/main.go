@@ -1,7 +1,55 @@
 package main
 
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
 func main() {
-	sbchRpcUrl := "http://localhost:8545"
-	operatorUrl := "https://localhost:8801"
-	run(sbchRpcUrl, operatorUrl)
+	var cfg collectorConfig
+	var rpcPubkeyHex, caFile string
+	flag.StringVar(&cfg.sbchRpcUrl, "sbch-url", "http://localhost:8545", "RPC URL of smartbchd")
+	var urls string
+	flag.StringVar(&urls, "operator-urls", "", "comma separated URLs of the operators, in the order of ccInfo, instead of their rpcUrl")
+	flag.StringVar(&defaultOperatorUrl, "operator-url", "https://localhost:8801", "URL of the operators with no rpcUrl in ccInfo nor in -operator-urls")
+	flag.BoolVar(&singleOperator, "single-operator", false, "only ask the operator at -operator-url to sign, for the test chains with one operator")
+	flag.StringVar(&caFile, "operator-ca", "", "PEM file of the CA which signed the operators' certificates")
+	flag.DurationVar(&cfg.interval, "interval", time.Second, "how often the pending UTXOs are polled")
+	flag.BoolVar(&cfg.once, "once", false, "handle the pending UTXOs once then exit, the exit code is 1 if any of them failed")
+	flag.StringVar(&cfg.statePath, "state", "fakecollector_state.json", "file which records the submitted redeem and convert txs")
+	flag.StringVar(&rpcPubkeyHex, "rpc-pubkey", "", "hex pubkey of the smartbchd rpc key, the UtxoInfos must be signed by it")
+	flag.BoolVar(&cfg.mitm, "mitm", false, "flip bytes in the UtxoInfos responses, to test that they are refused")
+	flag.Int64Var(&minerFee, "miner-fee", minerFee, "miner fee of the convert txs in satoshi, must match smartbchd")
+	flag.Parse()
+	operatorUrls = parseOperatorUrls(urls)
+
+	var err error
+	cfg.rpcPubkey, err = hex.DecodeString(rpcPubkeyHex)
+	if err != nil {
+		fmt.Println("invalid rpc pubkey:", err.Error())
+		os.Exit(2)
+	}
+	if err = setupOperatorTLS(caFile); err != nil {
+		fmt.Println("invalid operator CA:", err.Error())
+		os.Exit(2)
+	}
+
+	// on SIGTERM the UTXO in flight is finished and recorded before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	failed, err := run(ctx, cfg)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if cfg.once && failed > 0 {
+		fmt.Printf("%d failures in one-shot mode\n", failed)
+		os.Exit(1)
+	}
 }
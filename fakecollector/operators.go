@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gethcmn "github.com/ethereum/go-ethereum/common"
+	"github.com/smartbch/smartbch/param"
+	"github.com/smartbch/smartbch/rpc/types"
+)
+
+const (
+	operatorTimeout = 3 * time.Second
+	minBackoff      = 2 * time.Second
+	maxBackoff      = 60 * time.Second
+)
+
+var operatorHttpClient = &http.Client{
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+// operatorUrls[i] is the url of the operator i of a signer set, ordered like
+// the operators in ccInfo. defaultOperatorUrl is used for the operators which
+// have neither, one url can sign for one operator only.
+var operatorUrls []string
+var defaultOperatorUrl string
+
+// singleOperator is for the test chains which run only one operator, at
+// defaultOperatorUrl. Its signature is checked against the pubkeys of all
+// the operators and the txs are sent without the scriptSig, which needs
+// param.MinOperatorSigCount signatures.
+var singleOperator bool
+
+func parseOperatorUrls(s string) []string {
+	if s == "" {
+		return nil
+	}
+	urls := strings.Split(s, ",")
+	for i := range urls {
+		urls[i] = strings.TrimSpace(urls[i])
+	}
+	return urls
+}
+
+// setupOperatorTLS makes the operators' certificates checked against the CA
+// in caFile, without it any certificate is accepted.
+func setupOperatorTLS(caFile string) error {
+	if caFile == "" {
+		fmt.Println("no operator CA given, the operators' certificates are not verified")
+		return nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificate found in %s", caFile)
+	}
+	operatorHttpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return nil
+}
+
+func operatorUrl(idx int, operator *types.OperatorInfo) string {
+	if idx < len(operatorUrls) && operatorUrls[idx] != "" {
+		return operatorUrls[idx]
+	}
+	if operator.RpcUrl != "" {
+		return operator.RpcUrl
+	}
+	return defaultOperatorUrl
+}
+
+// operatorState remembers the failures of one operator, so that an operator
+// which is down is not asked again before its backoff expires. The states are
+// keyed by the operators' pubkeys in hex, as the operators falling back to
+// defaultOperatorUrl share their url, and by the url in the single operator
+// mode.
+type operatorState struct {
+	failures  int
+	nextTryAt time.Time
+	lastErr   string
+}
+
+var operatorStates = make(map[string]*operatorState)
+var operatorStatesLock sync.Mutex
+
+func operatorReady(pubkey string) bool {
+	operatorStatesLock.Lock()
+	defer operatorStatesLock.Unlock()
+	state, ok := operatorStates[pubkey]
+	return !ok || !time.Now().Before(state.nextTryAt)
+}
+
+func recordOperatorResult(pubkey string, err error) {
+	operatorStatesLock.Lock()
+	defer operatorStatesLock.Unlock()
+	if err == nil {
+		delete(operatorStates, pubkey)
+		return
+	}
+	state, ok := operatorStates[pubkey]
+	if !ok {
+		state = &operatorState{}
+		operatorStates[pubkey] = state
+	}
+	state.failures++
+	backoff := minBackoff << (state.failures - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	state.nextTryAt = time.Now().Add(backoff)
+	state.lastErr = err.Error()
+}
+
+type sigResult struct {
+	idx int
+	sig []byte
+	err error
+}
+
+// collectSigs asks all the operators to sign the hash concurrently, and
+// returns as soon as param.MinOperatorSigCount valid signatures arrived. The
+// signatures are ordered like the operators, as the covenant script requires.
+func (s *signerSet) collectSigs(hash []byte) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan sigResult, len(s.operators))
+	asked := 0
+	var failures []string
+	for i, operator := range s.operators {
+		url := operatorUrl(i, operator)
+		if url == "" {
+			failures = append(failures, fmt.Sprintf("#%d %s: no rpc url", i, hex.EncodeToString(operator.Pubkey)))
+			continue
+		}
+		if !operatorReady(hex.EncodeToString(operator.Pubkey)) {
+			failures = append(failures, fmt.Sprintf("#%d %s: backing off", i, url))
+			continue
+		}
+		asked++
+		go func(i int, operator *types.OperatorInfo, url string) {
+			sig, err := getSigByHash(ctx, url, hash)
+			if err == nil {
+				err = verifyOperatorSig(operator.Pubkey, hash, sig)
+				if err != nil {
+					err = fmt.Errorf("invalid signature %x: %w", sig, err)
+				}
+			}
+			results <- sigResult{idx: i, sig: sig, err: err}
+		}(i, operator, url)
+	}
+
+	valid := make(map[int][]byte)
+	for n := 0; n < asked && len(valid) < param.MinOperatorSigCount; n++ {
+		r := <-results
+		operator := s.operators[r.idx]
+		url := operatorUrl(r.idx, operator)
+		recordOperatorResult(hex.EncodeToString(operator.Pubkey), r.err)
+		if r.err != nil {
+			failures = append(failures, fmt.Sprintf("#%d %s: %s", r.idx, url, r.err.Error()))
+			continue
+		}
+		valid[r.idx] = r.sig
+	}
+	reportOperatorFailures(hash, failures)
+	if len(valid) < param.MinOperatorSigCount {
+		return nil, fmt.Errorf("only %d of %d operators signed, need %d",
+			len(valid), len(s.operators), param.MinOperatorSigCount)
+	}
+
+	idxs := make([]int, 0, len(valid))
+	for idx := range valid {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	sigs := make([][]byte, 0, param.MinOperatorSigCount)
+	for _, idx := range idxs[:param.MinOperatorSigCount] {
+		sigs = append(sigs, valid[idx])
+	}
+	return sigs, nil
+}
+
+// checkSingleSig asks the operator at defaultOperatorUrl to sign the hash, in
+// the single operator mode.
+func (s *signerSet) checkSingleSig(hash []byte) error {
+	if !operatorReady(defaultOperatorUrl) {
+		return fmt.Errorf("%s: backing off", defaultOperatorUrl)
+	}
+	sig, err := getSigByHash(context.Background(), defaultOperatorUrl, hash)
+	if err == nil {
+		err = fmt.Errorf("invalid signature %x: not signed by any operator", sig)
+		for _, operator := range s.operators {
+			if verifyOperatorSig(operator.Pubkey, hash, sig) == nil {
+				err = nil
+				break
+			}
+		}
+	}
+	recordOperatorResult(defaultOperatorUrl, err)
+	if err != nil {
+		return fmt.Errorf("%s: %w", defaultOperatorUrl, err)
+	}
+	return nil
+}
+
+func reportOperatorFailures(hash []byte, failures []string) {
+	if len(failures) == 0 {
+		return
+	}
+	fmt.Printf("operators failed to sign %s:\n", hex.EncodeToString(hash))
+	for _, f := range failures {
+		fmt.Println("  ", f)
+	}
+}
+
+func getSigByHash(ctx context.Context, operatorUrl string, txSigHash []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, operatorTimeout)
+	defer cancel()
+	fullUrl := operatorUrl + "/sig?hash=" + hex.EncodeToString(txSigHash)
+	fmt.Println("getSigByHash:", fullUrl)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := operatorHttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var respJson OperatorResp
+	err = json.Unmarshal(respBytes, &respJson)
+	if err != nil {
+		return nil, err
+	}
+	if respJson.Error != "" {
+		return nil, errors.New(respJson.Error)
+	}
+
+	return gethcmn.FromHex(respJson.Result), nil
+}
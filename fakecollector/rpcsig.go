@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/smartbch/smartbch/rpc/types"
+)
+
+// the responses smartbchd signs with its rpc key, and the collector relies on
+var signedUtxoMethods = map[string]bool{
+	"sbch_getRedeemingUtxosForOperators":     true,
+	"sbch_getToBeConvertedUtxosForOperators": true,
+}
+
+// verifyUtxoInfos checks the signature smartbchd put into the UtxoInfos, the
+// same way the operators do: sha256 over the json of the infos, signed by the
+// rpc key set with sbch_setRpcKey.
+func verifyUtxoInfos(rpcPubkey []byte, infos *types.UtxoInfos) error {
+	if infos == nil {
+		return errors.New("infos is nil")
+	}
+	if len(infos.Signature) < 64 {
+		return fmt.Errorf("invalid signature length: %d", len(infos.Signature))
+	}
+	bz, err := json.Marshal(infos.Infos)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(bz)
+	if !crypto.VerifySignature(rpcPubkey, hash[:], infos.Signature[:64]) {
+		return errors.New("signature does not match rpc pubkey")
+	}
+	return nil
+}
+
+// tamperTransport stands for a man in the middle between the collector and
+// smartbchd: it flips one byte of every non-empty UtxoInfos response, so that
+// we can see the tampered payloads being rejected.
+type tamperTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tamperTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var call struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(reqBody, &call) != nil || !signedUtxoMethods[call.Method] {
+		return resp, nil
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if tampered, ok := flipTxidByte(respBody); ok {
+		fmt.Printf("mitm: flipped a byte in the response of %s\n", call.Method)
+		respBody = tampered
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	resp.ContentLength = int64(len(respBody))
+	return resp, nil
+}
+
+// flipTxidByte changes the last hex digit of the first txid in the response,
+// which keeps the json valid so only the signature check can catch it.
+func flipTxidByte(body []byte) ([]byte, bool) {
+	key := []byte(`"txid":"0x`)
+	start := bytes.Index(body, key)
+	if start < 0 {
+		return body, false
+	}
+	pos := start + len(key) + 63 // the last of 64 hex digits
+	if pos >= len(body) {
+		return body, false
+	}
+	tampered := append([]byte{}, body...)
+	if tampered[pos] == '0' {
+		tampered[pos] = '1'
+	} else {
+		tampered[pos] = '0'
+	}
+	return tampered, true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/smartbch/smartbch/rpc/types"
+	"github.com/stretchr/testify/require"
+)
+
+func signUtxoInfos(t *testing.T, key *ecdsa.PrivateKey, infos []*types.UtxoInfo) *types.UtxoInfos {
+	bz, err := json.Marshal(infos)
+	require.NoError(t, err)
+	hash := sha256.Sum256(bz)
+	sig, err := crypto.Sign(hash[:], key)
+	require.NoError(t, err)
+	return &types.UtxoInfos{Infos: infos, Signature: sig}
+}
+
+func testUtxoInfos() []*types.UtxoInfo {
+	return []*types.UtxoInfo{{
+		CovenantAddr: common.HexToAddress("0xc0"),
+		Txid:         common.HexToHash("0x1234"),
+		Index:        1,
+		Amount:       100000,
+		TxSigHash:    common.HexToHash("0x5678").Bytes(),
+	}}
+}
+
+func TestVerifyUtxoInfos(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	pubkey := crypto.CompressPubkey(&key.PublicKey)
+	infos := signUtxoInfos(t, key, testUtxoInfos())
+	require.NoError(t, verifyUtxoInfos(pubkey, infos))
+
+	tampered := signUtxoInfos(t, key, testUtxoInfos())
+	tampered.Infos[0].Txid[31] ^= 1
+	require.EqualError(t, verifyUtxoInfos(pubkey, tampered), "signature does not match rpc pubkey")
+
+	otherKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	wrongKey := signUtxoInfos(t, otherKey, testUtxoInfos())
+	require.EqualError(t, verifyUtxoInfos(pubkey, wrongKey), "signature does not match rpc pubkey")
+
+	require.EqualError(t, verifyUtxoInfos(pubkey, &types.UtxoInfos{Infos: testUtxoInfos()}), "invalid signature length: 0")
+	require.EqualError(t, verifyUtxoInfos(pubkey, nil), "infos is nil")
+}
+
+// fakeSbchApi serves the UtxoInfos signed like smartbchd does.
+type fakeSbchApi struct {
+	infos  *types.UtxoInfos
+	pubkey []byte
+}
+
+func (api *fakeSbchApi) GetToBeConvertedUtxosForOperators() *types.UtxoInfos {
+	return api.infos
+}
+
+func (api *fakeSbchApi) GetRpcPubkey() string {
+	return hex.EncodeToString(api.pubkey)
+}
+
+func TestTamperTransport(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	api := &fakeSbchApi{
+		infos:  signUtxoInfos(t, key, testUtxoInfos()),
+		pubkey: crypto.CompressPubkey(&key.PublicKey),
+	}
+	server := gethrpc.NewServer()
+	defer server.Stop()
+	require.NoError(t, server.RegisterName("sbch", api))
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// flips the last hex digit of the txid, and leaves the other methods alone
+	rpcCli, err := gethrpc.DialHTTPWithClient(httpServer.URL, &http.Client{
+		Transport: &tamperTransport{next: http.DefaultTransport},
+	})
+	require.NoError(t, err)
+	defer rpcCli.Close()
+	var infos *types.UtxoInfos
+	require.NoError(t, rpcCli.Call(&infos, "sbch_getToBeConvertedUtxosForOperators"))
+	expected := testUtxoInfos()[0]
+	require.NotEqual(t, expected.Txid, infos.Infos[0].Txid)
+	require.Equal(t, expected.Txid[:31], infos.Infos[0].Txid[:31])
+	require.Equal(t, expected.Txid[31]&0xf0, infos.Infos[0].Txid[31]&0xf0)
+	infos.Infos[0].Txid = expected.Txid
+	require.Equal(t, api.infos, infos)
+	var pubkeyHex string
+	require.NoError(t, rpcCli.Call(&pubkeyHex, "sbch_getRpcPubkey"))
+	require.Equal(t, hex.EncodeToString(api.pubkey), pubkeyHex)
+
+	cli, err := NewSbchClient(httpServer.URL, api.pubkey, false)
+	require.NoError(t, err)
+	infos, err = cli.GetToBeConvertedUtxosForOperators()
+	require.NoError(t, err)
+	require.Equal(t, api.infos, infos)
+
+	cli, err = NewSbchClient(httpServer.URL, api.pubkey, true)
+	require.NoError(t, err)
+	_, err = cli.GetToBeConvertedUtxosForOperators()
+	require.EqualError(t, err, "refused response of sbch_getToBeConvertedUtxosForOperators: signature does not match rpc pubkey")
+}
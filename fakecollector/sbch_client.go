@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
 	"time"
 
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/smartbch/smartbch/rpc/client"
 	"github.com/smartbch/smartbch/rpc/types"
 )
@@ -11,19 +15,34 @@ import (
 const getTimeout = time.Second * 15
 
 type SbchClient struct {
-	url string
-	cli *client.Client
+	url       string
+	cli       *client.Client
+	rpcCli    *gethrpc.Client
+	rpcPubkey []byte
 }
 
-func NewSbchClient(rpcUrl string) (*SbchClient, error) {
-	rpcCli, err := client.Dial(rpcUrl)
+// NewSbchClient connects to smartbchd. The UtxoInfos are checked against
+// rpcPubkey, if it is empty the key reported by smartbchd itself is trusted.
+// In mitm mode the UtxoInfos responses are tampered on their way back.
+func NewSbchClient(rpcUrl string, rpcPubkey []byte, mitm bool) (*SbchClient, error) {
+	httpClient := &http.Client{Timeout: getTimeout}
+	if mitm {
+		httpClient.Transport = &tamperTransport{next: http.DefaultTransport}
+	}
+	rpcCli, err := gethrpc.DialHTTPWithClient(rpcUrl, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := client.DialHTTPWithClient(rpcUrl, httpClient)
 	if err != nil {
 		return nil, err
 	}
 
 	return &SbchClient{
-		url: rpcUrl,
-		cli: rpcCli,
+		url:       rpcUrl,
+		cli:       cli,
+		rpcCli:    rpcCli,
+		rpcPubkey: rpcPubkey,
 	}, nil
 }
 
@@ -32,21 +51,56 @@ func (s *SbchClient) GetCcInfo() (*types.CcInfo, error) {
 }
 
 func (s *SbchClient) GetRedeemingUtxosForOperators() (utxos *types.UtxoInfos, err error) {
-	return s.cli.RedeemingUtxosForOperators(context.Background())
+	return s.getSignedUtxoInfos("sbch_getRedeemingUtxosForOperators")
 }
 
 func (s *SbchClient) GetToBeConvertedUtxosForOperators() (utxos *types.UtxoInfos, err error) {
-	return s.cli.ToBeConvertedUtxosForOperators(context.Background())
+	return s.getSignedUtxoInfos("sbch_getToBeConvertedUtxosForOperators")
+}
+
+// getSignedUtxoInfos calls smartbchd directly instead of through the smartBCH
+// client, which verifies with whatever key the node reports, and refuses the
+// response unless it is signed by the pinned rpc key.
+func (s *SbchClient) getSignedUtxoInfos(method string) (*types.UtxoInfos, error) {
+	pubkey, err := s.getRpcPubkey()
+	if err != nil {
+		return nil, err
+	}
+	var utxos *types.UtxoInfos
+	if err = s.rpcCli.CallContext(context.Background(), &utxos, method); err != nil {
+		return nil, err
+	}
+	if err = verifyUtxoInfos(pubkey, utxos); err != nil {
+		return nil, fmt.Errorf("refused response of %s: %w", method, err)
+	}
+	return utxos, nil
+}
+
+func (s *SbchClient) getRpcPubkey() ([]byte, error) {
+	if len(s.rpcPubkey) != 0 {
+		return s.rpcPubkey, nil
+	}
+	var pubkeyHex string
+	if err := s.rpcCli.CallContext(context.Background(), &pubkeyHex, "sbch_getRpcPubkey"); err != nil {
+		return nil, err
+	}
+	pubkey, err := hex.DecodeString(pubkeyHex)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("no rpc pubkey given, trust the one from smartbchd:", pubkeyHex)
+	s.rpcPubkey = pubkey
+	return pubkey, nil
 }
 
-func getOperatorPubkeys(operators []OperatorInfo) [][]byte {
+func getOperatorPubkeys(operators []*types.OperatorInfo) [][]byte {
 	pubkeys := make([][]byte, len(operators))
 	for i, operator := range operators {
 		pubkeys[i] = operator.Pubkey
 	}
 	return pubkeys
 }
-func getMonitorPubkeys(monitors []MonitorInfo) [][]byte {
+func getMonitorPubkeys(monitors []*types.MonitorInfo) [][]byte {
 	pubkeys := make([][]byte, len(monitors))
 	for i, monitor := range monitors {
 		pubkeys[i] = monitor.Pubkey
@@ -1,23 +1,5 @@
 package main
 
-import (
-	gethcmn "github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-)
-
-type OperatorInfo struct {
-	Address gethcmn.Address `json:"address"`
-	Pubkey  hexutil.Bytes   `json:"pubkey"`
-	RpcUrl  string          `json:"rpc_url"`
-	Intro   string          `json:"intro"`
-}
-
-type MonitorInfo struct {
-	Address gethcmn.Address `json:"address"`
-	Pubkey  hexutil.Bytes   `json:"pubkey"`
-	Intro   string          `json:"intro"`
-}
-
 //
 //type CcInfo struct {
 //	Operators           []OperatorInfo `json:"operators"`
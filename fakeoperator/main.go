@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fakeoperator serves the HTTP API of cc-operator for n operators, operator i
+// listens on the port of -listen plus i.
+func main() {
+	var listen, keysFile, seed, faults, tlsCert, tlsKey string
+	var n int
+	var delay time.Duration
+	flag.StringVar(&listen, "listen", "127.0.0.1:8801", "address of operator #0, the others use the following ports")
+	flag.IntVar(&n, "n", 10, "number of operators, ignored if -keys is given")
+	flag.StringVar(&keysFile, "keys", "", "file with one hex private key per line, one operator per key")
+	flag.StringVar(&seed, "seed", "fakeoperator", "the private keys are derived from it when -keys is not given")
+	flag.StringVar(&faults, "faults", "", "faults injected from start, like 3=wrong-sig,5=delay,7=error")
+	flag.DurationVar(&delay, "delay", 5*time.Second, "how long the operators in the delay mode wait")
+	flag.StringVar(&tlsCert, "tls-cert", "", "serve https with this certificate")
+	flag.StringVar(&tlsKey, "tls-key", "", "private key of -tls-cert")
+	flag.Parse()
+
+	keys, err := loadKeys(keysFile, seed, n)
+	if err != nil {
+		fmt.Println("failed to load keys:", err.Error())
+		os.Exit(2)
+	}
+	faultOf, err := parseFaults(faults)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+	host, portStr, err := net.SplitHostPort(listen)
+	if err != nil {
+		fmt.Println("invalid listen address:", err.Error())
+		os.Exit(2)
+	}
+	basePort, err := strconv.Atoi(portStr)
+	if err != nil {
+		fmt.Println("invalid listen port:", err.Error())
+		os.Exit(2)
+	}
+	scheme := "http"
+	if tlsCert != "" {
+		scheme = "https"
+	}
+
+	operators := make([]*operator, len(keys))
+	for i, key := range keys {
+		addr := net.JoinHostPort(host, strconv.Itoa(basePort+i))
+		operators[i] = newOperator(i, scheme+"://"+addr, key)
+		if fault, ok := faultOf[i]; ok {
+			if err = operators[i].setFault(fault, delay); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(2)
+			}
+		}
+	}
+
+	servers := make([]*http.Server, len(operators))
+	for i, op := range operators {
+		info := op.info()
+		fmt.Printf("operator #%d: %s %s\n", i, info.RpcUrl, info.Pubkey)
+		servers[i] = &http.Server{
+			Addr:    strings.TrimPrefix(info.RpcUrl, scheme+"://"),
+			Handler: op.router(operators),
+		}
+		go func(srv *http.Server) {
+			var err error
+			if tlsCert != "" {
+				err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Println("operator server failed:", err.Error())
+				os.Exit(1)
+			}
+		}(servers[i])
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		_ = srv.Shutdown(shutdownCtx)
+	}
+	fmt.Println("fakeoperator stopped")
+}
+
+func loadKeys(keysFile, seed string, n int) ([][]byte, error) {
+	var keys [][]byte
+	if keysFile == "" {
+		for i := 0; i < n; i++ {
+			key := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", seed, i)))
+			keys = append(keys, key[:])
+		}
+		return keys, nil
+	}
+	data, err := os.ReadFile(keysFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "0x")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := hex.DecodeString(line)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid private key in %s", keysFile)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no private key in %s", keysFile)
+	}
+	return keys, nil
+}
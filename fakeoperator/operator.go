@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gcash/bchd/bchec"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gorilla/mux"
+)
+
+const (
+	faultNone     = "none"
+	faultWrongSig = "wrong-sig"
+	faultDelay    = "delay"
+	faultError    = "error"
+)
+
+// the same hash type the covenant script checks
+const sigHashType = txscript.SigHashAll | txscript.SigHashForkID
+
+// OperatorResp is what cc-operator returns for every request.
+type OperatorResp struct {
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+}
+
+type OperatorInfo struct {
+	Index     int    `json:"index"`
+	Pubkey    string `json:"pubkey"`
+	RpcUrl    string `json:"rpcUrl"`
+	Fault     string `json:"fault"`
+	Delay     string `json:"delay,omitempty"`
+	Rotations int    `json:"rotations"`
+}
+
+// operator signs txSigHashes like one cc-operator, unless a fault is injected.
+type operator struct {
+	index  int
+	rpcUrl string
+
+	lock      sync.Mutex
+	key       *bchec.PrivateKey
+	rotations int
+	fault     string
+	delay     time.Duration
+}
+
+func newOperator(index int, rpcUrl string, keyBytes []byte) *operator {
+	key, _ := bchec.PrivKeyFromBytes(bchec.S256(), keyBytes)
+	return &operator{index: index, rpcUrl: rpcUrl, key: key, fault: faultNone}
+}
+
+func (op *operator) info() OperatorInfo {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+	info := OperatorInfo{
+		Index:     op.index,
+		Pubkey:    hex.EncodeToString(op.key.PubKey().SerializeCompressed()),
+		RpcUrl:    op.rpcUrl,
+		Fault:     op.fault,
+		Rotations: op.rotations,
+	}
+	if op.fault == faultDelay {
+		info.Delay = op.delay.String()
+	}
+	return info
+}
+
+func (op *operator) setFault(fault string, delay time.Duration) error {
+	switch fault {
+	case faultNone, faultWrongSig, faultDelay, faultError:
+	default:
+		return fmt.Errorf("unknown fault: %s", fault)
+	}
+	op.lock.Lock()
+	defer op.lock.Unlock()
+	op.fault = fault
+	op.delay = delay
+	fmt.Printf("operator #%d: fault %s %s\n", op.index, fault, delay)
+	return nil
+}
+
+// rotate replaces the key with one derived from it, the chain still knows the
+// old pubkey so the signatures made afterwards are not accepted.
+func (op *operator) rotate() {
+	op.lock.Lock()
+	defer op.lock.Unlock()
+	next := sha256.Sum256(append(op.key.Serialize(), "rotate"...))
+	op.key, _ = bchec.PrivKeyFromBytes(bchec.S256(), next[:])
+	op.rotations++
+	fmt.Printf("operator #%d: rotated key to %x\n", op.index, op.key.PubKey().SerializeCompressed())
+}
+
+func (op *operator) sign(hash []byte) ([]byte, error) {
+	op.lock.Lock()
+	key, fault, delay := op.key, op.fault, op.delay
+	op.lock.Unlock()
+
+	switch fault {
+	case faultError:
+		return nil, errors.New("injected fault")
+	case faultDelay:
+		time.Sleep(delay)
+	case faultWrongSig:
+		wrong := sha256.Sum256(hash)
+		hash = wrong[:]
+	}
+	sig, err := key.SignECDSA(hash)
+	if err != nil {
+		return nil, err
+	}
+	return append(sig.Serialize(), byte(sigHashType)), nil
+}
+
+func (op *operator) router(all []*operator) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/pubkey", func(w http.ResponseWriter, _ *http.Request) {
+		writeResult(w, op.info().Pubkey)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/info", func(w http.ResponseWriter, _ *http.Request) {
+		writeResult(w, op.info())
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/pubkeys", func(w http.ResponseWriter, _ *http.Request) {
+		infos := make([]OperatorInfo, len(all))
+		for i, o := range all {
+			infos[i] = o.info()
+		}
+		writeResult(w, infos)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/sig", op.handleSig).Methods(http.MethodGet)
+	r.HandleFunc("/fault", op.handleFault).Methods(http.MethodPost)
+	r.HandleFunc("/rotate", func(w http.ResponseWriter, _ *http.Request) {
+		op.rotate()
+		writeResult(w, op.info())
+	}).Methods(http.MethodPost)
+	return r
+}
+
+func (op *operator) handleSig(w http.ResponseWriter, r *http.Request) {
+	hash, err := hex.DecodeString(r.URL.Query().Get("hash"))
+	if err != nil || len(hash) != 32 {
+		writeError(w, http.StatusBadRequest, "invalid hash")
+		return
+	}
+	sig, err := op.sign(hash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeResult(w, hex.EncodeToString(sig))
+}
+
+// handleFault takes mode=none|wrong-sig|delay|error, and delay for the delay mode
+func (op *operator) handleFault(w http.ResponseWriter, r *http.Request) {
+	var delay time.Duration
+	if s := r.URL.Query().Get("delay"); s != "" {
+		var err error
+		if delay, err = time.ParseDuration(s); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid delay: "+err.Error())
+			return
+		}
+	}
+	if err := op.setFault(r.URL.Query().Get("mode"), delay); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeResult(w, op.info())
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	writeResp(w, http.StatusOK, OperatorResp{Success: true, Result: result})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeResp(w, status, OperatorResp{Error: msg})
+}
+
+func writeResp(w http.ResponseWriter, status int, resp OperatorResp) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseFaults parses "3=wrong-sig,5=delay" into operator index => fault.
+func parseFaults(s string) (map[int]string, error) {
+	faults := make(map[int]string)
+	if s == "" {
+		return faults, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		idx, fault, _ := strings.Cut(strings.TrimSpace(item), "=")
+		n, err := strconv.Atoi(idx)
+		if err != nil || fault == "" {
+			return nil, fmt.Errorf("invalid fault %q, want index=mode", item)
+		}
+		faults[n] = fault
+	}
+	return faults, nil
+}
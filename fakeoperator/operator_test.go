@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gcash/bchd/bchec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaults(t *testing.T) {
+	keyBytes := sha256.Sum256([]byte("operator"))
+	op := newOperator(0, "", keyBytes[:])
+	server := httptest.NewServer(op.router([]*operator{op}))
+	defer server.Close()
+	pubkey := op.key.PubKey()
+
+	call := func(method, path string) (int, OperatorResp) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var opResp OperatorResp
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&opResp))
+		return resp.StatusCode, opResp
+	}
+	hash := sha256.Sum256([]byte("tx"))
+	// sigValid asks for a signature and checks it against the pubkey
+	sigValid := func() bool {
+		status, resp := call(http.MethodGet, "/sig?hash="+hex.EncodeToString(hash[:]))
+		require.Equal(t, http.StatusOK, status)
+		sig, err := hex.DecodeString(resp.Result.(string))
+		require.NoError(t, err)
+		require.Equal(t, byte(sigHashType), sig[len(sig)-1])
+		parsed, err := bchec.ParseDERSignature(sig[:len(sig)-1], bchec.S256())
+		require.NoError(t, err)
+		return parsed.Verify(hash[:], pubkey)
+	}
+	setFault := func(query string) {
+		status, resp := call(http.MethodPost, "/fault?"+query)
+		require.Equal(t, http.StatusOK, status, resp.Error)
+	}
+
+	require.True(t, sigValid())
+	setFault("mode=wrong-sig")
+	require.False(t, sigValid())
+
+	setFault("mode=error")
+	status, resp := call(http.MethodGet, "/sig?hash="+hex.EncodeToString(hash[:]))
+	require.Equal(t, http.StatusInternalServerError, status)
+	require.Equal(t, "injected fault", resp.Error)
+
+	setFault("mode=delay&delay=100ms")
+	require.Equal(t, "100ms", op.info().Delay)
+	start := time.Now()
+	require.True(t, sigValid())
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	setFault("mode=none")
+	require.True(t, sigValid())
+
+	status, resp = call(http.MethodPost, "/fault?mode=crash")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Equal(t, "unknown fault: crash", resp.Error)
+	status, _ = call(http.MethodPost, "/fault?mode=delay&delay=soon")
+	require.Equal(t, http.StatusBadRequest, status)
+	status, _ = call(http.MethodGet, "/sig?hash=1234")
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestParseFaults(t *testing.T) {
+	faults, err := parseFaults("3=wrong-sig, 5=delay")
+	require.NoError(t, err)
+	require.Equal(t, map[int]string{3: faultWrongSig, 5: faultDelay}, faults)
+	_, err = parseFaults("3")
+	require.EqualError(t, err, `invalid fault "3", want index=mode`)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	formatJSONL    = "jsonl"
+	formatCSV      = "csv"
+	formatColumnar = "columnar"
+)
+
+var changeColumns = []string{"address", "kind", "key", "oldValue", "newValue", "height"}
+
+// stateChange is a change of a nonce, balance, bytecode or storage slot at
+// height. The values are formatted as expectedState does, OldValue is empty
+// when there is no record before the change.
+type stateChange struct {
+	Address  common.Address `json:"address"`
+	Kind     string         `json:"kind"`
+	Key      string         `json:"key,omitempty"` // storage key in hex
+	OldValue string         `json:"oldValue"`
+	NewValue string         `json:"newValue"`
+	Height   uint64         `json:"height"`
+}
+
+func (c stateChange) row() []string {
+	return []string{hexutil.Encode(c.Address[:]), c.Kind, c.Key, c.OldValue, c.NewValue, strconv.FormatUint(c.Height, 10)}
+}
+
+// changeWriter writes the changes in one of the export formats.
+type changeWriter interface {
+	write(c stateChange) error
+	close() error
+}
+
+// newChangeWriter creates output, which is a directory for the columnar
+// format and a file for the others.
+func newChangeWriter(format, output string) (changeWriter, error) {
+	switch format {
+	case formatJSONL:
+		f, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		w := bufio.NewWriter(f)
+		return &jsonlWriter{f: f, w: w, enc: json.NewEncoder(w)}, nil
+	case formatCSV:
+		f, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		w := csv.NewWriter(f)
+		if err = w.Write(changeColumns); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &csvWriter{f: f, w: w}, nil
+	case formatColumnar:
+		return newColumnarWriter(output)
+	}
+	return nil, fmt.Errorf("unknown format %q, it must be %s, %s or %s", format, formatJSONL, formatCSV, formatColumnar)
+}
+
+type jsonlWriter struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) write(c stateChange) error {
+	return w.enc.Encode(c)
+}
+
+func (w *jsonlWriter) close() error {
+	err := w.w.Flush()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type csvWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func (w *csvWriter) write(c stateChange) error {
+	return w.w.Write(c.row())
+}
+
+func (w *csvWriter) close() error {
+	w.w.Flush()
+	err := w.w.Error()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// columnarWriter writes every column into a file of its own in a directory,
+// the value of the n-th row is on the n-th line of each file. columns.json
+// lists the columns and the number of rows.
+type columnarWriter struct {
+	dir   string
+	files []*os.File
+	ws    []*bufio.Writer
+	rows  int
+}
+
+type columnarMeta struct {
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+func newColumnarWriter(dir string) (*columnarWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &columnarWriter{dir: dir}
+	for _, col := range changeColumns {
+		f, err := os.Create(filepath.Join(dir, col+".col"))
+		if err != nil {
+			for _, f := range w.files {
+				f.Close()
+			}
+			return nil, err
+		}
+		w.files = append(w.files, f)
+		w.ws = append(w.ws, bufio.NewWriter(f))
+	}
+	return w, nil
+}
+
+func (w *columnarWriter) write(c stateChange) error {
+	for i, v := range c.row() {
+		if _, err := w.ws[i].WriteString(v + "\n"); err != nil {
+			return err
+		}
+	}
+	w.rows++
+	return nil
+}
+
+func (w *columnarWriter) close() error {
+	var err error
+	for i, f := range w.files {
+		if flushErr := w.ws[i].Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	bz, err := json.Marshal(columnarMeta{Columns: changeColumns, Rows: w.rows})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.dir, "columns.json"), bz, 0644)
+}
+
+// exportChanges writes the changes in [r.start, r.end] of the records passing
+// f, r.end is lowered to the last height of the history db. The changes of a
+// key are written in the order of height. It returns the number of changes.
+func exportChanges(hisdbDir string, r heightRange, f recordFilter, w changeWriter) (int, error) {
+	hisDb, err := NewHisDb(hisdbDir)
+	if err != nil {
+		return 0, err
+	}
+	defer hisDb.Close()
+	last, ok := hisDb.LastHeight()
+	if !ok {
+		return 0, fmt.Errorf("the history db is empty")
+	}
+	if r.end > last {
+		r.end = last
+	}
+	latest := last + 1
+
+	stopRecords := make(chan struct{})
+	recChan := f.records(hisDb, latest, stopRecords)
+	defer func() {
+		// let GenerateRecords stop when we return early, and wait for it
+		close(stopRecords)
+		for range recChan {
+		}
+	}()
+	n := 0
+	write := func(old *HistoricalRecord, rec HistoricalRecord) error {
+		if rec.StartHeight < r.start || rec.StartHeight > r.end {
+			return nil
+		}
+		for _, c := range recordChanges(old, rec) {
+			if err := w.write(c); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	}
+	var prev *HistoricalRecord
+	// writeCleared writes the clearing of prev before next, if prev is cleared
+	writeCleared := func(next uint64) error {
+		cleared := clearedRecord(*prev, next)
+		if cleared == nil {
+			return nil
+		}
+		err := write(prev, *cleared)
+		prev = cleared
+		return err
+	}
+	for rec := range recChan {
+		if !f.match(rec) {
+			continue
+		}
+		if prev != nil {
+			sameKey := prev.Addr == rec.Addr && prev.Key == rec.Key
+			next := rec.StartHeight
+			if !sameKey {
+				next = latest
+			}
+			if err = writeCleared(next); err != nil {
+				return n, err
+			}
+			if !sameKey {
+				prev = nil
+			}
+		}
+		if err = write(prev, rec); err != nil {
+			return n, err
+		}
+		rec := rec
+		prev = &rec
+	}
+	if prev != nil {
+		if err = writeCleared(latest); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// clearedRecord returns the record of a storage slot cleared by a
+// self-destruct at rec.EndHeight, which is before next, the start of the
+// record after rec or the latest height. The clearing has no record in the
+// history db.
+func clearedRecord(rec HistoricalRecord, next uint64) *HistoricalRecord {
+	if len(rec.Key) != 32 || rec.EndHeight >= next {
+		return nil
+	}
+	return &HistoricalRecord{Addr: rec.Addr, Key: rec.Key, StartHeight: rec.EndHeight, EndHeight: next}
+}
+
+// recordChanges returns the changes from old, which is nil if rec is the
+// first record of its key, to rec. The nonce and the balance of an account
+// are changed separately, and the values which are not changed are skipped.
+func recordChanges(old *HistoricalRecord, rec HistoricalRecord) []stateChange {
+	var kinds []string
+	var key string
+	switch {
+	case rec.Key == "account":
+		kinds = []string{kindNonce, kindBalance}
+	case rec.Key == "bytecode":
+		kinds = []string{kindBytecode}
+	default:
+		kinds = []string{kindStorage}
+		key = hexutil.Encode([]byte(rec.Key))
+	}
+	changes := make([]stateChange, 0, len(kinds))
+	for _, kind := range kinds {
+		c := stateChange{
+			Address:  rec.Addr,
+			Kind:     kind,
+			Key:      key,
+			NewValue: expectedState(rec, kind),
+			Height:   rec.StartHeight,
+		}
+		if old != nil {
+			c.OldValue = expectedState(*old, kind)
+			if c.OldValue == c.NewValue {
+				continue
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+type bufferWriter struct {
+	changes []stateChange
+}
+
+func (w *bufferWriter) write(c stateChange) error {
+	w.changes = append(w.changes, c)
+	return nil
+}
+
+func (w *bufferWriter) close() error {
+	return nil
+}
+
+func TestExportChanges(t *testing.T) {
+	eoa := common.HexToAddress("0xe0a")
+	contract := common.HexToAddress("0xc0de")
+	slot := common.HexToHash("0x01")
+	value := func(b byte) []byte { return common.LeftPadBytes([]byte{b}, 32) }
+	code := func(b byte) []byte { return append(make([]byte, 33), b) }
+	hisdbDir := t.TempDir()
+	hisDb, err := NewHisDb(hisdbDir)
+	require.NoError(t, err)
+	hisDb.BeginWrite()
+	for _, w := range []struct {
+		height  uint64
+		rwLists *types.ReadWriteLists
+	}{
+		{1, &types.ReadWriteLists{AccountWList: []types.AccountRWOp{{Addr: eoa, Account: newAccount(1, 1, 100)}}}},
+		{2, &types.ReadWriteLists{
+			AccountWList:  []types.AccountRWOp{{Addr: contract, Account: newAccount(2, 1, 0)}},
+			BytecodeWList: []types.BytecodeRWOp{{Addr: contract, Bytecode: code(1)}},
+			StorageWList:  []types.StorageRWOp{{Seq: 2, Key: string(slot[:]), Value: value(1)}},
+		}},
+		{3, &types.ReadWriteLists{
+			AccountWList: []types.AccountRWOp{{Addr: eoa, Account: newAccount(1, 2, 90)}, {Addr: contract, Account: newAccount(2, 1, 10)}},
+			StorageWList: []types.StorageRWOp{{Seq: 2, Key: string(slot[:]), Value: value(2)}},
+		}},
+		{5, &types.ReadWriteLists{AccountWList: []types.AccountRWOp{{Addr: contract, Account: []byte{}}}}},
+		{7, &types.ReadWriteLists{
+			AccountWList:  []types.AccountRWOp{{Addr: contract, Account: newAccount(3, 1, 0)}},
+			BytecodeWList: []types.BytecodeRWOp{{Addr: contract, Bytecode: code(2)}},
+			StorageWList:  []types.StorageRWOp{{Seq: 3, Key: string(slot[:]), Value: value(3)}},
+		}},
+	} {
+		require.NoError(t, hisDb.AddRwLists(w.height, w.rwLists))
+	}
+	hisDb.setLastHeight(7)
+	hisDb.EndWrite()
+	hisDb.Close()
+
+	hexValue := func(b byte) string { return hexutil.Encode(value(b)) }
+	zero := hexValue(0)
+	change := func(addr common.Address, kind, key, old, new string, height uint64) stateChange {
+		return stateChange{Address: addr, Kind: kind, Key: key, OldValue: old, NewValue: new, Height: height}
+	}
+	key := slot.Hex()
+	w := &bufferWriter{}
+	n, err := exportChanges(hisdbDir, heightRange{start: 1, end: 100}, recordFilter{}, w)
+	require.NoError(t, err)
+	require.Equal(t, []stateChange{
+		change(eoa, kindNonce, "", "", "1", 1),
+		change(eoa, kindBalance, "", "", "100", 1),
+		change(eoa, kindNonce, "", "1", "2", 3),
+		change(eoa, kindBalance, "", "100", "90", 3),
+		change(contract, kindNonce, "", "", "1", 2),
+		change(contract, kindBalance, "", "", "0", 2),
+		change(contract, kindBalance, "", "0", "10", 3),
+		change(contract, kindNonce, "", "1", "0", 5),
+		change(contract, kindBalance, "", "10", "0", 5),
+		change(contract, kindNonce, "", "0", "1", 7),
+		change(contract, kindBytecode, "", "", "0x01", 2),
+		change(contract, kindBytecode, "", "0x01", "0x", 5),
+		change(contract, kindBytecode, "", "0x", "0x02", 7),
+		change(contract, kindStorage, key, "", hexValue(1), 2),
+		change(contract, kindStorage, key, hexValue(1), hexValue(2), 3),
+		// cleared by the self-destruct
+		change(contract, kindStorage, key, hexValue(2), zero, 5),
+		change(contract, kindStorage, key, zero, hexValue(3), 7),
+	}, w.changes)
+	require.Equal(t, len(w.changes), n)
+
+	// the changes before the range are not written but still give the old values
+	w = &bufferWriter{}
+	f, err := newRecordFilter([]string{contract.Hex()}, "", 100, 0)
+	require.NoError(t, err)
+	_, err = exportChanges(hisdbDir, heightRange{start: 4, end: 6}, f, w)
+	require.NoError(t, err)
+	require.Equal(t, []stateChange{
+		change(contract, kindNonce, "", "1", "0", 5),
+		change(contract, kindBalance, "", "10", "0", 5),
+		change(contract, kindBytecode, "", "0x01", "0x", 5),
+		change(contract, kindStorage, key, hexValue(2), zero, 5),
+	}, w.changes)
+
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "changes.csv")
+	cw, err := newChangeWriter(formatCSV, csvFile)
+	require.NoError(t, err)
+	f.keyPrefix = []byte{0x00}
+	_, err = exportChanges(hisdbDir, heightRange{start: 6, end: 7}, f, cw)
+	require.NoError(t, err)
+	require.NoError(t, cw.close())
+	bz, err := os.ReadFile(csvFile)
+	require.NoError(t, err)
+	require.Equal(t, "address,kind,key,oldValue,newValue,height\n"+
+		"0x000000000000000000000000000000000000c0de,storage,"+key+","+zero+","+hexValue(3)+",7\n", string(bz))
+
+	colDir := filepath.Join(dir, "changes")
+	cw, err = newChangeWriter(formatColumnar, colDir)
+	require.NoError(t, err)
+	n, err = exportChanges(hisdbDir, heightRange{start: 1, end: 100}, recordFilter{}, cw)
+	require.NoError(t, err)
+	require.NoError(t, cw.close())
+	var meta columnarMeta
+	bz, err = os.ReadFile(filepath.Join(colDir, "columns.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(bz, &meta))
+	require.Equal(t, columnarMeta{Columns: changeColumns, Rows: n}, meta)
+	bz, err = os.ReadFile(filepath.Join(colDir, "height.col"))
+	require.NoError(t, err)
+	require.Equal(t, n, bytes.Count(bz, []byte("\n")))
+	require.True(t, bytes.HasPrefix(bz, []byte("1\n1\n3\n3\n2\n")))
+
+	_, err = newChangeWriter("parquet", filepath.Join(dir, "x"))
+	require.EqualError(t, err, `unknown format "parquet", it must be jsonl, csv or columnar`)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// recordFilter selects the records to test.
+type recordFilter struct {
+	addrs     [][20]byte // empty for all the addresses
+	keyPrefix []byte     // only test the storage records with the key prefix
+	sample    float64    // percent of the records to test
+	seed      int64      // seed of the sample
+
+	skipStaking bool // skip the storage records of the staking contract
+}
+
+func newRecordFilter(addrs []string, keyPrefix string, sample float64, seed int64) (recordFilter, error) {
+	f := recordFilter{sample: sample, seed: seed}
+	for _, addr := range addrs {
+		if !common.IsHexAddress(addr) {
+			return f, fmt.Errorf("invalid address %q", addr)
+		}
+		f.addrs = append(f.addrs, common.HexToAddress(addr))
+	}
+	if keyPrefix != "" {
+		if !strings.HasPrefix(keyPrefix, "0x") {
+			keyPrefix = "0x" + keyPrefix
+		}
+		var err error
+		f.keyPrefix, err = hexutil.Decode(keyPrefix)
+		if err != nil {
+			return f, fmt.Errorf("invalid key prefix %q: %w", keyPrefix, err)
+		}
+		if len(f.keyPrefix) > 32 {
+			return f, fmt.Errorf("key prefix %q is longer than 32 bytes", keyPrefix)
+		}
+	}
+	if sample <= 0 || sample > 100 {
+		return f, fmt.Errorf("sample %v%% is not in (0, 100]", sample)
+	}
+	return f, nil
+}
+
+// records generates the records of the addresses in hisDb, or all the
+// records if there are no addresses. The generation stops when done is
+// closed.
+func (f recordFilter) records(hisDb *HistoryDb, latestHeight uint64, done <-chan struct{}) chan HistoricalRecord {
+	recChan := make(chan HistoricalRecord, 100)
+	if len(f.addrs) != 0 {
+		go hisDb.GenerateRecordsOf(recChan, latestHeight, f.addrs, f.keyPrefix, done)
+	} else {
+		go hisDb.GenerateRecords(recChan, latestHeight, done)
+	}
+	return recChan
+}
+
+// match checks the key prefix and takes the sample. A record is sampled by
+// the hash of the seed and the record, so the same records are sampled for
+// the same seed whatever the other filters are.
+func (f recordFilter) match(rec HistoricalRecord) bool {
+	if len(f.keyPrefix) != 0 && (len(rec.Key) != 32 || !bytes.HasPrefix([]byte(rec.Key), f.keyPrefix)) {
+		return false
+	}
+	if f.skipStaking && len(rec.Key) == 32 && rec.Addr == stakingContractAddr {
+		return false
+	}
+	if f.sample == 0 || f.sample >= 100 {
+		return true
+	}
+	var buf [8]byte
+	h := sha256.New()
+	binary.BigEndian.PutUint64(buf[:], uint64(f.seed))
+	h.Write(buf[:])
+	h.Write(rec.Addr[:])
+	h.Write([]byte(rec.Key))
+	binary.BigEndian.PutUint64(buf[:], rec.StartHeight)
+	h.Write(buf[:])
+	v := binary.BigEndian.Uint64(h.Sum(nil))
+	return float64(v) < f.sample/100*math.MaxUint64
+}
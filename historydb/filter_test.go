@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func collectRecords(recChan chan HistoricalRecord, f recordFilter) (recs []HistoricalRecord) {
+	for rec := range recChan {
+		if f.match(rec) {
+			recs = append(recs, rec)
+		}
+	}
+	return
+}
+
+func TestRecordFilter(t *testing.T) {
+	addrs := []common.Address{common.HexToAddress("0xa1"), common.HexToAddress("0xa2"), common.HexToAddress("0xa3")}
+	keys := []common.Hash{{0x01}, {0xaa, 0x01}, {0xab, 0x01}}
+	hisDb, err := NewHisDb(t.TempDir())
+	require.NoError(t, err)
+	defer hisDb.Close()
+	for h := uint64(1); h <= 4; h++ {
+		rwLists := &types.ReadWriteLists{}
+		for i, addr := range addrs {
+			rwLists.AccountWList = append(rwLists.AccountWList, types.AccountRWOp{Addr: addr, Account: newAccount(uint64(i+1), h, 0)})
+			for _, key := range keys {
+				rwLists.StorageWList = append(rwLists.StorageWList, types.StorageRWOp{Seq: uint64(i + 1), Key: string(key[:]), Value: []byte{byte(h)}})
+			}
+		}
+		require.NoError(t, hisDb.AddRwLists(h, rwLists))
+	}
+
+	all := collectRecords(recordsOf(hisDb), recordFilter{})
+	require.Len(t, all, 3*4+3*3*4)
+
+	// the same records as the full scan, with the same end heights
+	targeted := collectRecords(recordsOf(hisDb, addrs[2], addrs[0]), recordFilter{})
+	var expected []HistoricalRecord
+	for _, rec := range all {
+		if rec.Addr != addrs[1] {
+			expected = append(expected, rec)
+		}
+	}
+	require.Equal(t, expected, targeted)
+
+	f, err := newRecordFilter([]string{addrs[1].String()}, "aa", 100, 1)
+	require.NoError(t, err)
+	recs := collectRecords(f.records(hisDb, 5, nil), f)
+	require.Len(t, recs, 4)
+	for _, rec := range recs {
+		require.Equal(t, addrs[1], common.Address(rec.Addr))
+		require.Equal(t, keys[1], common.BytesToHash([]byte(rec.Key)))
+	}
+	// the key prefix without addresses
+	f, err = newRecordFilter(nil, "0xab", 100, 1)
+	require.NoError(t, err)
+	require.Len(t, collectRecords(f.records(hisDb, 5, nil), f), 3*4)
+
+	f, err = newRecordFilter(nil, "", 50, 1)
+	require.NoError(t, err)
+	sampled := collectRecords(f.records(hisDb, 5, nil), f)
+	require.NotEmpty(t, sampled)
+	require.Less(t, len(sampled), len(all))
+	require.Equal(t, sampled, collectRecords(f.records(hisDb, 5, nil), f))
+	f.seed = 2
+	require.NotEqual(t, sampled, collectRecords(f.records(hisDb, 5, nil), f))
+	// a sample of the targeted records is a subset of the full sample
+	f, err = newRecordFilter([]string{addrs[0].String()}, "", 50, 1)
+	require.NoError(t, err)
+	for _, rec := range collectRecords(f.records(hisDb, 5, nil), f) {
+		require.Contains(t, sampled, rec)
+	}
+
+	_, err = newRecordFilter([]string{"0x123"}, "", 100, 1)
+	require.EqualError(t, err, `invalid address "0x123"`)
+	_, err = newRecordFilter(nil, "0xzz", 100, 1)
+	require.Error(t, err)
+	_, err = newRecordFilter(nil, "", 0, 1)
+	require.EqualError(t, err, "sample 0% is not in (0, 100]")
+}
+
+func recordsOf(hisDb *HistoryDb, addrs ...common.Address) chan HistoricalRecord {
+	var f recordFilter
+	for _, addr := range addrs {
+		f.addrs = append(f.addrs, addr)
+	}
+	return f.records(hisDb, 5, nil)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	require.Equal(t, []byte{0x01, 0x03}, prefixEnd([]byte{0x01, 0x02}))
+	require.Equal(t, []byte{0x02}, prefixEnd([]byte{0x01, 0xff}))
+	require.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+}
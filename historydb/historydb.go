@@ -4,20 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
 	"math/rand"
+	"net/http"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/tendermint/tendermint/libs/log"
 
 	it "github.com/smartbch/moeingads/indextree"
 	adstypes "github.com/smartbch/moeingads/types"
-	"github.com/smartbch/moeingdb/modb"
 	"github.com/smartbch/moeingevm/types"
 )
 
@@ -27,6 +33,7 @@ const (
 	BytecodeByte        = byte(104)
 	StorageByte         = byte(106)
 	DelHeightByte       = byte(108)
+	LastHeightByte      = byte(110) // the last height filled, written with the records of the height
 
 	Timeout = time.Second * 15
 )
@@ -49,23 +56,22 @@ type HistoryDb struct {
 	currHeight [8]byte
 }
 
-func NewHisDb(dirname string) *HistoryDb {
+func NewHisDb(dirname string) (*HistoryDb, error) {
 	db := &HistoryDb{}
 	var err error
 	db.rocksdb, err = it.NewRocksDB(dirname, ".")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return db
+	return db, nil
 }
 
 func (db *HistoryDb) Close() {
 	db.rocksdb.Close()
 }
 
-func (db *HistoryDb) BeginWrite(height uint64) {
+func (db *HistoryDb) BeginWrite() {
 	db.batch = db.rocksdb.NewBatch()
-	binary.BigEndian.PutUint64(db.currHeight[:], height)
 }
 
 func (db *HistoryDb) EndWrite() {
@@ -74,6 +80,27 @@ func (db *HistoryDb) EndWrite() {
 	db.batch = nil
 }
 
+// abortWrite drops the writes since BeginWrite.
+func (db *HistoryDb) abortWrite() {
+	db.batch.Close()
+	db.batch = nil
+}
+
+// LastHeight returns the last height filled, false for an empty db.
+func (db *HistoryDb) LastHeight() (uint64, bool) {
+	bz := db.rocksdb.Get([]byte{LastHeightByte})
+	if len(bz) == 0 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(bz), true
+}
+
+func (db *HistoryDb) setLastHeight(height uint64) {
+	var bz [8]byte
+	binary.BigEndian.PutUint64(bz[:], height)
+	db.batch.Set([]byte{LastHeightByte}, bz[:])
+}
+
 func (db *HistoryDb) AddRwLists0(height uint64, rwLists *types.ReadWriteLists) {
 	for _, op := range rwLists.AccountWList {
 		if len(op.Account) != 49 {
@@ -90,8 +117,23 @@ func (db *HistoryDb) AddRwLists0(height uint64, rwLists *types.ReadWriteLists) {
 	}
 }
 
-func (db *HistoryDb) AddRwLists(height uint64, rwLists *types.ReadWriteLists) {
-	db.BeginWrite(height)
+// AddRwLists writes rwLists into the current batch, or into a batch of its
+// own if no batch is begun.
+func (db *HistoryDb) AddRwLists(height uint64, rwLists *types.ReadWriteLists) error {
+	if db.batch != nil {
+		return db.addRwLists(height, rwLists)
+	}
+	db.BeginWrite()
+	if err := db.addRwLists(height, rwLists); err != nil {
+		db.abortWrite()
+		return err
+	}
+	db.EndWrite()
+	return nil
+}
+
+func (db *HistoryDb) addRwLists(height uint64, rwLists *types.ReadWriteLists) error {
+	binary.BigEndian.PutUint64(db.currHeight[:], height)
 	seq2Addr := make(map[uint64][20]byte, len(rwLists.AccountRList)+len(rwLists.AccountWList))
 	seq2Addr[2000] = [20]byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x27, 0x11}
 	for _, op := range rwLists.AccountRList {
@@ -117,11 +159,6 @@ func (db *HistoryDb) AddRwLists(height uint64, rwLists *types.ReadWriteLists) {
 	for _, op := range rwLists.AccountWList {
 		var key [1 + 20 + 8]byte
 		key[0] = AccountByte
-		//focus := common.Address(op.Addr).String()
-		//if("0x5D0171c4AB2745412B148aF5C803C62605b19cD6" == focus ||
-		//	"0x42A02Ab30C79247D96689C3776aA2faCC1F19dc3" == focus ) {
-		//	fmt.Printf("focus %s height %d value %#v\n", focus, height, op.Account)
-		//}
 		copy(key[1:], op.Addr[:])
 		copy(key[1+20:], db.currHeight[:])
 		db.batch.Set(key[:], op.Account)
@@ -145,50 +182,70 @@ func (db *HistoryDb) AddRwLists(height uint64, rwLists *types.ReadWriteLists) {
 		key[0] = StorageByte
 		addr, ok := seq2Addr[op.Seq]
 		if !ok {
-			panic("Cannot find seq's addr")
+			return fmt.Errorf("cannot find the addr of seq %d at height %d", op.Seq, height)
 		}
 		copy(key[1:], addr[:])
 		if len(op.Key) != 32 {
-			panic("Invalid Key Length")
+			return fmt.Errorf("invalid storage key length %d at height %d", len(op.Key), height)
 		}
-		//focus := common.Address(addr).String()
-		//if("0x5D0171c4AB2745412B148aF5C803C62605b19cD6" == focus ||
-		//	"0x42A02Ab30C79247D96689C3776aA2faCC1F19dc3" == focus ) {
-		//	fmt.Printf("FOCUS %s height %d key %#v value %#v\n", focus, height, op.Key, op.Value)
-		//}
 		copy(key[1+20:], op.Key)
 		copy(key[1+20+32:], db.currHeight[:])
 		db.batch.Set(key[:], op.Value)
 	}
-	db.EndWrite()
+	return nil
 }
 
-func (db *HistoryDb) AddRwListAtHeight(ctx *types.Context, height uint64) {
+func (db *HistoryDb) AddRwListAtHeight(ctx *types.Context, height uint64) error {
 	blk, err := ctx.GetBlockByHeight(height)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to get block %d: %w", height, err)
 	}
 	for _, txHash := range blk.Transactions {
 		tx, _, err := ctx.GetTxByHash(txHash)
 		if err != nil {
-			fmt.Printf("txHash %#v\n", txHash)
-			panic(err)
+			return fmt.Errorf("failed to get tx %s: %w", common.Hash(txHash), err)
 		}
 		if tx.StatusStr == "incorrect nonce" {
 			//fmt.Printf("%#v\n", tx)
 			continue
 		}
-		db.AddRwLists(height, tx.RwLists)
+		if err = db.AddRwLists(height, tx.RwLists); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (db *HistoryDb) Fill(ctx *types.Context, endHeight uint64) {
-	for h := uint64(1); h < endHeight; h++ {
+// Fill writes the heights in r with one batch per batchBlocks blocks, each
+// batch records its last height so that an interrupted Fill can be resumed.
+// It stops after a batch when done is closed.
+func (db *HistoryDb) Fill(ctx *types.Context, r heightRange, batchBlocks uint64, done <-chan struct{}) error {
+	if batchBlocks == 0 {
+		batchBlocks = 1
+	}
+	for h := r.start; h <= r.end; h++ {
 		if h%10000 == 0 {
 			fmt.Printf("Height %d\n", h)
 		}
-		db.AddRwListAtHeight(ctx, h)
+		if db.batch == nil {
+			db.BeginWrite()
+		}
+		if err := db.AddRwListAtHeight(ctx, h); err != nil {
+			db.abortWrite()
+			return err
+		}
+		if (h-r.start+1)%batchBlocks != 0 && h != r.end {
+			continue
+		}
+		db.setLastHeight(h)
+		db.EndWrite()
+		select {
+		case <-done:
+			return errInterrupted
+		default:
+		}
 	}
+	return nil
 }
 
 func getRecord(key, value []byte) (rec HistoricalRecord) {
@@ -214,222 +271,369 @@ func getRecord(key, value []byte) (rec HistoricalRecord) {
 	return
 }
 
-func (db *HistoryDb) GenerateRecords(recChan chan HistoricalRecord, latestHeight uint64) {
-	iter := db.rocksdb.Iterator([]byte{AccountByte}, []byte{StorageByte + 1})
-	//iter := db.rocksdb.Iterator([]byte{AccountByte}, []byte{AccountByte + 1})
-	//iter := db.rocksdb.Iterator([]byte{BytecodeByte}, []byte{BytecodeByte + 1})
-	//iter := db.rocksdb.Iterator([]byte{StorageByte, 0x42, 0xA0}, []byte{StorageByte + 1})
+// GenerateRecords sends all the records to recChan and closes it. It stops
+// early when done is closed.
+func (db *HistoryDb) GenerateRecords(recChan chan HistoricalRecord, latestHeight uint64, done <-chan struct{}) {
+	db.generateRecords(recChan, latestHeight, []byte{AccountByte}, []byte{StorageByte + 1}, done)
+	close(recChan)
+}
+
+// GenerateRecordsOf only generates the records of addrs, and only the storage
+// records whose keys start with keyPrefix if it is not empty.
+func (db *HistoryDb) GenerateRecordsOf(recChan chan HistoricalRecord, latestHeight uint64, addrs [][20]byte, keyPrefix []byte, done <-chan struct{}) {
+	defer close(recChan)
+	addrs = append([][20]byte{}, addrs...)
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, kind := range []byte{AccountByte, BytecodeByte, StorageByte} {
+		if len(keyPrefix) != 0 && kind != StorageByte {
+			continue
+		}
+		for _, addr := range addrs {
+			start := append(append([]byte{kind}, addr[:]...), keyPrefix...)
+			if !db.generateRecords(recChan, latestHeight, start, prefixEnd(start), done) {
+				return
+			}
+		}
+	}
+}
+
+// prefixEnd returns the smallest key larger than all the keys with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// generateRecords ends a record at the next record of the same account,
+// bytecode or storage slot. A self-destruct writes empty account and bytecode
+// records, but not the storage slots, so a storage record also ends at the
+// first deletion of its contract after it was written. It returns false if it
+// is stopped by done.
+func (db *HistoryDb) generateRecords(recChan chan HistoricalRecord, latestHeight uint64, start, end []byte, done <-chan struct{}) bool {
+	iter := db.rocksdb.Iterator(start, end)
 	defer iter.Close()
 	if !iter.Valid() {
-		close(recChan)
-		return
+		return true
+	}
+	var dels deletions
+	finish := func(rec *HistoricalRecord) {
+		if len(rec.Key) != 32 {
+			return
+		}
+		if dels.addr != rec.Addr || dels.heights == nil {
+			dels = db.getDeletions(rec.Addr)
+		}
+		if h, ok := dels.after(rec.StartHeight); ok && h < rec.EndHeight {
+			rec.EndHeight = h
+		}
 	}
 	currRec := getRecord(iter.Key(), iter.Value())
 	currRec.EndHeight = latestHeight
 	for iter.Next(); iter.Valid(); iter.Next() {
-		key, value := iter.Key(), iter.Value()
-		if (currRec.Key == "account" && key[0] == AccountByte) ||
-			(currRec.Key == "bytecode" && key[0] == BytecodeByte) {
-			if bytes.Equal(currRec.Addr[:], key[1:1+20]) {
-				currRec.EndHeight = binary.BigEndian.Uint64(key[1+20:])
-			}
-		} else if len(currRec.Key) == 32 && key[0] == StorageByte {
-			if bytes.Equal(currRec.Addr[:], key[1:1+20]) && currRec.Key == string(key[1+20:1+20+32]) {
-				currRec.EndHeight = binary.BigEndian.Uint64(key[1+20+32:])
-			} else {
-				heightBz := db.rocksdb.Get(append([]byte{DelHeightByte}, currRec.Addr[:]...))
-				if len(heightBz) != 0 {
-					currRec.EndHeight = binary.BigEndian.Uint64(heightBz)
-				}
-			}
+		nextRec := getRecord(iter.Key(), iter.Value())
+		if nextRec.Addr == currRec.Addr && nextRec.Key == currRec.Key {
+			currRec.EndHeight = nextRec.StartHeight
 		}
-		recChan <- currRec
-		currRec = getRecord(key, value)
+		finish(&currRec)
+		select {
+		case recChan <- currRec:
+		case <-done:
+			return false
+		}
+		currRec = nextRec
 		currRec.EndHeight = latestHeight
 	}
-	recChan <- currRec
-	close(recChan)
+	finish(&currRec)
+	select {
+	case recChan <- currRec:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// deletions are the heights at which a contract was deleted.
+type deletions struct {
+	addr    [20]byte
+	heights []uint64 // ascending
+	// a contract deleted and re-created in the same block leaves no empty
+	// account record but DelHeightByte, the storage written at that height
+	// belongs to the new contract
+	recreatedAt uint64
+}
+
+// getDeletions finds the empty account records of addr.
+func (db *HistoryDb) getDeletions(addr [20]byte) deletions {
+	dels := deletions{addr: addr, heights: []uint64{}}
+	start := append([]byte{AccountByte}, addr[:]...)
+	iter := db.rocksdb.Iterator(start, prefixEnd(start))
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		if len(iter.Value()) == 0 {
+			dels.heights = append(dels.heights, binary.BigEndian.Uint64(iter.Key()[1+20:]))
+		}
+	}
+	heightBz := db.rocksdb.Get(append([]byte{DelHeightByte}, addr[:]...))
+	if len(heightBz) != 0 {
+		h := binary.BigEndian.Uint64(heightBz)
+		i := sort.Search(len(dels.heights), func(i int) bool { return dels.heights[i] >= h })
+		if i == len(dels.heights) || dels.heights[i] != h {
+			dels.heights = append(dels.heights[:i], append([]uint64{h}, dels.heights[i:]...)...)
+			dels.recreatedAt = h
+		}
+	}
+	return dels
+}
+
+// after returns the first deletion which removes the storage written at
+// height, a deletion at the same height removes it unless the contract was
+// re-created after it.
+func (dels deletions) after(height uint64) (uint64, bool) {
+	for _, h := range dels.heights {
+		if h > height || (h == height && h != dels.recreatedAt) {
+			return h, true
+		}
+	}
+	return 0, false
 }
 
 // -------------------------------------------------------------------------------
 
-func generateHisDb(modbDir, hisdbDir string, endHeight uint64) {
-	modb := modb.NewMoDB(modbDir, log.NewNopLogger())
-	ctx := types.NewContext(nil, modb)
-	hisDb := NewHisDb(hisdbDir)
-	hisDb.Fill(ctx, endHeight)
-	hisDb.Close()
+var errInterrupted = errors.New("interrupted")
+
+type fillConfig struct {
+	batchBlocks  uint64
+	follow       bool // wait for new blocks in modb after r.end is not reached
+	pollInterval time.Duration
 }
 
-func getEthClient(rpcUrl string) *ethclient.Client {
-	rpcCli, err := rpc.DialContext(context.Background(), rpcUrl)
+// generateHisDb fills hisdb with the heights in r, it resumes from the height
+// after the last one in hisdb. modb is only read, so it may be the modb of a
+// running smartbchd. In follow mode, modb is checked for new blocks every
+// pollInterval until r.end is filled.
+func generateHisDb(modbDir, hisdbDir string, r heightRange, cfg fillConfig) error {
+	hisDb, err := NewHisDb(hisdbDir)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return ethclient.NewClient(rpcCli)
-}
+	defer hisDb.Close()
+	if last, ok := hisDb.LastHeight(); ok {
+		if r.start > last+1 {
+			return fmt.Errorf("the history db ends at height %d, starting from %d would leave a gap", last, r.start)
+		}
+		if r.start <= last {
+			r.start = last + 1
+		}
+	}
+	if r.start > r.end {
+		fmt.Printf("the history db is already filled up to height %d\n", r.end)
+		return nil
+	}
+	fmt.Printf("filling from height %d\n", r.start)
 
-func runTestcases(hisdbDir, rpcUrl string, latestHeight uint64) {
-	ethCli := getEthClient(rpcUrl)
-	recChan := make(chan HistoricalRecord, 100)
-	hisDb := NewHisDb(hisdbDir)
-	go hisDb.GenerateRecords(recChan, latestHeight)
-	count := 0
-	for rec := range recChan {
-		if count%100000 == 0 {
-			fmt.Printf("========== %d ============\n", count)
+	reader, err := newModbReader(modbDir)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	for {
+		latest, err := fillFromModb(ctx, hisDb, reader, r, cfg)
+		if err == errInterrupted {
+			fmt.Printf("interrupted, run again to resume from height %d\n", latest+1)
+			return nil
+		} else if err != nil {
+			return err
 		}
-		if rec.EndHeight == rec.StartHeight {
-			continue
+		if latest >= r.end {
+			return nil
 		}
-		if int(rec.EndHeight) <= int(rec.StartHeight) {
-			fmt.Printf("StartEnd %d %d\n", rec.StartHeight, rec.EndHeight)
+		if !cfg.follow {
+			return fmt.Errorf("modb only has the heights up to %d", latest)
 		}
-		mid := rand.Intn(int(rec.EndHeight)-int(rec.StartHeight)) + int(rec.StartHeight)
-		if rec.Key == "account" {
-			runNonceTestcase(rec, ethCli, rec.StartHeight, rec.StartHeight, rec.EndHeight)
-			if rec.StartHeight+1 < rec.EndHeight {
-				//We are not aware of balance-change caused by Prepare
-				//So rec.StartHeight+1 == rec.EndHeight cannot be tested
-				runAccountTestcase(rec, ethCli, rec.StartHeight, rec.StartHeight, rec.EndHeight)
-			}
-			if rec.StartHeight+4 <= rec.EndHeight { // must avoid rec.EndHeight-1
-				mid = rand.Intn(int(rec.EndHeight)-int(rec.StartHeight)-3) + int(rec.StartHeight) + 1
-				runNonceTestcase(rec, ethCli, uint64(mid), rec.StartHeight, rec.EndHeight)
-				runAccountTestcase(rec, ethCli, uint64(mid), rec.StartHeight, rec.EndHeight)
-			}
-			runNonceTestcase(rec, ethCli, rec.EndHeight-1, rec.StartHeight, rec.EndHeight)
-			//We are not aware of balance-change caused by Prepare
-			//So balance at EndHeight cannot be tested
-		} else if rec.Key == "bytecode" {
-			runBytecodeTestcase(rec, ethCli, rec.StartHeight, rec.StartHeight, rec.EndHeight)
-			runBytecodeTestcase(rec, ethCli, uint64(mid), rec.StartHeight, rec.EndHeight)
-			runBytecodeTestcase(rec, ethCli, rec.EndHeight-1, rec.StartHeight, rec.EndHeight)
-		} else if len(rec.Key) == 32 {
-			runStorageTestcase(rec, ethCli, rec.StartHeight, rec.StartHeight, rec.EndHeight)
-			runStorageTestcase(rec, ethCli, uint64(mid), rec.StartHeight, rec.EndHeight)
-			runStorageTestcase(rec, ethCli, rec.EndHeight-1, rec.StartHeight, rec.EndHeight)
-		} else {
-			panic("Invalid rec.Key")
+		r.start = latest + 1
+		select {
+		case <-time.After(cfg.pollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+		if err = reader.refresh(); err != nil {
+			return err
 		}
-		count++
 	}
 }
 
-func runAccountTestcase(rec HistoricalRecord, ethCli *ethclient.Client, height, s, e uint64) {
-	h := big.NewInt(int64(height))
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	defer cancel()
-
-	balance, err := ethCli.BalanceAt(ctx, common.Address(rec.Addr), h)
-	if len(rec.Value) == 0 && balance.IsInt64() && balance.Int64() == 0 { //deleted contract account
-		return
+// fillFromModb fills the heights in r which are in modb, and returns the last
+// height filled.
+func fillFromModb(ctx context.Context, hisDb *HistoryDb, reader *modbReader, r heightRange, cfg fillConfig) (uint64, error) {
+	latest := uint64(reader.GetLatestHeight())
+	if latest < r.start {
+		return r.start - 1, nil
 	}
-	//fmt.Printf("Here %#v %d\n", rec.Addr, len(rec.Value))
-	accInfo := types.NewAccountInfo(rec.Value)
-	if err != nil {
-		panic(err)
-	}
-	if accInfo.Balance().ToBig().Cmp(balance) != 0 {
-		fmt.Printf("SE %d %d\n", s, e)
-		fmt.Printf("account %d acc %s\n", height, common.Address(rec.Addr))
-		fmt.Printf("balance ref %s imp %s\n", accInfo.Balance(), balance)
-		balance, err = ethCli.BalanceAt(ctx, common.Address(rec.Addr), nil)
-		fmt.Printf("balance+latest imp %s\n", balance)
-		h := big.NewInt(int64(height + 1))
-		balance, err = ethCli.BalanceAt(ctx, common.Address(rec.Addr), h)
-		fmt.Printf("BALANCE+1 imp %s\n", balance)
-	}
-}
-func runNonceTestcase(rec HistoricalRecord, ethCli *ethclient.Client, height, s, e uint64) {
-	h := big.NewInt(int64(height))
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	defer cancel()
-
-	nonce, err := ethCli.NonceAt(ctx, common.Address(rec.Addr), h)
-	if len(rec.Value) == 0 && nonce == 0 { //deleted contract account
-		return
+	if latest < r.end {
+		r.end = latest
 	}
-	//fmt.Printf("Here %#v %d\n", rec.Addr, len(rec.Value))
-	accInfo := types.NewAccountInfo(rec.Value)
+	err := hisDb.Fill(types.NewContext(nil, reader), r, cfg.batchBlocks, ctx.Done())
+	if reader.err != nil {
+		err = reader.err
+	}
+	last, _ := hisDb.LastHeight()
+	return last, err
+}
+
+// getEthClient keeps up to conns idle HTTP connections to rpcUrl, so that
+// the workers sharing the client reuse them.
+func getEthClient(rpcUrl string, conns int) (*ethclient.Client, error) {
+	rpcCli, err := getRpcClient(rpcUrl, conns)
 	if err != nil {
-		panic(err)
-	}
-	if accInfo.Nonce() != nonce {
-		fmt.Printf("SE %d %d\n", s, e)
-		fmt.Printf("height %d acc %s\n", height, common.Address(rec.Addr))
-		fmt.Printf("nonce ref %d imp %d\n", accInfo.Nonce(), nonce)
-		h = big.NewInt(int64(height - 1))
-		nonce, _ = ethCli.NonceAt(ctx, common.Address(rec.Addr), h)
-		fmt.Printf("nonce imp+h-1 %d\n", nonce)
-
-		h = big.NewInt(int64(height + 1))
-		nonce, _ = ethCli.NonceAt(ctx, common.Address(rec.Addr), h)
-		fmt.Printf("nonce imp+h+1 %d\n", nonce)
-	} else {
-		if "0x498F4F6cb582B9839e3dA48E18734286FBFFa7e0" == common.Address(rec.Addr).String() ||
-			"0x79f3F9F9c0E860341e5A20C6801Ad28fb1FBD924" == common.Address(rec.Addr).String() {
-			fmt.Printf("nonce SAME! h %d nonce %d %s\n", height, nonce, common.Address(rec.Addr))
-		}
+		return nil, err
 	}
+	return ethclient.NewClient(rpcCli), nil
 }
 
-func runBytecodeTestcase(rec HistoricalRecord, ethCli *ethclient.Client, height, s, e uint64) {
-	h := big.NewInt(int64(height))
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	defer cancel()
+func getRpcClient(rpcUrl string, conns int) (*rpc.Client, error) {
+	if strings.HasPrefix(rpcUrl, "http://") || strings.HasPrefix(rpcUrl, "https://") {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = conns
+		transport.MaxIdleConnsPerHost = conns
+		return rpc.DialHTTPWithClient(rpcUrl, &http.Client{Transport: transport})
+	}
+	return rpc.DialContext(context.Background(), rpcUrl)
+}
+
+// testcase is the checks of one record, the heights are picked up front so
+// that the report does not depend on how the checks are scheduled.
+type testcase struct {
+	seq     int
+	rec     HistoricalRecord
+	kinds   []string
+	heights []uint64
+}
 
-	//focus := common.Address(rec.Addr).String()
-	//if("0x5D0171c4AB2745412B148aF5C803C62605b19cD6" == focus ||
-	//	"0x42A02Ab30C79247D96689C3776aA2faCC1F19dc3" == focus ) {
-	//	fmt.Printf("SE %d %d\n", s, e)
-	//	fmt.Printf("Focus height %d acc %s value %#v\n", height, common.Address(rec.Addr), rec.Value)
-	//}
-	bytecode, err := ethCli.CodeAt(ctx, common.Address(rec.Addr), h)
-	if len(rec.Value) == 0 && len(bytecode) == 0 { //deleted contract code
-		return
+// aliveRecord returns false for the records which are not alive in
+// [r.start, r.end], the records not overwritten by r.end
+// are taken as overwritten at r.end+1.
+func aliveRecord(rec HistoricalRecord, r heightRange) (HistoricalRecord, bool) {
+	if rec.StartHeight > r.end || rec.EndHeight <= r.start {
+		return rec, false
 	}
-	if err != nil {
-		panic(err)
+	if rec.EndHeight > r.end+1 {
+		rec.EndHeight = r.end + 1
 	}
-	bcInfo := types.NewBytecodeInfo(rec.Value)
-	if !bytes.Equal(bcInfo.BytecodeSlice(), bytecode) {
-		fmt.Printf("SE %d %d\n", s, e)
-		fmt.Printf("bytecode %d acc %s\n", height, common.Address(rec.Addr))
-		fmt.Printf("ref %#v\n", bcInfo.BytecodeSlice())
-		fmt.Printf("imp %#v\n", bytecode)
+	if rec.EndHeight <= rec.StartHeight {
+		return rec, false
 	}
+	return rec, true
 }
 
-func runStorageTestcase(rec HistoricalRecord, ethCli *ethclient.Client, height, s, e uint64) {
-	if rec.Addr == [20]byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x27, 0x10} { // The storage of staking contract cannot be correctly tested
-		return
+// planTestcase picks the kinds and heights to check for a record returned
+// by aliveRecord.
+func planTestcase(rec HistoricalRecord, rnd *rand.Rand) (testcase, error) {
+	tc := testcase{rec: rec}
+	mid := uint64(rnd.Intn(int(rec.EndHeight)-int(rec.StartHeight)) + int(rec.StartHeight))
+	if rec.Key == "account" {
+		tc.kinds = append(tc.kinds, kindNonce)
+		tc.heights = append(tc.heights, rec.StartHeight)
+		if rec.StartHeight+1 < rec.EndHeight {
+			//We are not aware of balance-change caused by Prepare
+			//So rec.StartHeight+1 == rec.EndHeight cannot be tested
+			tc.kinds = append(tc.kinds, kindBalance)
+			tc.heights = append(tc.heights, rec.StartHeight)
+		}
+		if rec.StartHeight+4 <= rec.EndHeight { // must avoid rec.EndHeight-1
+			mid = uint64(rnd.Intn(int(rec.EndHeight)-int(rec.StartHeight)-3) + int(rec.StartHeight) + 1)
+			tc.kinds = append(tc.kinds, kindNonce, kindBalance)
+			tc.heights = append(tc.heights, mid, mid)
+		}
+		tc.kinds = append(tc.kinds, kindNonce)
+		tc.heights = append(tc.heights, rec.EndHeight-1)
+		//We are not aware of balance-change caused by Prepare
+		//So balance at EndHeight cannot be tested
+	} else if rec.Key == "bytecode" {
+		tc.kinds = []string{kindBytecode, kindBytecode, kindBytecode}
+		tc.heights = []uint64{rec.StartHeight, mid, rec.EndHeight - 1}
+	} else if len(rec.Key) == 32 && rec.Addr == stakingContractAddr {
+		// The staking contract's storage is also written outside txs, when the
+		// fees are distributed and epochs switch, which is not in the rw lists.
+		// So only the height a record was written is checked.
+		tc.kinds = []string{kindStaking}
+		tc.heights = []uint64{rec.StartHeight}
+	} else if len(rec.Key) == 32 {
+		tc.kinds = []string{kindStorage, kindStorage, kindStorage}
+		tc.heights = []uint64{rec.StartHeight, mid, rec.EndHeight - 1}
+	} else {
+		return tc, fmt.Errorf("invalid record key %#v", rec.Key)
 	}
-	h := big.NewInt(int64(height))
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
-	defer cancel()
+	return tc, nil
+}
 
-	//focus := common.Address(rec.Addr).String()
-	//if("0x5D0171c4AB2745412B148aF5C803C62605b19cD6" == focus ||
-	//	"0x42A02Ab30C79247D96689C3776aA2faCC1F19dc3" == focus ) {
-	//	fmt.Printf("SE %d %d\n", s, e)
-	//	fmt.Printf("Focus height %d acc %s key %#v value %#v\n", height, common.Address(rec.Addr), rec.Key, rec.Value)
-	//}
+var stakingContractAddr = [20]byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x27, 0x10}
 
-	var key common.Hash
-	copy(key[:], rec.Key)
-	value, err := ethCli.StorageAt(ctx, common.Address(rec.Addr), key, h)
-	var zero32 [32]byte
-	if len(rec.Value) == 0 && bytes.Equal(value, zero32[:]) { //deleted stoarge
-		return
-	}
-	if err != nil {
-		panic(err)
+// expectedState is the state in rec formatted as queryState does, a deleted
+// account, bytecode or storage slot is expected to read as zero.
+func expectedState(rec HistoricalRecord, kind string) string {
+	switch kind {
+	case kindBalance:
+		if len(rec.Value) == 0 {
+			return "0"
+		}
+		return types.NewAccountInfo(rec.Value).Balance().ToBig().String()
+	case kindNonce:
+		if len(rec.Value) == 0 {
+			return "0"
+		}
+		return strconv.FormatUint(types.NewAccountInfo(rec.Value).Nonce(), 10)
+	case kindBytecode:
+		if len(rec.Value) == 0 {
+			return "0x"
+		}
+		return hexutil.Encode(types.NewBytecodeInfo(rec.Value).BytecodeSlice())
+	case kindStorage, kindStaking:
+		if len(rec.Value) == 0 {
+			return hexutil.Encode(make([]byte, 32))
+		}
+		return hexutil.Encode(rec.Value)
 	}
-	if !bytes.Equal(rec.Value, value) {
-		fmt.Printf("SE %d %d\n", s, e)
-		fmt.Printf("storage %d acc %s %#v\n", height, common.Address(rec.Addr), rec.Key)
-		fmt.Printf("ref %#v\n", rec.Value)
-		fmt.Printf("imp %#v\n", value)
+	panic("invalid kind " + kind)
+}
+
+func queryState(ctx context.Context, ethCli *ethclient.Client, rec HistoricalRecord, kind string, height uint64) (string, error) {
+	h := new(big.Int).SetUint64(height)
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	addr := common.Address(rec.Addr)
+	switch kind {
+	case kindBalance:
+		balance, err := ethCli.BalanceAt(ctx, addr, h)
+		if err != nil {
+			return "", err
+		}
+		return balance.String(), nil
+	case kindNonce:
+		nonce, err := ethCli.NonceAt(ctx, addr, h)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(nonce, 10), nil
+	case kindBytecode:
+		bytecode, err := ethCli.CodeAt(ctx, addr, h)
+		if err != nil {
+			return "", err
+		}
+		return hexutil.Encode(bytecode), nil
+	case kindStorage, kindStaking:
+		value, err := ethCli.StorageAt(ctx, addr, common.BytesToHash([]byte(rec.Key)), h)
+		if err != nil {
+			return "", err
+		}
+		return hexutil.Encode(value), nil
 	}
+	panic("invalid kind " + kind)
 }
@@ -6,8 +6,12 @@ import (
 	"math/big"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
 )
 
 // go test -c .
@@ -19,25 +23,34 @@ func TestStep0(t *testing.T) {
 	if os.Getenv("HISTORYDBTEST") != "YES" {
 		return
 	}
-	testTheOnlyTxInBlocks("./modb", "http://127.0.0.1:8545", 100000)
+	err := testTheOnlyTxInBlocks("./modb", "http://127.0.0.1:8545", heightRange{start: 1, end: 99999})
+	require.NoError(t, err)
 }
 
 func TestStep1(t *testing.T) {
 	if os.Getenv("HISTORYDBTEST") != "YES" {
 		return
 	}
-	generateHisDb("/mnt/nvme/smartbchd/data/modb", "./hisdb", 2650514)
+	err := generateHisDb("/mnt/nvme/smartbchd/data/modb", "./hisdb", heightRange{start: 1, end: 2650513},
+		fillConfig{batchBlocks: 1000})
+	require.NoError(t, err)
 }
 
 func TestStep2(t *testing.T) {
 	if os.Getenv("HISTORYDBTEST") != "YES" {
 		return
 	}
-	runTestcases("./hisdb", "http://127.0.0.1:8545", 2650514)
+	report := newTestReport(os.Stdout, false)
+	err := runTestcases("./hisdb", "http://127.0.0.1:8545", heightRange{start: 1, end: 2650513},
+		verifyConfig{workers: 8, retries: 5, seed: 1}, report)
+	require.NoError(t, err)
+	report.printSummary(os.Stdout)
+	require.NoError(t, report.err())
 }
 
 func TestStep_getAccount(t *testing.T) {
-	ethCli := getEthClient("http://127.0.0.1:8545")
+	ethCli, err := getEthClient("http://127.0.0.1:8545", 1)
+	require.NoError(t, err)
 
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 	defer cancel()
@@ -48,3 +61,74 @@ func TestStep_getAccount(t *testing.T) {
 	nonce, err = ethCli.NonceAt(ctx, addr, big.NewInt(2650514))
 	fmt.Printf("Nonce B %d %#v\n", nonce, err)
 }
+
+func TestGenerateHisDb(t *testing.T) {
+	eoa := common.HexToAddress("0xe0a")
+	other := common.HexToAddress("0x0be")
+	var blocks [][]*types.Transaction
+	for h := uint64(1); h <= 6; h++ {
+		blocks = append(blocks, []*types.Transaction{{RwLists: &types.ReadWriteLists{
+			AccountWList: []types.AccountRWOp{{Addr: eoa, Account: newAccount(1, h, 100)}},
+		}}})
+	}
+	// the rw lists of a tx with an incorrect nonce are not written
+	blocks[3] = append(blocks[3], &types.Transaction{StatusStr: "incorrect nonce", RwLists: &types.ReadWriteLists{
+		AccountWList: []types.AccountRWOp{{Addr: other, Account: newAccount(2, 1, 100)}},
+	}})
+	modbDir, hisdbDir := t.TempDir(), t.TempDir()
+	appendModbBlocks(t, modbDir, blocks[:4]...)
+
+	lastHeight := func() uint64 {
+		hisDb, err := NewHisDb(hisdbDir)
+		require.NoError(t, err)
+		defer hisDb.Close()
+		last, ok := hisDb.LastHeight()
+		require.True(t, ok)
+		return last
+	}
+	cfg := fillConfig{batchBlocks: 2, pollInterval: 10 * time.Millisecond}
+	require.NoError(t, generateHisDb(modbDir, hisdbDir, heightRange{start: 1, end: 3}, cfg))
+	require.Equal(t, uint64(3), lastHeight())
+	// resumes from 4, and fills what modb has
+	err := generateHisDb(modbDir, hisdbDir, heightRange{start: 1, end: 6}, cfg)
+	require.EqualError(t, err, "modb only has the heights up to 4")
+	require.Equal(t, uint64(4), lastHeight())
+
+	// follows the blocks appended while it is waiting
+	cfg.follow = true
+	done := make(chan error)
+	go func() {
+		done <- generateHisDb(modbDir, hisdbDir, heightRange{start: 1, end: 6}, cfg)
+	}()
+	for _, blk := range blocks[4:] {
+		select {
+		case err = <-done:
+			t.Fatalf("returned before height 6 is in modb: %v", err)
+		case <-time.After(5 * cfg.pollInterval):
+		}
+		appendModbBlocks(t, modbDir, blk)
+	}
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Minute):
+		t.Fatal("height 6 is not filled")
+	}
+	require.Equal(t, uint64(6), lastHeight())
+	require.NoError(t, generateHisDb(modbDir, hisdbDir, heightRange{start: 1, end: 6}, cfg))
+	err = generateHisDb(modbDir, hisdbDir, heightRange{start: 8, end: 9}, cfg)
+	require.EqualError(t, err, "the history db ends at height 6, starting from 8 would leave a gap")
+
+	hisDb, err := NewHisDb(hisdbDir)
+	require.NoError(t, err)
+	defer hisDb.Close()
+	recChan := make(chan HistoricalRecord, 100)
+	go hisDb.GenerateRecords(recChan, 7, nil)
+	var heights [][2]uint64
+	for rec := range recChan {
+		require.Equal(t, eoa, common.Address(rec.Addr))
+		require.Equal(t, rec.StartHeight, types.NewAccountInfo(rec.Value).Nonce())
+		heights = append(heights, [2]uint64{rec.StartHeight, rec.EndHeight})
+	}
+	require.Equal(t, [][2]uint64{{1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 6}, {6, 7}}, heights)
+}
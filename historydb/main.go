@@ -1,44 +1,482 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"math"
 	"os"
-	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tendermint/tendermint/libs/cli"
+)
+
+const (
+	flagModb      = "modb"
+	flagHisDb     = "hisdb"
+	flagOneTxDb   = "one-tx-db"
+	flagRpcUrl    = "rpc-url"
+	flagStart     = "start"
+	flagEnd       = "end"
+	flagStopOnErr = "stop-on-err"
+	flagReport    = "report"
+	flagReportAll = "report-all"
+	flagWorkers   = "workers"
+	flagRate      = "rate"
+	flagRetries   = "retries"
+	flagSeed      = "seed"
+	flagBatch     = "batch-blocks"
+	flagFollow    = "follow"
+	flagPoll      = "poll-interval"
+	flagAddresses = "addresses"
+	flagKeyPrefix = "key-prefix"
+	flagSample    = "sample"
+	flagNoStaking = "skip-staking"
+	flagLogsRange = "logs-range"
+	flagFormat    = "format"
+	flagOutput    = "output"
 )
 
-const usage = `Usage:
-  historydb generateOneTxDb <modbDir> <oneTxDbDir> <endHeight>
-  historydb testTxsInOneTxDb <modbDir> <rpcUrl> <endHeight> <stopOnErr>
-  historydb testTheOnlyTxInBlocks <oneTxDbDir> <rpcUrl> <endHeight>
-  historydb generateHisDb <modbDir> <hisdbDir> <endHeight>
-  historydb runTestcases <hisdbDir> <rpcUrl> <latestHeight>`
+// exitMismatch tells CI a run which found mismatches from a broken run,
+// which exits with 1, or 2 if it panicked.
+const exitMismatch = 3
+
+// mismatchError is returned when the checks ran but found mismatches.
+type mismatchError struct {
+	count int
+}
+
+func (e mismatchError) Error() string {
+	return fmt.Sprintf("%d mismatches found", e.count)
+}
+
+func (e mismatchError) ExitCode() int {
+	return exitMismatch
+}
 
 func main() {
-	if len(os.Args) < 5 {
-		fmt.Println(usage)
-		return
+	rootCmd := createRootCmd()
+	executor := cli.Executor{Command: rootCmd, Exit: os.Exit}
+	_ = executor.Execute() // it exits with the code of the error
+}
+
+func createRootCmd() *cobra.Command {
+	cobra.EnableCommandSorting = false
+	rootCmd := &cobra.Command{
+		Use:   "historydb",
+		Short: "check the historical state served by smartbchd against modb",
 	}
 
-	switch os.Args[1] {
-	case "generateOneTxDb":
-		generateOneTxDb(os.Args[2], os.Args[3], parseUint64(os.Args[4]))
-	case "testTxsInOneTxDb":
-		testTxsInOneTxDb(os.Args[2], os.Args[3], parseUint64(os.Args[4]), len(os.Args) == 5 || os.Args[5] != "false")
-	case "testTheOnlyTxInBlocks":
-		testTheOnlyTxInBlocks(os.Args[2], os.Args[3], parseUint64(os.Args[4]))
-	case "generateHisDb":
-		generateHisDb(os.Args[2], os.Args[3], parseUint64(os.Args[4]))
-	case "runTestcases":
-		runTestcases(os.Args[2], os.Args[3], parseUint64(os.Args[4]))
-	default:
-		fmt.Println(usage)
+	rootCmd.AddCommand(generateOneTxDbCmd())
+	rootCmd.AddCommand(testTxsInOneTxDbCmd())
+	rootCmd.AddCommand(testTheOnlyTxInBlocksCmd())
+	rootCmd.AddCommand(generateHisDbCmd())
+	rootCmd.AddCommand(runTestcasesCmd())
+	rootCmd.AddCommand(testTxsInModbCmd())
+	rootCmd.AddCommand(exportCmd())
+	return rootCmd
+}
+
+// heightRange is [start, end], both included.
+type heightRange struct {
+	start uint64
+	end   uint64
+}
+
+func addHeightFlags(cmd *cobra.Command, endUsage string) {
+	cmd.Flags().Uint64(flagStart, 1, "first height")
+	cmd.Flags().Uint64(flagEnd, 0, endUsage)
+	_ = cmd.MarkFlagRequired(flagEnd)
+}
+
+func getHeightRange() (heightRange, error) {
+	return newHeightRange(viper.GetUint64(flagStart), viper.GetUint64(flagEnd))
+}
+
+func newHeightRange(start, end uint64) (heightRange, error) {
+	r := heightRange{start: start, end: end}
+	if r.start == 0 {
+		return r, fmt.Errorf("--%s must be at least 1", flagStart)
+	}
+	if r.end < r.start {
+		return r, fmt.Errorf("--%s %d is below --%s %d", flagEnd, r.end, flagStart, r.start)
+	}
+	return r, nil
+}
+
+// bindFlags binds the flags and checks the required string flags are not empty.
+func bindFlags(cmd *cobra.Command, required ...string) error {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+	for _, name := range required {
+		if viper.GetString(name) == "" {
+			return fmt.Errorf("--%s must not be empty", name)
+		}
 	}
+	return nil
 }
 
-func parseUint64(s string) uint64 {
-	n, err := strconv.ParseUint(s, 10, 64)
+// runWithReport runs the checks with the report written to --report, and
+// prints the summary of the report.
+func runWithReport(run func(report *testReport) error) error {
+	f, err := os.Create(viper.GetString(flagReport))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return n
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	report := newTestReport(w, viper.GetBool(flagReportAll))
+	err = run(report)
+	report.printSummary(os.Stdout)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		return err
+	}
+	return report.err()
+}
+
+func generateOneTxDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "generate-one-tx-db",
+		Aliases: []string{"generateOneTxDb"},
+		Short:   "copy the txs of the blocks which hold only one tx from modb to a new db",
+		Example: `historydb generate-one-tx-db \
+	--modb=/data/smartbchd/data/modb \
+	--one-tx-db=./onetxdb \
+	--end=2650514`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagModb, flagOneTxDb); err != nil {
+				return err
+			}
+			r, err := getHeightRange()
+			if err != nil {
+				return err
+			}
+			return generateOneTxDb(viper.GetString(flagModb), viper.GetString(flagOneTxDb), r)
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagModb, "", "modb directory of smartbchd")
+	cmd.Flags().String(flagOneTxDb, "", "directory of the one-tx db to write")
+	addHeightFlags(cmd, "last height")
+	_ = cmd.MarkFlagRequired(flagModb)
+	_ = cmd.MarkFlagRequired(flagOneTxDb)
+	return cmd
+}
+
+func testTxsInOneTxDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "test-txs-in-one-tx-db",
+		Aliases: []string{"testTxsInOneTxDb"},
+		Short:   "replay the txs of the one-tx db with sbch_call and compare the call details",
+		Example: `historydb test-txs-in-one-tx-db \
+	--one-tx-db=./onetxdb \
+	--rpc-url=http://127.0.0.1:8545 \
+	--start=1 \
+	--end=2650514 \
+	--stop-on-err=false`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagOneTxDb, flagRpcUrl); err != nil {
+				return err
+			}
+			r, err := getHeightRange()
+			if err != nil {
+				return err
+			}
+			return testTxsInOneTxDb(viper.GetString(flagOneTxDb), viper.GetString(flagRpcUrl), r,
+				viper.GetBool(flagStopOnErr))
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagOneTxDb, "", "directory of the one-tx db")
+	cmd.Flags().String(flagRpcUrl, "http://127.0.0.1:8545", "RPC URL of smartbchd")
+	addHeightFlags(cmd, "last height")
+	cmd.Flags().Bool(flagStopOnErr, true, "stop at the first mismatch")
+	_ = cmd.MarkFlagRequired(flagOneTxDb)
+	return cmd
+}
+
+func testTheOnlyTxInBlocksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "test-the-only-tx-in-blocks",
+		Aliases: []string{"testTheOnlyTxInBlocks"},
+		Short:   "replay the txs of the blocks which hold only one tx in modb with sbch_call",
+		Example: `historydb test-the-only-tx-in-blocks \
+	--modb=/data/smartbchd/data/modb \
+	--rpc-url=http://127.0.0.1:8545 \
+	--end=100000`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagModb, flagRpcUrl); err != nil {
+				return err
+			}
+			r, err := getHeightRange()
+			if err != nil {
+				return err
+			}
+			return testTheOnlyTxInBlocks(viper.GetString(flagModb), viper.GetString(flagRpcUrl), r)
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagModb, "", "modb directory of smartbchd")
+	cmd.Flags().String(flagRpcUrl, "http://127.0.0.1:8545", "RPC URL of smartbchd")
+	addHeightFlags(cmd, "last height")
+	_ = cmd.MarkFlagRequired(flagModb)
+	return cmd
+}
+
+func generateHisDbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "generate-his-db",
+		Aliases: []string{"generateHisDb"},
+		Short:   "write the read/write lists of the txs in modb into a history db",
+		Long: `Write the read/write lists of the txs in modb into a history db. The
+last height written is kept in the history db, a later run resumes from the
+height after it. modb is opened read-only, so it may be the modb of a
+running smartbchd. With --follow, modb is checked for new heights every
+--poll-interval and they are appended, until --end if it is given.`,
+		Example: `historydb generate-his-db \
+	--modb=/data/smartbchd/data/modb \
+	--hisdb=./hisdb \
+	--end=2650514 \
+	--batch-blocks=1000
+
+historydb generate-his-db \
+	--modb=/data/smartbchd/data/modb \
+	--hisdb=./hisdb \
+	--follow`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagModb, flagHisDb); err != nil {
+				return err
+			}
+			follow, end := viper.GetBool(flagFollow), viper.GetUint64(flagEnd)
+			if end == 0 {
+				if !follow {
+					return fmt.Errorf("--%s is required without --%s", flagEnd, flagFollow)
+				}
+				end = math.MaxUint64
+			}
+			r, err := newHeightRange(viper.GetUint64(flagStart), end)
+			if err != nil {
+				return err
+			}
+			cfg := fillConfig{
+				batchBlocks:  viper.GetUint64(flagBatch),
+				follow:       follow,
+				pollInterval: viper.GetDuration(flagPoll),
+			}
+			return generateHisDb(viper.GetString(flagModb), viper.GetString(flagHisDb), r, cfg)
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagModb, "", "modb directory of smartbchd")
+	cmd.Flags().String(flagHisDb, "", "directory of the history db to write")
+	cmd.Flags().Uint64(flagStart, 1, "first height, a history db which is not empty resumes from the height after its last one")
+	cmd.Flags().Uint64(flagEnd, 0, "last height, it can be left out with --follow")
+	cmd.Flags().Uint64(flagBatch, 100, "number of blocks written in one batch")
+	cmd.Flags().Bool(flagFollow, false, "keep appending the new heights of modb")
+	cmd.Flags().Duration(flagPoll, 10*time.Second, "how often modb is checked for new heights with --follow")
+	_ = cmd.MarkFlagRequired(flagModb)
+	_ = cmd.MarkFlagRequired(flagHisDb)
+	return cmd
+}
+
+func runTestcasesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "run-testcases",
+		Aliases: []string{"runTestcases"},
+		Short:   "check the historical accounts, bytecodes and storage served by smartbchd against a history db",
+		Long: `Check the historical accounts, bytecodes and storage served by smartbchd
+against a history db. Only the records alive in [--start, --end] are tested,
+they can be narrowed down to some addresses, to the storage keys with a prefix
+and to a sample of them. The same --seed samples the same records.`,
+		Example: `historydb run-testcases \
+	--hisdb=./hisdb \
+	--rpc-url=http://127.0.0.1:8545 \
+	--end=2650514 \
+	--workers=32 \
+	--rate=500 \
+	--report=report.jsonl
+
+historydb run-testcases \
+	--hisdb=./hisdb \
+	--rpc-url=http://127.0.0.1:8545 \
+	--start=2000000 \
+	--end=2650514 \
+	--addresses=0x5D0171c4AB2745412B148aF5C803C62605b19cD6,0x42A02Ab30C79247D96689C3776aA2faCC1F19dc3 \
+	--sample=10 \
+	--seed=7`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagHisDb, flagRpcUrl, flagReport); err != nil {
+				return err
+			}
+			r, err := getHeightRange()
+			if err != nil {
+				return err
+			}
+			filter, err := newRecordFilter(viper.GetStringSlice(flagAddresses), viper.GetString(flagKeyPrefix),
+				viper.GetFloat64(flagSample), viper.GetInt64(flagSeed))
+			if err != nil {
+				return err
+			}
+			filter.skipStaking = viper.GetBool(flagNoStaking)
+			cfg := verifyConfig{
+				workers: viper.GetInt(flagWorkers),
+				rate:    viper.GetFloat64(flagRate),
+				retries: viper.GetInt(flagRetries),
+				seed:    viper.GetInt64(flagSeed),
+				filter:  filter,
+			}
+			return runWithReport(func(report *testReport) error {
+				return runTestcases(viper.GetString(flagHisDb), viper.GetString(flagRpcUrl), r, cfg, report)
+			})
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagHisDb, "", "directory of the history db")
+	cmd.Flags().String(flagRpcUrl, "http://127.0.0.1:8545", "RPC URL of smartbchd")
+	addHeightFlags(cmd, "last height the history db was generated to")
+	cmd.Flags().String(flagReport, "report.jsonl", "JSONL file to write the mismatched checks to")
+	cmd.Flags().Bool(flagReportAll, false, "also write the matched checks to the report")
+	cmd.Flags().Int(flagWorkers, 8, "number of records checked at the same time")
+	cmd.Flags().Float64(flagRate, 0, "max RPC requests per second, 0 for no limit")
+	cmd.Flags().Int(flagRetries, 5, "how many times a request failed by a connection error is retried")
+	cmd.Flags().StringSlice(flagAddresses, nil, "only test the records of these addresses")
+	cmd.Flags().String(flagKeyPrefix, "", "only test the storage records whose keys start with this hex prefix")
+	cmd.Flags().Float64(flagSample, 100, "percent of the records to test, sampled by --seed")
+	cmd.Flags().Int64(flagSeed, 1, "seed of the sample and the random heights checked in the middle of the records")
+	cmd.Flags().Bool(flagNoStaking, false, "skip the storage of the staking contract, which is only checked at the heights it was written")
+	_ = cmd.MarkFlagRequired(flagHisDb)
+	return cmd
+}
+
+func testTxsInModbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test-txs-in-modb",
+		Short: "check the txs, receipts and logs served by smartbchd against modb",
+		Long: `Check the txs, receipts and logs served by smartbchd against the txs in
+modb. Every tx in [--start, --end] is queried by its hash, by its block and
+index, and for its receipt. The logs are queried with eth_getLogs over
+--logs-range blocks at a time, once for every address and once for every
+first topic of the logs in the blocks. modb is opened read-only, so it may
+be the modb of the smartbchd under test.`,
+		Example: `historydb test-txs-in-modb \
+	--modb=/data/smartbchd/data/modb \
+	--rpc-url=http://127.0.0.1:8545 \
+	--start=2000000 \
+	--end=2650514 \
+	--rate=500 \
+	--report=txs-report.jsonl`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagModb, flagRpcUrl, flagReport); err != nil {
+				return err
+			}
+			r, err := getHeightRange()
+			if err != nil {
+				return err
+			}
+			cfg := txVerifyConfig{
+				rate:      viper.GetFloat64(flagRate),
+				retries:   viper.GetInt(flagRetries),
+				logsRange: viper.GetUint64(flagLogsRange),
+			}
+			return runWithReport(func(report *testReport) error {
+				return testTxsInModb(viper.GetString(flagModb), viper.GetString(flagRpcUrl), r, cfg, report)
+			})
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagModb, "", "modb directory of smartbchd")
+	cmd.Flags().String(flagRpcUrl, "http://127.0.0.1:8545", "RPC URL of smartbchd")
+	addHeightFlags(cmd, "last height")
+	cmd.Flags().String(flagReport, "report.jsonl", "JSONL file to write the mismatched checks to")
+	cmd.Flags().Bool(flagReportAll, false, "also write the matched checks to the report")
+	cmd.Flags().Float64(flagRate, 0, "max RPC requests per second, 0 for no limit")
+	cmd.Flags().Int(flagRetries, 5, "how many times a request failed by a connection error is retried")
+	cmd.Flags().Uint64(flagLogsRange, 100, "number of blocks queried by one eth_getLogs")
+	_ = cmd.MarkFlagRequired(flagModb)
+	return cmd
+}
+
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export the state changes in a history db",
+		Long: `Export the changes of the nonces, balances, bytecodes and storage slots
+in [--start, --end] from a history db, with the value before and after each
+change. The changes of a key are in the order of height. The jsonl and csv
+formats write a file, the columnar format writes a directory with a .col file
+for every column, whose n-th line is the value of the n-th change, and a
+columns.json listing the columns and the number of changes.`,
+		Example: `historydb export \
+	--hisdb=./hisdb \
+	--start=2000000 \
+	--addresses=0x5D0171c4AB2745412B148aF5C803C62605b19cD6 \
+	--format=csv \
+	--output=changes.csv`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := bindFlags(cmd, flagHisDb, flagFormat); err != nil {
+				return err
+			}
+			end := viper.GetUint64(flagEnd)
+			if end == 0 {
+				end = math.MaxUint64
+			}
+			r, err := newHeightRange(viper.GetUint64(flagStart), end)
+			if err != nil {
+				return err
+			}
+			filter, err := newRecordFilter(viper.GetStringSlice(flagAddresses), viper.GetString(flagKeyPrefix), 100, 0)
+			if err != nil {
+				return err
+			}
+			format, output := viper.GetString(flagFormat), viper.GetString(flagOutput)
+			if output == "" {
+				output = "changes"
+				if format != formatColumnar {
+					output += "." + format
+				}
+			}
+			w, err := newChangeWriter(format, output)
+			if err != nil {
+				return err
+			}
+			n, err := exportChanges(viper.GetString(flagHisDb), r, filter, w)
+			if closeErr := w.close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%d changes exported to %s\n", n, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().SortFlags = false
+	cmd.Flags().String(flagHisDb, "", "directory of the history db")
+	cmd.Flags().Uint64(flagStart, 1, "first height")
+	cmd.Flags().Uint64(flagEnd, 0, "last height, the last height of the history db by default")
+	cmd.Flags().StringSlice(flagAddresses, nil, "only export the changes of these addresses")
+	cmd.Flags().String(flagKeyPrefix, "", "only export the storage changes whose keys start with this hex prefix")
+	cmd.Flags().String(flagFormat, formatJSONL, "jsonl, csv or columnar")
+	cmd.Flags().String(flagOutput, "", "file to write, or directory for columnar, changes.<format> by default")
+	_ = cmd.MarkFlagRequired(flagHisDb)
+	return cmd
 }
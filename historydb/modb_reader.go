@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/tecbot/gorocksdb"
+
+	"github.com/smartbch/moeingdb/modb"
+	modbtypes "github.com/smartbch/moeingdb/types"
+)
+
+// modbFileSize is the size of each data file of modb, as in modb.NewMoDB.
+const modbFileSize = 2048 * 1024 * 1024
+
+// modbReader reads the blocks and the txs of a modb without writing to it, so
+// that the modb of a running smartbchd can be read. modb.NewMoDB can not do
+// it: it opens the metadb read-write, which fails on the lock held by
+// smartbchd, truncates the data file, indexes the pending block and loads the
+// index of the whole chain into memory.
+//
+// The metadb is opened as a read-only rocksdb instance, which takes no lock
+// and does not see the writes made after it is opened, so refresh reopens it
+// to find the new blocks. The data files are opened read-only and kept open.
+// The index of a block is read from the metadb when the block is read.
+type modbReader struct {
+	dir    string
+	metadb *gorocksdb.DB
+	ro     *gorocksdb.ReadOptions
+	files  map[int64]*os.File
+	seed   [8]byte
+	size   int64 // the size of the data files recorded in the metadb
+	latest int64
+
+	txs map[uint64][]int64 // the offsets of the txs in the last block read, by short hash
+	err error              // the first read error, DB can not return it
+}
+
+var _ modbtypes.DB = (*modbReader)(nil)
+
+func newModbReader(dir string) (*modbReader, error) {
+	r := &modbReader{
+		dir:   dir,
+		ro:    gorocksdb.NewDefaultReadOptions(),
+		files: make(map[int64]*os.File),
+	}
+	if err := r.refresh(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// refresh reopens the metadb to find the blocks indexed since the last
+// refresh.
+func (r *modbReader) refresh() error {
+	if r.metadb != nil {
+		r.metadb.Close()
+		r.metadb = nil
+	}
+	metadb, err := gorocksdb.OpenDbForReadOnly(gorocksdb.NewDefaultOptions(), filepath.Join(r.dir, "rocksdb.db"), false)
+	if err != nil {
+		return err
+	}
+	r.metadb = metadb
+	seed, err := r.get([]byte("SEED"))
+	if err != nil {
+		return err
+	}
+	copy(r.seed[:], seed)
+	size, err := r.get([]byte("HPF_SIZE"))
+	if err != nil {
+		return err
+	}
+	if len(size) != 8 {
+		return fmt.Errorf("no HPF_SIZE in the modb at %s", r.dir)
+	}
+	r.size = int64(binary.LittleEndian.Uint64(size))
+	r.latest, err = r.latestHeight()
+	return err
+}
+
+// latestHeight returns the last height whose data is on disk. smartbchd
+// flushes the data of a block after indexing it, and before indexing the next
+// one.
+func (r *modbReader) latestHeight() (int64, error) {
+	iter := r.metadb.NewIterator(r.ro)
+	defer iter.Close()
+	iter.SeekForPrev(blockKey(math.MaxUint32))
+	if !iter.Valid() {
+		return 0, iter.Err()
+	}
+	key := iter.Key()
+	defer key.Free()
+	bz := key.Data()
+	if len(bz) != 5 || bz[0] != 'B' {
+		return 0, nil
+	}
+	height := int64(binary.BigEndian.Uint32(bz[1:]))
+	idx, err := r.blockIndex(height)
+	if err != nil {
+		return 0, err
+	}
+	last := idx.BeginOffset
+	if n := len(idx.TxPosList); n != 0 {
+		last = idx.TxPosList[n-1]
+	}
+	if _, err = r.readEntry(last); errors.Is(err, io.EOF) {
+		return height - 1, nil
+	}
+	return height, err
+}
+
+func blockKey(height uint32) []byte {
+	key := []byte("B1234")
+	binary.BigEndian.PutUint32(key[1:], height)
+	return key
+}
+
+func (r *modbReader) get(key []byte) ([]byte, error) {
+	value, err := r.metadb.Get(r.ro, key)
+	if err != nil {
+		return nil, err
+	}
+	defer value.Free()
+	return append([]byte{}, value.Data()...), nil
+}
+
+// blockIndex returns nil if the block is not in the metadb.
+func (r *modbReader) blockIndex(height int64) (*modbtypes.BlockIndex, error) {
+	bz, err := r.get(blockKey(uint32(height)))
+	if err != nil || len(bz) == 0 {
+		return nil, err
+	}
+	idx := &modbtypes.BlockIndex{}
+	if _, err = idx.UnmarshalMsg(bz); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readEntry reads the data appended at offset40*32 by modb.
+func (r *modbReader) readEntry(offset40 int64) ([]byte, error) {
+	offset := modb.GetRealOffset(offset40*32, r.size)
+	var buf [4]byte
+	if err := r.readAt(buf[:], offset); err != nil {
+		return nil, err
+	}
+	bz := make([]byte, 4+int(binary.LittleEndian.Uint32(buf[:])))
+	if err := r.readAt(bz, offset); err != nil {
+		return nil, err
+	}
+	return bz[4:], nil
+}
+
+func (r *modbReader) readAt(buf []byte, offset int64) error {
+	id := offset / modbFileSize
+	f, ok := r.files[id]
+	if !ok {
+		var err error
+		f, err = os.Open(filepath.Join(r.dir, "data", fmt.Sprintf("%d-%d", id, modbFileSize)))
+		if err != nil {
+			return err
+		}
+		r.files[id] = f
+	}
+	_, err := f.ReadAt(buf, offset%modbFileSize)
+	return err
+}
+
+func (r *modbReader) GetLatestHeight() int64 {
+	return r.latest
+}
+
+func (r *modbReader) GetBlockByHeight(height int64) []byte {
+	if height > r.latest || r.err != nil {
+		return nil
+	}
+	idx, err := r.blockIndex(height)
+	if err != nil || idx == nil {
+		r.err = err
+		return nil
+	}
+	bz, err := r.readEntry(idx.BeginOffset)
+	if err != nil {
+		r.err = fmt.Errorf("failed to read block %d: %w", height, err)
+		return nil
+	}
+	r.txs = make(map[uint64][]int64, len(idx.TxHash48List))
+	for i, hash48 := range idx.TxHash48List {
+		r.txs[hash48] = append(r.txs[hash48], idx.TxPosList[i])
+	}
+	return bz
+}
+
+// GetTxByHash only finds the txs in the last block read by GetBlockByHeight.
+func (r *modbReader) GetTxByHash(hash [32]byte, collectResult func([]byte) bool) {
+	for _, offset40 := range r.txs[modb.Sum48(r.seed, hash[:])] {
+		bz, err := r.readEntry(offset40)
+		if err != nil {
+			if r.err == nil {
+				r.err = fmt.Errorf("failed to read tx %x: %w", hash, err)
+			}
+			return
+		}
+		if collectResult(bz) {
+			return
+		}
+	}
+}
+
+func (r *modbReader) Close() {
+	for _, f := range r.files {
+		f.Close()
+	}
+	if r.metadb != nil {
+		r.metadb.Close()
+	}
+	r.ro.Destroy()
+}
+
+// The methods below are not used by HistoryDb.Fill. They record an error,
+// which fillFromModb returns, instead of reading the modb.
+
+func (r *modbReader) unsupported(method string) error {
+	err := fmt.Errorf("modbReader does not support %s", method)
+	if r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func (r *modbReader) SetExtractNotificationFn(modbtypes.ExtractNotificationFromTxFn) {
+	r.unsupported("SetExtractNotificationFn")
+}
+
+func (r *modbReader) SetDisableComplexIndex(bool) {
+	r.unsupported("SetDisableComplexIndex")
+}
+
+func (r *modbReader) AddBlock(*modbtypes.Block, int64, map[[32]byte][65]byte) {
+	r.unsupported("AddBlock")
+}
+
+func (r *modbReader) GetBlockHashByHeight(int64) [32]byte {
+	r.unsupported("GetBlockHashByHeight")
+	return [32]byte{}
+}
+
+func (r *modbReader) GetTxByHeightAndIndex(int64, int) []byte {
+	r.unsupported("GetTxByHeightAndIndex")
+	return nil
+}
+
+func (r *modbReader) GetTxListByHeight(int64) [][]byte {
+	r.unsupported("GetTxListByHeight")
+	return nil
+}
+
+func (r *modbReader) GetTxListByHeightWithRange(int64, int, int) [][]byte {
+	r.unsupported("GetTxListByHeightWithRange")
+	return nil
+}
+
+func (r *modbReader) GetBlockByHash([32]byte, func([]byte) bool) {
+	r.unsupported("GetBlockByHash")
+}
+
+func (r *modbReader) BasicQueryLogs(*[20]byte, [][32]byte, uint32, uint32, func([]byte) bool) error {
+	return r.unsupported("BasicQueryLogs")
+}
+
+func (r *modbReader) QueryLogs([][20]byte, [][][32]byte, uint32, uint32, func([]byte) bool) error {
+	return r.unsupported("QueryLogs")
+}
+
+func (r *modbReader) QueryTxBySrc([20]byte, uint32, uint32, func([]byte) bool) error {
+	return r.unsupported("QueryTxBySrc")
+}
+
+func (r *modbReader) QueryTxByDst([20]byte, uint32, uint32, func([]byte) bool) error {
+	return r.unsupported("QueryTxByDst")
+}
+
+func (r *modbReader) QueryTxBySrcOrDst([20]byte, uint32, uint32, func([]byte) bool) error {
+	return r.unsupported("QueryTxBySrcOrDst")
+}
+
+func (r *modbReader) QueryNotificationCounter([]byte) int64 {
+	r.unsupported("QueryNotificationCounter")
+	return 0
+}
+
+func (r *modbReader) SetOpListsForCcUtxo(modbtypes.OpListsForCcUtxo) {
+	r.unsupported("SetOpListsForCcUtxo")
+}
+
+func (r *modbReader) GetUtxoInfos() [][36 + 1 + 20]byte {
+	r.unsupported("GetUtxoInfos")
+	return nil
+}
+
+func (r *modbReader) GetAllUtxoIds() [][36]byte {
+	r.unsupported("GetAllUtxoIds")
+	return nil
+}
+
+func (r *modbReader) GetRedeemableUtxoIds() [][36]byte {
+	r.unsupported("GetRedeemableUtxoIds")
+	return nil
+}
+
+func (r *modbReader) GetLostAndFoundUtxoIds() [][36]byte {
+	r.unsupported("GetLostAndFoundUtxoIds")
+	return nil
+}
+
+func (r *modbReader) GetRedeemingUtxoIds() [][36]byte {
+	r.unsupported("GetRedeemingUtxoIds")
+	return nil
+}
+
+func (r *modbReader) GetUtxoIdsByCovenantAddr([20]byte) [][36]byte {
+	r.unsupported("GetUtxoIdsByCovenantAddr")
+	return nil
+}
+
+func (r *modbReader) GetRedeemableUtxoIdsByCovenantAddr([20]byte) [][36]byte {
+	r.unsupported("GetRedeemableUtxoIdsByCovenantAddr")
+	return nil
+}
+
+func (r *modbReader) SetMaxEntryCount(int) {
+	r.unsupported("SetMaxEntryCount")
+}
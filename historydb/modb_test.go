@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/libs/log"
+
+	"github.com/smartbch/moeingdb/modb"
+	modbtypes "github.com/smartbch/moeingdb/types"
+	"github.com/smartbch/moeingevm/types"
+)
+
+// appendModbBlocks appends a block holding txs for every element of blocks to
+// the modb in dir, which is created if it does not exist. The heights and the
+// hashes of the blocks and the txs are filled in.
+func appendModbBlocks(t *testing.T, dir string, blocks ...[]*types.Transaction) {
+	var db *modb.MoDB
+	if _, err := os.Stat(filepath.Join(dir, "data")); os.IsNotExist(err) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "data"), 0700))
+		db = modb.CreateEmptyMoDB(dir, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}, log.NewNopLogger())
+	} else {
+		db = modb.NewMoDB(dir, log.NewNopLogger())
+	}
+	defer db.Close()
+
+	height := db.GetLatestHeight()
+	for _, txs := range blocks {
+		height++
+		blk := &types.Block{Number: height, Hash: testHash("block", uint64(height), 0)}
+		mblk := &modbtypes.Block{Height: height, BlockHash: blk.Hash}
+		for i, tx := range txs {
+			tx.Hash = testHash("tx", uint64(height), uint64(i))
+			tx.BlockNumber = height
+			tx.BlockHash = blk.Hash
+			tx.TransactionIndex = int64(i)
+			content, err := tx.MarshalMsg(nil)
+			require.NoError(t, err)
+			blk.Transactions = append(blk.Transactions, tx.Hash)
+			mblk.TxList = append(mblk.TxList, modbtypes.Tx{
+				HashId:  tx.Hash,
+				SrcAddr: tx.From,
+				DstAddr: tx.To,
+				Content: content,
+			})
+		}
+		var err error
+		mblk.BlockInfo, err = blk.MarshalMsg(nil)
+		require.NoError(t, err)
+		db.AddBlock(mblk, -1, nil)
+	}
+	db.AddBlock(nil, -1, nil) // wait for the last block to be indexed
+}
+
+func testHash(kind string, height, index uint64) (hash [32]byte) {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], height)
+	binary.BigEndian.PutUint64(buf[8:], index)
+	return sha256.Sum256(append([]byte(kind), buf[:]...))
+}
@@ -22,12 +22,16 @@ type OneTxDb struct {
 	rocksdb *it.RocksDB
 }
 
-func newOneTxDb(dirname string) *OneTxDb {
+func newOneTxDb(dirname string) (*OneTxDb, error) {
 	rocksdb, err := it.NewRocksDB(dirname, ".")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return &OneTxDb{rocksdb: rocksdb}
+	return &OneTxDb{rocksdb: rocksdb}, nil
+}
+
+func (db *OneTxDb) close() {
+	db.rocksdb.Close()
 }
 
 func (db *OneTxDb) addTx(height uint64, tx *moevmtypes.Transaction) {
@@ -40,10 +44,11 @@ func (db *OneTxDb) addTx(height uint64, tx *moevmtypes.Transaction) {
 	db.rocksdb.Set(key, val)
 }
 
-func (db *OneTxDb) getAllTxs(startHeight uint64, cb func(height uint64, tx *moevmtypes.Transaction)) {
-	end := []byte{255, 255, 255, 255, 255, 255, 255, 255}
+func (db *OneTxDb) getAllTxs(r heightRange, cb func(height uint64, tx *moevmtypes.Transaction) error) error {
 	start := make([]byte, 8)
-	binary.BigEndian.PutUint64(start, startHeight)
+	binary.BigEndian.PutUint64(start, r.start)
+	end := make([]byte, 8)
+	binary.BigEndian.PutUint64(end, r.end+1)
 
 	iter := db.rocksdb.Iterator(start, end)
 	defer iter.Close()
@@ -54,65 +59,103 @@ func (db *OneTxDb) getAllTxs(startHeight uint64, cb func(height uint64, tx *moev
 		tx := &moevmtypes.Transaction{}
 		_, err := tx.UnmarshalMsg(val)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("failed to decode the tx at height %d: %w", h, err)
+		}
+		if err = cb(h, tx); err != nil {
+			return err
 		}
-		cb(h, tx)
 	}
+	return nil
 }
 
-func generateOneTxDb(modbDir, oneTxDbDir string, endHeight uint64) {
-	oneTxDb := newOneTxDb(oneTxDbDir)
+func generateOneTxDb(modbDir, oneTxDbDir string, r heightRange) error {
+	oneTxDb, err := newOneTxDb(oneTxDbDir)
+	if err != nil {
+		return err
+	}
+	defer oneTxDb.close()
 	n := 0
-	cb := func(height uint64, tx *moevmtypes.Transaction) {
+	cb := func(height uint64, tx *moevmtypes.Transaction) error {
 		oneTxDb.addTx(height, tx)
 		n++
+		return nil
 	}
-	scanTheOnlyTxInBlocks(modbDir, endHeight, cb)
+	err = scanTheOnlyTxInBlocks(modbDir, r, cb)
 	fmt.Println("oneTx count:", n)
+	return err
 }
 
-func testTxsInOneTxDb(oneTxDbDir, rpcUrl string, startHeight uint64, stopOnErr bool) {
-	sbchCli := newSbchClient(rpcUrl)
-	oneTxDb := newOneTxDb(oneTxDbDir)
+func testTxsInOneTxDb(oneTxDbDir, rpcUrl string, r heightRange, stopOnErr bool) error {
+	sbchCli, err := newSbchClient(rpcUrl)
+	if err != nil {
+		return err
+	}
+	oneTxDb, err := newOneTxDb(oneTxDbDir)
+	if err != nil {
+		return err
+	}
+	defer oneTxDb.close()
 
-	cb := func(height uint64, tx *moevmtypes.Transaction) {
+	mismatches := 0
+	cb := func(height uint64, tx *moevmtypes.Transaction) error {
 		// if len(tx.Input) == 0 { // skip ether transfers
-		// 	return
+		// 	return nil
 		// }
 
 		fmt.Print("height: ", height, " tx: 0x", hex.EncodeToString(tx.Hash[:]))
 		if tx.Status == 0 { // skip failed tx
 			fmt.Println(" SKIP")
-			return
-		} else if testTheOnlyTx(tx, sbchCli, height, stopOnErr) {
+			return nil
+		}
+		ok, err := testTheOnlyTx(tx, sbchCli, height, stopOnErr)
+		if err != nil {
+			fmt.Println(" ERROR")
+			return err
+		}
+		if ok {
 			fmt.Println(" OK")
-		} else {
-			fmt.Println(" FAIL")
-			if stopOnErr {
-				panic("callDetails not match!")
-			}
+			return nil
+		}
+		fmt.Println(" FAIL")
+		mismatches++
+		if stopOnErr {
+			return mismatchError{count: mismatches}
 		}
+		return nil
 	}
-	oneTxDb.getAllTxs(startHeight, cb)
+	if err = oneTxDb.getAllTxs(r, cb); err != nil {
+		return err
+	}
+	if mismatches != 0 {
+		return mismatchError{count: mismatches}
+	}
+	return nil
 }
 
-func testTheOnlyTxInBlocks(modbDir, rpcUrl string, endHeight uint64) {
-	sbchCli := newSbchClient(rpcUrl)
-	cb := func(height uint64, tx *moevmtypes.Transaction) {
-		if !testTheOnlyTx(tx, sbchCli, height, true) {
-			panic("callDetails not match!")
+func testTheOnlyTxInBlocks(modbDir, rpcUrl string, r heightRange) error {
+	sbchCli, err := newSbchClient(rpcUrl)
+	if err != nil {
+		return err
+	}
+	cb := func(height uint64, tx *moevmtypes.Transaction) error {
+		ok, err := testTheOnlyTx(tx, sbchCli, height, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return mismatchError{count: 1}
 		}
+		return nil
 	}
-	scanTheOnlyTxInBlocks(modbDir, endHeight, cb)
+	return scanTheOnlyTxInBlocks(modbDir, r, cb)
 }
 
-func scanTheOnlyTxInBlocks(modbDir string, endHeight uint64, cb func(height uint64, tx *moevmtypes.Transaction)) {
+func scanTheOnlyTxInBlocks(modbDir string, r heightRange, cb func(height uint64, tx *moevmtypes.Transaction) error) error {
 	_modb := modb.NewMoDB(modbDir, log.NewNopLogger())
 	ctx := moevmtypes.NewContext(nil, _modb)
-	for h := uint64(1); h < endHeight; h++ {
+	for h := r.start; h <= r.end; h++ {
 		blk, err := ctx.GetBlockByHeight(h)
 		if err != nil {
-			//panic(err)
 			fmt.Println(err.Error())
 			continue
 		}
@@ -123,13 +166,16 @@ func scanTheOnlyTxInBlocks(modbDir string, endHeight uint64, cb func(height uint
 		txHash := blk.Transactions[0]
 		tx, _, err := ctx.GetTxByHash(txHash)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("failed to get tx %s: %w", common.Hash(txHash), err)
+		}
+		if err = cb(h, tx); err != nil {
+			return err
 		}
-		cb(h, tx)
 	}
+	return nil
 }
 
-func testTheOnlyTx(tx *moevmtypes.Transaction, sbchCli *SbchClient, height uint64, printsDetail bool) bool {
+func testTheOnlyTx(tx *moevmtypes.Transaction, sbchCli *SbchClient, height uint64, printsDetail bool) (bool, error) {
 	to := common.Address(tx.To)
 	toPtr := &to
 	if to == [20]byte{} {
@@ -149,10 +195,10 @@ func testTheOnlyTx(tx *moevmtypes.Transaction, sbchCli *SbchClient, height uint6
 	//_, _ = sbchCli.ethCall(callMsg, h)
 	callDetail, err := sbchCli.sbchCall(callMsg, h)
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("sbch_call failed at height %d: %w", height, err)
 	}
 
-	return compareCallDetail(tx, callDetail, printsDetail)
+	return compareCallDetail(tx, callDetail, printsDetail), nil
 }
 
 func compareCallDetail(tx *moevmtypes.Transaction, rpcCallDetail *sbchrpc.CallDetail, printsDetail bool) bool {
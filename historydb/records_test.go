@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+type recordKey struct {
+	addr        common.Address
+	key         string
+	startHeight uint64
+}
+
+func TestGenerateRecords(t *testing.T) {
+	eoa := common.HexToAddress("0xe0a")
+	contract := common.HexToAddress("0xc0de")
+	k1, k2, k3 := string(make([]byte, 32)), string(common.HexToHash("0x02").Bytes()), string(common.HexToHash("0x03").Bytes())
+	code := func(b byte) []byte { return append(make([]byte, 33), b) }
+	create := func(seq uint64, b byte) *types.ReadWriteLists {
+		return &types.ReadWriteLists{
+			AccountWList:  []types.AccountRWOp{{Addr: contract, Account: newAccount(seq, 1, 0)}},
+			BytecodeWList: []types.BytecodeRWOp{{Addr: contract, Bytecode: code(b)}},
+		}
+	}
+	setSlot := func(seq uint64, key string, value byte) *types.ReadWriteLists {
+		return &types.ReadWriteLists{
+			AccountRList: []types.AccountRWOp{{Addr: contract, Account: newAccount(seq, 1, 0)}},
+			StorageWList: []types.StorageRWOp{{Seq: seq, Key: key, Value: []byte{value}}},
+		}
+	}
+	selfDestruct := &types.ReadWriteLists{AccountWList: []types.AccountRWOp{{Addr: contract, Account: []byte{}}}}
+
+	hisDb, err := NewHisDb(t.TempDir())
+	require.NoError(t, err)
+	defer hisDb.Close()
+	for _, w := range []struct {
+		height  uint64
+		rwLists *types.ReadWriteLists
+	}{
+		{1, &types.ReadWriteLists{AccountWList: []types.AccountRWOp{{Addr: eoa, Account: newAccount(1, 1, 100)}}}},
+		{2, create(5, 1)},
+		{2, setSlot(5, k1, 1)},
+		{3, &types.ReadWriteLists{AccountWList: []types.AccountRWOp{{Addr: eoa, Account: newAccount(1, 2, 90)}}}},
+		{3, setSlot(5, k1, 2)},
+		{4, setSlot(5, k2, 1)},
+		{5, selfDestruct},
+		{7, create(6, 2)}, // re-created with a new sequence
+		{7, setSlot(6, k1, 3)},
+		{8, setSlot(6, k2, 2)},
+		{9, selfDestruct},
+		{10, create(7, 3)},
+		{10, setSlot(7, k3, 1)},
+		{11, selfDestruct}, // deleted and re-created in the same block
+		{11, create(8, 4)},
+		{11, setSlot(8, k3, 2)},
+	} {
+		require.NoError(t, hisDb.AddRwLists(w.height, w.rwLists))
+	}
+
+	expected := map[recordKey]uint64{
+		// creation and overwrite
+		{eoa, "account", 1}: 3,
+		{eoa, "account", 3}: 20,
+		// the empty records after the self-destructs end at the re-creations
+		{contract, "account", 2}:   5,
+		{contract, "account", 5}:   7,
+		{contract, "account", 7}:   9,
+		{contract, "account", 9}:   10,
+		{contract, "account", 10}:  11,
+		{contract, "account", 11}:  20,
+		{contract, "bytecode", 2}:  5,
+		{contract, "bytecode", 5}:  7,
+		{contract, "bytecode", 7}:  9,
+		{contract, "bytecode", 9}:  10,
+		{contract, "bytecode", 10}: 11,
+		{contract, "bytecode", 11}: 20,
+		{contract, k1, 2}:          3,
+		// ended by the self-destruct at 5, not by the write of the re-created contract at 7
+		{contract, k1, 3}: 5,
+		{contract, k2, 4}: 5,
+		// ended by the second self-destruct, not by the first one
+		{contract, k1, 7}: 9,
+		{contract, k2, 8}: 9,
+		// ended by the self-destruct at 11, the slot written after the
+		// re-creation at 11 is not
+		{contract, k3, 10}: 11,
+		{contract, k3, 11}: 20,
+	}
+	check := func(recChan chan HistoricalRecord, addrs ...common.Address) {
+		n := 0
+		for rec := range recChan {
+			key := recordKey{rec.Addr, rec.Key, rec.StartHeight}
+			require.Contains(t, expected, key)
+			require.Equal(t, expected[key], rec.EndHeight, "%s %x %d", key.addr, key.key, key.startHeight)
+			n++
+		}
+		for key := range expected {
+			for _, addr := range addrs {
+				if key.addr == addr {
+					n--
+				}
+			}
+		}
+		require.Zero(t, n)
+	}
+	recChan := make(chan HistoricalRecord, 100)
+	go hisDb.GenerateRecords(recChan, 20, nil)
+	check(recChan, eoa, contract)
+	recChan = make(chan HistoricalRecord, 100)
+	go hisDb.GenerateRecordsOf(recChan, 20, [][20]byte{contract}, nil, nil)
+	check(recChan, contract)
+
+	// stops without sending the rest when done is closed
+	recChan = make(chan HistoricalRecord)
+	done := make(chan struct{})
+	go hisDb.GenerateRecords(recChan, 20, done)
+	<-recChan
+	close(done)
+	n := 1
+	for range recChan {
+		n++
+	}
+	require.Less(t, n, len(expected))
+
+	dels := hisDb.getDeletions(contract)
+	require.Equal(t, []uint64{5, 9, 11}, dels.heights)
+	require.Equal(t, uint64(11), dels.recreatedAt)
+}
+
+func TestPlanTestcase(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	key := string(make([]byte, 32))
+	tc, err := planTestcase(HistoricalRecord{Addr: stakingContractAddr, Key: key, StartHeight: 10, EndHeight: 20}, rnd)
+	require.NoError(t, err)
+	require.Equal(t, []string{kindStaking}, tc.kinds)
+	require.Equal(t, []uint64{10}, tc.heights)
+
+	tc, err = planTestcase(HistoricalRecord{Key: key, StartHeight: 10, EndHeight: 20}, rnd)
+	require.NoError(t, err)
+	require.Equal(t, []string{kindStorage, kindStorage, kindStorage}, tc.kinds)
+	require.Equal(t, uint64(10), tc.heights[0])
+	require.True(t, tc.heights[1] >= 10 && tc.heights[1] < 20)
+	require.Equal(t, uint64(19), tc.heights[2])
+
+	// the balance is not checked at the end of a record
+	tc, err = planTestcase(HistoricalRecord{Key: "account", StartHeight: 10, EndHeight: 20}, rnd)
+	require.NoError(t, err)
+	require.Equal(t, []string{kindNonce, kindBalance, kindNonce, kindBalance, kindNonce}, tc.kinds)
+	require.Equal(t, uint64(19), tc.heights[4])
+
+	_, err = planTestcase(HistoricalRecord{Key: "code", StartHeight: 10, EndHeight: 20}, rnd)
+	require.Error(t, err)
+
+	f := recordFilter{skipStaking: true}
+	require.False(t, f.match(HistoricalRecord{Addr: stakingContractAddr, Key: key}))
+	require.True(t, f.match(HistoricalRecord{Addr: stakingContractAddr, Key: "account"}))
+}
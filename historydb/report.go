@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	kindBalance  = "balance"
+	kindNonce    = "nonce"
+	kindBytecode = "bytecode"
+	kindStorage  = "storage"
+	kindStaking  = "staking" // storage of the staking contract
+	kindTx       = "tx"
+	kindTxIndex  = "tx-index" // tx queried by its block and index
+	kindReceipt  = "receipt"
+	kindLogs     = "logs"
+)
+
+// neighbour is what the node returns at a height next to a mismatched one,
+// which tells an off-by-one from a wrong value.
+type neighbour struct {
+	Height uint64 `json:"height"`
+	Actual string `json:"actual,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// checkResult is the result of checking one record at one height, it is
+// written as one line of the JSONL report.
+type checkResult struct {
+	Kind        string         `json:"kind"`
+	Address     common.Address `json:"address"`
+	Key         string         `json:"key,omitempty"` // storage key, tx hash or log topic in hex
+	Height      uint64         `json:"height"`
+	StartHeight uint64         `json:"startHeight"` // the record is valid in [StartHeight, EndHeight)
+	EndHeight   uint64         `json:"endHeight"`
+	Deleted     bool           `json:"deleted,omitempty"`
+	Expected    string         `json:"expected"`
+	Actual      string         `json:"actual"`
+	Match       bool           `json:"match"`
+	Neighbours  []neighbour    `json:"neighbours,omitempty"`
+}
+
+type kindTotals struct {
+	Checked    int `json:"checked"`
+	Mismatched int `json:"mismatched"`
+}
+
+// testReport writes the mismatched results (or all results) as JSONL and
+// counts the results by kind.
+type testReport struct {
+	enc        *json.Encoder
+	all        bool
+	Kinds      map[string]*kindTotals
+	Mismatches int
+}
+
+func newTestReport(w io.Writer, all bool) *testReport {
+	return &testReport{
+		enc:   json.NewEncoder(w),
+		all:   all,
+		Kinds: make(map[string]*kindTotals),
+	}
+}
+
+func (r *testReport) add(res checkResult) error {
+	totals, ok := r.Kinds[res.Kind]
+	if !ok {
+		totals = &kindTotals{}
+		r.Kinds[res.Kind] = totals
+	}
+	totals.Checked++
+	if !res.Match {
+		totals.Mismatched++
+		r.Mismatches++
+	}
+	if res.Match && !r.all {
+		return nil
+	}
+	return r.enc.Encode(res)
+}
+
+func (r *testReport) printSummary(w io.Writer) {
+	kinds := make([]string, 0, len(r.Kinds))
+	for kind := range r.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "%-10s %12s %12s\n", "kind", "checked", "mismatched")
+	for _, kind := range kinds {
+		totals := r.Kinds[kind]
+		fmt.Fprintf(w, "%-10s %12d %12d\n", kind, totals.Checked, totals.Mismatched)
+	}
+}
+
+// err returns a mismatchError if any check failed.
+func (r *testReport) err() error {
+	if r.Mismatches != 0 {
+		return mismatchError{count: r.Mismatches}
+	}
+	return nil
+}
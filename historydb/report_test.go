@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+func TestExpectedState(t *testing.T) {
+	accInfo := types.ZeroAccountInfo()
+	accInfo.UpdateBalance(uint256.NewInt(12345))
+	accInfo.UpdateNonce(7)
+	account := HistoricalRecord{Key: "account", Value: accInfo.Bytes()}
+	require.Equal(t, "12345", expectedState(account, kindBalance))
+	require.Equal(t, "7", expectedState(account, kindNonce))
+
+	bytecode := HistoricalRecord{Key: "bytecode", Value: append(make([]byte, 33), 0x60, 0x80)}
+	require.Equal(t, "0x6080", expectedState(bytecode, kindBytecode))
+
+	storage := HistoricalRecord{Key: string(make([]byte, 32)), Value: append(make([]byte, 31), 0x01)}
+	require.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000001",
+		expectedState(storage, kindStorage))
+
+	// deleted records read as zero
+	require.Equal(t, "0", expectedState(HistoricalRecord{Key: "account"}, kindBalance))
+	require.Equal(t, "0", expectedState(HistoricalRecord{Key: "account"}, kindNonce))
+	require.Equal(t, "0x", expectedState(HistoricalRecord{Key: "bytecode"}, kindBytecode))
+	require.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000000",
+		expectedState(HistoricalRecord{Key: storage.Key}, kindStorage))
+}
+
+func TestTestReport(t *testing.T) {
+	var buf bytes.Buffer
+	report := newTestReport(&buf, false)
+	require.NoError(t, report.add(checkResult{Kind: kindNonce, Height: 1, Expected: "1", Actual: "1", Match: true}))
+	require.NoError(t, report.add(checkResult{Kind: kindNonce, Height: 2, Expected: "1", Actual: "2",
+		Neighbours: []neighbour{{Height: 1, Actual: "1"}, {Height: 3, Actual: "2"}}}))
+	require.NoError(t, report.add(checkResult{Kind: kindStorage, Height: 5, Expected: "0x00", Actual: "0x00", Match: true}))
+	require.Equal(t, 2, report.Kinds[kindNonce].Checked)
+	require.Equal(t, 1, report.Kinds[kindNonce].Mismatched)
+	require.Equal(t, 1, report.Kinds[kindStorage].Checked)
+	require.Equal(t, 0, report.Kinds[kindStorage].Mismatched)
+	require.Equal(t, mismatchError{count: 1}, report.err())
+
+	// only the mismatch is written
+	scanner := bufio.NewScanner(&buf)
+	require.True(t, scanner.Scan())
+	var res checkResult
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &res))
+	require.Equal(t, uint64(2), res.Height)
+	require.Len(t, res.Neighbours, 2)
+	require.False(t, scanner.Scan())
+
+	var summary strings.Builder
+	report.printSummary(&summary)
+	require.Equal(t, `kind            checked   mismatched
+nonce                 2            1
+storage               1            0
+`, summary.String())
+
+	buf.Reset()
+	report = newTestReport(&buf, true)
+	require.NoError(t, report.add(checkResult{Kind: kindNonce, Match: true}))
+	require.NoError(t, report.err())
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+}
@@ -17,17 +17,17 @@ type SbchClient struct {
 	ethCli *ethclient.Client
 }
 
-func newSbchClient(url string) *SbchClient {
+func newSbchClient(url string) (*SbchClient, error) {
 	rpcCli, err := rpc.DialContext(context.Background(), url)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	ethCli := ethclient.NewClient(rpcCli)
 	return &SbchClient{
 		rpcCli: rpcCli,
 		ethCli: ethCli,
-	}
+	}, nil
 }
 
 func (cli *SbchClient) ethCall(msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
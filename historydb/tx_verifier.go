@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+type txVerifyConfig struct {
+	rate      float64 // RPC requests per second, 0 for no limit
+	retries   int
+	logsRange uint64 // number of blocks queried by one eth_getLogs
+}
+
+// rpcTx is the fields of eth_getTransactionByHash checked against modb.
+type rpcTx struct {
+	Hash             common.Hash     `json:"hash"`
+	BlockHash        common.Hash     `json:"blockHash"`
+	BlockNumber      hexutil.Uint64  `json:"blockNumber"`
+	TransactionIndex hexutil.Uint64  `json:"transactionIndex"`
+	From             common.Address  `json:"from"`
+	To               *common.Address `json:"to"`
+	Nonce            hexutil.Uint64  `json:"nonce"`
+	Gas              hexutil.Uint64  `json:"gas"`
+	GasPrice         *hexutil.Big    `json:"gasPrice"`
+	Value            *hexutil.Big    `json:"value"`
+	Input            hexutil.Bytes   `json:"input"`
+}
+
+// rpcReceipt is the fields of eth_getTransactionReceipt checked against modb.
+type rpcReceipt struct {
+	TransactionHash   common.Hash      `json:"transactionHash"`
+	TransactionIndex  hexutil.Uint64   `json:"transactionIndex"`
+	BlockHash         common.Hash      `json:"blockHash"`
+	BlockNumber       hexutil.Uint64   `json:"blockNumber"`
+	From              common.Address   `json:"from"`
+	To                *common.Address  `json:"to"`
+	CumulativeGasUsed hexutil.Uint64   `json:"cumulativeGasUsed"`
+	GasUsed           hexutil.Uint64   `json:"gasUsed"`
+	ContractAddress   *common.Address  `json:"contractAddress"`
+	Logs              []*gethtypes.Log `json:"logs"`
+	LogsBloom         hexutil.Bytes    `json:"logsBloom"`
+	Status            hexutil.Uint64   `json:"status"`
+	StatusStr         string           `json:"statusStr,omitempty"` // only for the failed txs
+	OutData           string           `json:"outData,omitempty"`
+}
+
+func optionalAddress(addr [20]byte) *common.Address {
+	if addr == [20]byte{} {
+		return nil
+	}
+	a := common.Address(addr)
+	return &a
+}
+
+func expectedTx(tx *types.Transaction) *rpcTx {
+	return &rpcTx{
+		Hash:             tx.Hash,
+		BlockHash:        tx.BlockHash,
+		BlockNumber:      hexutil.Uint64(tx.BlockNumber),
+		TransactionIndex: hexutil.Uint64(tx.TransactionIndex),
+		From:             tx.From,
+		To:               optionalAddress(tx.To),
+		Nonce:            hexutil.Uint64(tx.Nonce),
+		Gas:              hexutil.Uint64(tx.Gas),
+		GasPrice:         (*hexutil.Big)(new(big.Int).SetBytes(tx.GasPrice[:])),
+		Value:            (*hexutil.Big)(new(big.Int).SetBytes(tx.Value[:])),
+		Input:            tx.Input,
+	}
+}
+
+func expectedReceipt(tx *types.Transaction) *rpcReceipt {
+	receipt := &rpcReceipt{
+		TransactionHash:   tx.Hash,
+		TransactionIndex:  hexutil.Uint64(tx.TransactionIndex),
+		BlockHash:         tx.BlockHash,
+		BlockNumber:       hexutil.Uint64(tx.BlockNumber),
+		From:              tx.From,
+		To:                optionalAddress(tx.To),
+		CumulativeGasUsed: hexutil.Uint64(tx.CumulativeGasUsed),
+		GasUsed:           hexutil.Uint64(tx.GasUsed),
+		ContractAddress:   optionalAddress(tx.ContractAddress),
+		Logs:              types.ToGethLogs(tx.Logs),
+		LogsBloom:         tx.LogsBloom[:],
+		Status:            hexutil.Uint64(tx.Status),
+	}
+	if tx.Status == types.ReceiptStatusFailed {
+		receipt.StatusStr = tx.StatusStr
+		receipt.OutData = hex.EncodeToString(tx.OutData)
+	}
+	return receipt
+}
+
+// testTxsInModb checks the txs of the blocks in r in modb against the txs,
+// receipts and logs smartbchd returns, the results are added to report.
+func testTxsInModb(modbDir, rpcUrl string, r heightRange, cfg txVerifyConfig, report *testReport) error {
+	if cfg.logsRange < 1 {
+		cfg.logsRange = 1
+	}
+	rpcCli, err := getRpcClient(rpcUrl, 1)
+	if err != nil {
+		return err
+	}
+	v := &verifier{ethCli: ethclient.NewClient(rpcCli), rpcCli: rpcCli, retries: cfg.retries}
+	defer v.limitRate(cfg.rate)()
+	reader, err := newModbReader(modbDir)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if latest := uint64(reader.GetLatestHeight()); latest < r.end {
+		return fmt.Errorf("modb only has the heights up to %d", latest)
+	}
+	mctx := types.NewContext(nil, reader)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	started, lastProgress := time.Now(), time.Now()
+	txCount := 0
+	for from := r.start; from <= r.end; from += cfg.logsRange {
+		blocks := heightRange{start: from, end: from + cfg.logsRange - 1}
+		if blocks.end > r.end {
+			blocks.end = r.end
+		}
+		results, n, err := v.checkBlocks(ctx, mctx, blocks)
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted at height %d", from)
+		} else if reader.err != nil {
+			return reader.err
+		} else if err != nil {
+			return err
+		}
+		for _, res := range results {
+			if err = report.add(res); err != nil {
+				return err
+			}
+		}
+		txCount += n
+		if time.Since(lastProgress) >= progressInterval {
+			lastProgress = time.Now()
+			fmt.Printf("tested %d txs up to height %d, %d mismatches\n", txCount, blocks.end, report.Mismatches)
+		}
+	}
+	fmt.Printf("%d txs in %d blocks tested in %s\n", txCount, r.end-r.start+1, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// checkBlocks checks the txs of the blocks in r and their logs, it returns
+// the number of the txs.
+func (v *verifier) checkBlocks(ctx context.Context, mctx *types.Context, r heightRange) ([]checkResult, int, error) {
+	txs, err := getTxsInBlocks(mctx, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	var results []checkResult
+	for _, tx := range txs {
+		res, err := v.checkTx(ctx, tx)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, res...)
+	}
+	res, err := v.checkLogs(ctx, r, txs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(results, res...), len(txs), nil
+}
+
+func getTxsInBlocks(ctx *types.Context, r heightRange) ([]*types.Transaction, error) {
+	var txs []*types.Transaction
+	for h := r.start; h <= r.end; h++ {
+		blk, err := ctx.GetBlockByHeight(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", h, err)
+		}
+		for _, txHash := range blk.Transactions {
+			tx, _, err := ctx.GetTxByHash(txHash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get tx %s: %w", common.Hash(txHash), err)
+			}
+			txs = append(txs, tx)
+		}
+	}
+	return txs, nil
+}
+
+// checkTx queries tx by its hash, by its block and index, and its receipt.
+func (v *verifier) checkTx(ctx context.Context, tx *types.Transaction) ([]checkResult, error) {
+	hash := common.Hash(tx.Hash)
+	height := uint64(tx.BlockNumber)
+	results := make([]checkResult, 0, 3)
+	for _, kind := range []string{kindTx, kindTxIndex, kindReceipt} {
+		res := checkResult{
+			Kind:        kind,
+			Address:     tx.From,
+			Key:         hash.Hex(),
+			Height:      height,
+			StartHeight: height,
+			EndHeight:   height + 1,
+		}
+		var expected interface{}
+		var err error
+		switch kind {
+		case kindTx:
+			expected = expectedTx(tx)
+			var actual *rpcTx
+			res.Actual, err = v.callJSON(ctx, &actual, "eth_getTransactionByHash", hash)
+		case kindTxIndex:
+			expected = expectedTx(tx)
+			var actual *rpcTx
+			res.Actual, err = v.callJSON(ctx, &actual, "eth_getTransactionByBlockNumberAndIndex",
+				hexutil.Uint64(height), hexutil.Uint64(tx.TransactionIndex))
+		case kindReceipt:
+			expected = expectedReceipt(tx)
+			var actual *rpcReceipt
+			res.Actual, err = v.callJSON(ctx, &actual, "eth_getTransactionReceipt", hash)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the %s of %s: %w", kind, hash, err)
+		}
+		res.Expected = toJSON(expected)
+		res.Match = res.Expected == res.Actual
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// checkLogs queries the logs of txs, which are in the blocks of r, once for
+// every address emitting them and once for every first topic of them. An
+// eth_getLogs without addresses and topics returns nothing from smartbchd.
+func (v *verifier) checkLogs(ctx context.Context, r heightRange, txs []*types.Transaction) ([]checkResult, error) {
+	var logs []*gethtypes.Log
+	addrSet := make(map[common.Address]bool)
+	topicSet := make(map[common.Hash]bool)
+	for _, tx := range txs {
+		for _, l := range types.ToGethLogs(tx.Logs) {
+			logs = append(logs, l)
+			addrSet[l.Address] = true
+			if len(l.Topics) != 0 {
+				topicSet[l.Topics[0]] = true
+			}
+		}
+	}
+	addrs := make([]common.Address, 0, len(addrSet))
+	for addr := range addrSet {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	topics := make([]common.Hash, 0, len(topicSet))
+	for topic := range topicSet {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool { return bytes.Compare(topics[i][:], topics[j][:]) < 0 })
+
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(r.start),
+		ToBlock:   new(big.Int).SetUint64(r.end),
+	}
+	results := make([]checkResult, 0, len(addrs)+len(topics))
+	for _, addr := range addrs {
+		q := query
+		q.Addresses = []common.Address{addr}
+		res, err := v.checkLogQuery(ctx, r, q, checkResult{Address: addr}, logs, func(l *gethtypes.Log) bool {
+			return l.Address == addr
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	for _, topic := range topics {
+		q := query
+		q.Topics = [][]common.Hash{{topic}}
+		res, err := v.checkLogQuery(ctx, r, q, checkResult{Key: topic.Hex()}, logs, func(l *gethtypes.Log) bool {
+			return len(l.Topics) != 0 && l.Topics[0] == topic
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (v *verifier) checkLogQuery(ctx context.Context, r heightRange, q ethereum.FilterQuery, res checkResult,
+	logs []*gethtypes.Log, match func(l *gethtypes.Log) bool) (checkResult, error) {
+
+	var expected []*gethtypes.Log
+	for _, l := range logs {
+		if match(l) {
+			expected = append(expected, l)
+		}
+	}
+	res.Kind = kindLogs
+	res.Height, res.StartHeight, res.EndHeight = r.start, r.start, r.end+1
+	res.Expected = toJSON(expected)
+	var actual []gethtypes.Log
+	err := v.call(ctx, func(ctx context.Context) (err error) {
+		ctx, cancel := context.WithTimeout(ctx, Timeout)
+		defer cancel()
+		actual, err = v.ethCli.FilterLogs(ctx, q)
+		return err
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to get the logs in [%d, %d]: %w", r.start, r.end, err)
+	}
+	res.Actual = toJSON(actual)
+	res.Match = res.Expected == res.Actual
+	return res, nil
+}
+
+// callJSON calls method and decodes the response into result, which is
+// returned as JSON, so that only the fields of result are compared.
+func (v *verifier) callJSON(ctx context.Context, result interface{}, method string, args ...interface{}) (string, error) {
+	err := v.call(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, Timeout)
+		defer cancel()
+		return v.rpcCli.CallContext(ctx, result, method, args...)
+	})
+	if err != nil {
+		return "", err
+	}
+	return toJSON(result), nil
+}
+
+func toJSON(v interface{}) string {
+	bz, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(bz)
+}
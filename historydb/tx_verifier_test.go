@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// fakeTxApi serves the txs, receipts and logs as smartbchd formats them.
+type fakeTxApi struct {
+	txs []*types.Transaction
+	// the bugs of smartbchd
+	wrongGasUsed common.Hash    // the receipt of the tx has a wrong gasUsed
+	unindexed    common.Address // the logs of the address are not found by address
+}
+
+func (api *fakeTxApi) txResp(tx *types.Transaction) map[string]interface{} {
+	resp := map[string]interface{}{
+		"hash":             common.Hash(tx.Hash),
+		"blockHash":        common.Hash(tx.BlockHash),
+		"blockNumber":      (*hexutil.Big)(big.NewInt(tx.BlockNumber)),
+		"transactionIndex": hexutil.Uint64(tx.TransactionIndex),
+		"from":             common.Address(tx.From),
+		"nonce":            hexutil.Uint64(tx.Nonce),
+		"gas":              hexutil.Uint64(tx.Gas),
+		"gasPrice":         (*hexutil.Big)(new(big.Int).SetBytes(tx.GasPrice[:])),
+		"value":            (*hexutil.Big)(new(big.Int).SetBytes(tx.Value[:])),
+		"input":            hexutil.Bytes(tx.Input),
+		"v":                "0x1b",
+	}
+	if tx.To != [20]byte{} {
+		resp["to"] = common.Address(tx.To)
+	}
+	return resp
+}
+
+func (api *fakeTxApi) GetTransactionByHash(hash common.Hash) map[string]interface{} {
+	for _, tx := range api.txs {
+		if tx.Hash == hash {
+			return api.txResp(tx)
+		}
+	}
+	return nil
+}
+
+func (api *fakeTxApi) GetTransactionByBlockNumberAndIndex(number rpc.BlockNumber, idx hexutil.Uint) map[string]interface{} {
+	for _, tx := range api.txs {
+		if tx.BlockNumber == number.Int64() && tx.TransactionIndex == int64(idx) {
+			return api.txResp(tx)
+		}
+	}
+	return nil
+}
+
+func (api *fakeTxApi) GetTransactionReceipt(hash common.Hash) map[string]interface{} {
+	for _, tx := range api.txs {
+		if tx.Hash != hash {
+			continue
+		}
+		resp := map[string]interface{}{
+			"transactionHash":   common.Hash(tx.Hash),
+			"transactionIndex":  hexutil.Uint64(tx.TransactionIndex),
+			"blockHash":         common.Hash(tx.BlockHash),
+			"blockNumber":       hexutil.Uint64(tx.BlockNumber),
+			"from":              common.Address(tx.From),
+			"to":                nil,
+			"cumulativeGasUsed": hexutil.Uint64(tx.CumulativeGasUsed),
+			"contractAddress":   nil,
+			"gasUsed":           hexutil.Uint64(tx.GasUsed),
+			"logs":              types.ToGethLogs(tx.Logs),
+			"logsBloom":         hexutil.Bytes(tx.LogsBloom[:]),
+			"status":            hexutil.Uint(tx.Status),
+		}
+		if tx.To != [20]byte{} {
+			resp["to"] = common.Address(tx.To)
+		}
+		if tx.ContractAddress != [20]byte{} {
+			resp["contractAddress"] = common.Address(tx.ContractAddress)
+		}
+		if tx.Status == types.ReceiptStatusFailed {
+			resp["statusStr"] = tx.StatusStr
+			resp["outData"] = hex.EncodeToString(tx.OutData)
+		}
+		if hash == api.wrongGasUsed {
+			resp["gasUsed"] = hexutil.Uint64(tx.GasUsed + 1)
+		}
+		return resp
+	}
+	return nil
+}
+
+type logsCriteria struct {
+	FromBlock hexutil.Uint64   `json:"fromBlock"`
+	ToBlock   hexutil.Uint64   `json:"toBlock"`
+	Addresses []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+}
+
+// GetLogs matches the addresses and the first topics only.
+func (api *fakeTxApi) GetLogs(crit logsCriteria) []*gethtypes.Log {
+	logs := []*gethtypes.Log{}
+	if len(crit.Addresses) == 0 && len(crit.Topics) == 0 {
+		return logs
+	}
+	for _, tx := range api.txs {
+		if uint64(tx.BlockNumber) < uint64(crit.FromBlock) || uint64(tx.BlockNumber) > uint64(crit.ToBlock) {
+			continue
+		}
+		for _, l := range types.ToGethLogs(tx.Logs) {
+			if len(crit.Addresses) != 0 && (crit.Addresses[0] != l.Address || l.Address == api.unindexed) {
+				continue
+			}
+			if len(crit.Topics) != 0 && (len(l.Topics) == 0 || crit.Topics[0][0] != l.Topics[0]) {
+				continue
+			}
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+func TestTestTxsInModb(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	c, d, e := common.HexToAddress("0xc"), common.HexToAddress("0xd"), common.HexToAddress("0xe")
+	t1, t2 := common.HexToHash("0x01"), common.HexToHash("0x02")
+	newLog := func(addr common.Address, topics ...common.Hash) types.Log {
+		l := types.Log{Address: addr, Data: []byte{0x01}}
+		for _, topic := range topics {
+			l.Topics = append(l.Topics, topic)
+		}
+		return l
+	}
+	blocks := [][]*types.Transaction{
+		{
+			{From: a, To: c, Nonce: 1, Gas: 100000, GasUsed: 30000, CumulativeGasUsed: 30000, Status: 1,
+				Input: []byte{0x12, 0x34}, Logs: []types.Log{newLog(c, t1), newLog(c, t2, t1)}},
+			{From: b, Gas: 200000, GasUsed: 150000, CumulativeGasUsed: 180000, Status: 1, ContractAddress: d,
+				Logs: []types.Log{newLog(d, t1)}},
+		},
+		{},
+		{
+			{From: a, To: c, Nonce: 2, Gas: 100000, GasUsed: 21000, CumulativeGasUsed: 21000,
+				StatusStr: "revert", OutData: []byte{0x08, 0xc3}},
+			{From: b, To: c, Nonce: 1, Gas: 100000, GasUsed: 25000, CumulativeGasUsed: 46000, Status: 1,
+				Logs: []types.Log{newLog(c, t1), newLog(e)}},
+		},
+	}
+	blocks[0][0].GasPrice[31] = 10
+	blocks[0][0].Value[31] = 1
+	modbDir := t.TempDir()
+	appendModbBlocks(t, modbDir, blocks...)
+	api := &fakeTxApi{unindexed: e}
+	for _, txs := range blocks {
+		api.txs = append(api.txs, txs...)
+	}
+	api.wrongGasUsed = blocks[2][1].Hash
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	require.NoError(t, server.RegisterName("eth", api))
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	var out bytes.Buffer
+	report := newTestReport(&out, false)
+	cfg := txVerifyConfig{retries: 1, logsRange: 2}
+	require.NoError(t, testTxsInModb(modbDir, httpServer.URL, heightRange{start: 1, end: 3}, cfg, report))
+	require.Equal(t, 2, report.Mismatches)
+	for _, kind := range []string{kindTx, kindTxIndex, kindReceipt} {
+		require.Equal(t, 4, report.Kinds[kind].Checked)
+	}
+	require.Equal(t, 1, report.Kinds[kindReceipt].Mismatched)
+	// c, d, t1 and t2 in [1, 2], c, e and t1 in [3, 3]
+	require.Equal(t, 7, report.Kinds[kindLogs].Checked)
+	require.Equal(t, 1, report.Kinds[kindLogs].Mismatched)
+	require.Contains(t, out.String(), `"kind":"logs","address":"0x000000000000000000000000000000000000000e","height":3,"startHeight":3,"endHeight":4`)
+	require.Contains(t, out.String(), `"actual":"[]"`)
+
+	err := testTxsInModb(modbDir, httpServer.URL, heightRange{start: 1, end: 4}, cfg, report)
+	require.EqualError(t, err, "modb only has the heights up to 3")
+
+	// the modb is opened read-only, a missing one is an error, not created
+	require.Error(t, testTxsInModb(t.TempDir(), httpServer.URL, heightRange{start: 1, end: 3}, cfg, report))
+}
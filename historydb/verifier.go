@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	retryInterval    = time.Second
+	progressInterval = 10 * time.Second
+)
+
+type verifyConfig struct {
+	workers int
+	rate    float64 // RPC requests per second, 0 for no limit
+	retries int
+	seed    int64 // seed of the random heights in the middle of the records
+	filter  recordFilter
+}
+
+// verifier runs the checks of the testcases, it is shared by the workers.
+type verifier struct {
+	ethCli  *ethclient.Client
+	rpcCli  *rpc.Client // for the methods ethclient does not decode as needed
+	limiter <-chan time.Time
+	retries int
+}
+
+type testcaseResult struct {
+	seq     int
+	results []checkResult
+	err     error
+}
+
+// runTestcases checks the records which are alive in [r.start, r.end] with
+// cfg.workers workers, the results are added to report in the order of the
+// records.
+func runTestcases(hisdbDir, rpcUrl string, r heightRange, cfg verifyConfig, report *testReport) error {
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+	ethCli, err := getEthClient(rpcUrl, cfg.workers)
+	if err != nil {
+		return err
+	}
+	hisDb, err := NewHisDb(hisdbDir)
+	if err != nil {
+		return err
+	}
+	defer hisDb.Close()
+	v := &verifier{ethCli: ethCli, retries: cfg.retries}
+	defer v.limitRate(cfg.rate)()
+
+	total := countTestcases(hisDb, r, cfg.filter)
+	fmt.Printf("%d records to test\n", total)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the producer can only run ahead of the oldest unfinished testcase by
+	// the size of window, which bounds the results waiting to be reported
+	window := make(chan struct{}, cfg.workers*16)
+	testcases := make(chan testcase)
+	results := make(chan testcaseResult, cfg.workers)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(testcases)
+		stopRecords := make(chan struct{})
+		recChan := cfg.filter.records(hisDb, r.end+1, stopRecords)
+		defer func() {
+			// let GenerateRecords stop when we return early, and wait for it
+			close(stopRecords)
+			for range recChan {
+			}
+		}()
+		rnd := rand.New(rand.NewSource(cfg.seed))
+		seq := 0
+		for rec := range recChan {
+			if !cfg.filter.match(rec) {
+				continue
+			}
+			rec, ok := aliveRecord(rec, r)
+			if !ok {
+				continue
+			}
+			tc, err := planTestcase(rec, rnd)
+			if err != nil {
+				results <- testcaseResult{seq: -1, err: err}
+				return
+			}
+			tc.seq = seq
+			seq++
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case testcases <- tc:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for i := 0; i < cfg.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tc := range testcases {
+				res, err := v.run(ctx, tc)
+				select {
+				case results <- testcaseResult{seq: tc.seq, results: res, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	started, lastProgress := time.Now(), time.Now()
+	pending := make(map[int][]checkResult)
+	next := 0
+	var runErr error
+	for res := range results {
+		if res.err != nil {
+			if runErr == nil && ctx.Err() == nil {
+				runErr = res.err
+			}
+			cancel()
+			continue
+		}
+		if runErr != nil {
+			continue
+		}
+		pending[res.seq] = res.results
+		for checks, ok := pending[next]; ok; checks, ok = pending[next] {
+			delete(pending, next)
+			next++
+			<-window
+			for _, check := range checks {
+				if err = report.add(check); err != nil {
+					runErr = err
+					cancel()
+					break
+				}
+			}
+			if time.Since(lastProgress) >= progressInterval {
+				lastProgress = time.Now()
+				printProgress(next, total, report.Mismatches, time.Since(started))
+			}
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if next < total {
+		return fmt.Errorf("interrupted after %d of %d records", next, total)
+	}
+	fmt.Printf("%d records tested in %s\n", next, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// countTestcases counts the records to test, so that the ETA can be shown.
+func countTestcases(hisDb *HistoryDb, r heightRange, f recordFilter) int {
+	n := 0
+	for rec := range f.records(hisDb, r.end+1, nil) {
+		if !f.match(rec) {
+			continue
+		}
+		if _, ok := aliveRecord(rec, r); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func printProgress(done, total, mismatches int, elapsed time.Duration) {
+	speed := float64(done) / elapsed.Seconds()
+	eta := "unknown"
+	if speed > 0 {
+		eta = time.Duration(float64(total-done) / speed * float64(time.Second)).Round(time.Second).String()
+	}
+	fmt.Printf("tested %d/%d records, %d mismatches, %.1f records/s, ETA %s\n",
+		done, total, mismatches, speed, eta)
+}
+
+func (v *verifier) run(ctx context.Context, tc testcase) ([]checkResult, error) {
+	results := make([]checkResult, 0, len(tc.kinds))
+	for i, kind := range tc.kinds {
+		res, err := v.check(ctx, tc.rec, kind, tc.heights[i])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// check compares the state recorded in rec with the one smartbchd returns
+// at height, on a mismatch the neighbouring heights are also queried.
+func (v *verifier) check(ctx context.Context, rec HistoricalRecord, kind string, height uint64) (checkResult, error) {
+	res := checkResult{
+		Kind:        kind,
+		Address:     rec.Addr,
+		Height:      height,
+		StartHeight: rec.StartHeight,
+		EndHeight:   rec.EndHeight,
+		Deleted:     len(rec.Value) == 0,
+		Expected:    expectedState(rec, kind),
+	}
+	if kind == kindStorage || kind == kindStaking {
+		res.Key = hexutil.Encode([]byte(rec.Key))
+	}
+	var err error
+	res.Actual, err = v.query(ctx, rec, kind, height)
+	if err != nil {
+		return res, fmt.Errorf("failed to get the %s of %s at %d: %w", kind, res.Address, height, err)
+	}
+	res.Match = res.Expected == res.Actual
+	if !res.Match {
+		for _, h := range []uint64{height - 1, height + 1} {
+			if h == 0 {
+				continue
+			}
+			n := neighbour{Height: h}
+			n.Actual, err = v.query(ctx, rec, kind, h)
+			if err != nil {
+				n.Error = err.Error()
+			}
+			res.Neighbours = append(res.Neighbours, n)
+		}
+	}
+	return res, nil
+}
+
+// limitRate limits the requests to rate per second, 0 for no limit. The
+// returned function stops the limiter.
+func (v *verifier) limitRate(rate float64) func() {
+	if rate <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	v.limiter = ticker.C
+	return ticker.Stop
+}
+
+func (v *verifier) query(ctx context.Context, rec HistoricalRecord, kind string, height uint64) (string, error) {
+	var state string
+	err := v.call(ctx, func(ctx context.Context) (err error) {
+		state, err = queryState(ctx, v.ethCli, rec, kind, height)
+		return err
+	})
+	return state, err
+}
+
+// call sends a rate-limited request with f, which is retried on transient
+// errors.
+func (v *verifier) call(ctx context.Context, f func(ctx context.Context) error) error {
+	for i := 0; ; i++ {
+		if v.limiter != nil {
+			select {
+			case <-v.limiter:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := f(ctx)
+		if err == nil || i >= v.retries || !isTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(retryInterval * time.Duration(i+1)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// isTransient tells the errors of the connection, such as timeouts and
+// refused connections, from the errors returned by smartbchd.
+func isTransient(err error) bool {
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smartbch/moeingevm/types"
+)
+
+// stateWrite is the state of an address (or a storage slot) since height.
+type stateWrite struct {
+	height uint64
+	value  []byte
+}
+
+// fakeEth serves the historical state queried by runTestcases.
+type fakeEth struct {
+	accounts  map[common.Address][]stateWrite
+	bytecodes map[common.Address][]stateWrite
+	storage   map[common.Address]map[common.Hash][]stateWrite
+}
+
+func stateAt(writes []stateWrite, number rpc.BlockNumber) []byte {
+	var value []byte
+	for _, w := range writes {
+		if w.height <= uint64(number) {
+			value = w.value
+		}
+	}
+	return value
+}
+
+func (e *fakeEth) GetBalance(addr common.Address, number rpc.BlockNumber) *hexutil.Big {
+	value := stateAt(e.accounts[addr], number)
+	if len(value) == 0 {
+		return (*hexutil.Big)(big.NewInt(0))
+	}
+	return (*hexutil.Big)(types.NewAccountInfo(value).Balance().ToBig())
+}
+
+func (e *fakeEth) GetTransactionCount(addr common.Address, number rpc.BlockNumber) hexutil.Uint64 {
+	value := stateAt(e.accounts[addr], number)
+	if len(value) == 0 {
+		return 0
+	}
+	return hexutil.Uint64(types.NewAccountInfo(value).Nonce())
+}
+
+func (e *fakeEth) GetCode(addr common.Address, number rpc.BlockNumber) hexutil.Bytes {
+	value := stateAt(e.bytecodes[addr], number)
+	if len(value) == 0 {
+		return hexutil.Bytes{}
+	}
+	return types.NewBytecodeInfo(value).BytecodeSlice()
+}
+
+func (e *fakeEth) GetStorageAt(addr common.Address, key common.Hash, number rpc.BlockNumber) hexutil.Bytes {
+	return common.LeftPadBytes(stateAt(e.storage[addr][key], number), 32)
+}
+
+func newAccount(seq, nonce, balance uint64) []byte {
+	accInfo := types.ZeroAccountInfo()
+	accInfo.UpdateSequence(seq)
+	accInfo.UpdateNonce(nonce)
+	accInfo.UpdateBalance(uint256.NewInt(balance))
+	return accInfo.Bytes()
+}
+
+func TestRunTestcases(t *testing.T) {
+	eoa := common.HexToAddress("0xe0a")
+	contract := common.HexToAddress("0xc0de")
+	slot := common.HexToHash("0x01")
+	eoaAcc2, eoaAcc6 := newAccount(1, 1, 100), newAccount(1, 2, 50)
+	contractAcc := newAccount(2, 1, 0)
+	bytecode := append(make([]byte, 33), 0x60, 0x80)
+	one, two := common.LeftPadBytes([]byte{1}, 32), common.LeftPadBytes([]byte{2}, 32)
+
+	hisdbDir := t.TempDir()
+	hisDb, err := NewHisDb(hisdbDir)
+	require.NoError(t, err)
+	require.NoError(t, hisDb.AddRwLists(2, &types.ReadWriteLists{
+		AccountWList: []types.AccountRWOp{{Addr: eoa, Account: eoaAcc2}},
+	}))
+	require.NoError(t, hisDb.AddRwLists(3, &types.ReadWriteLists{
+		AccountWList:  []types.AccountRWOp{{Addr: contract, Account: contractAcc}},
+		BytecodeWList: []types.BytecodeRWOp{{Addr: contract, Bytecode: bytecode}},
+		StorageWList:  []types.StorageRWOp{{Seq: 2, Key: string(slot[:]), Value: one}},
+	}))
+	require.NoError(t, hisDb.AddRwLists(5, &types.ReadWriteLists{
+		AccountRList: []types.AccountRWOp{{Addr: contract, Account: contractAcc}},
+		StorageWList: []types.StorageRWOp{{Seq: 2, Key: string(slot[:]), Value: two}},
+	}))
+	require.NoError(t, hisDb.AddRwLists(6, &types.ReadWriteLists{
+		AccountWList: []types.AccountRWOp{{Addr: eoa, Account: eoaAcc6}},
+	}))
+	hisDb.Close()
+
+	// smartbchd returns a wrong balance of eoa since height 6
+	eth := &fakeEth{
+		accounts: map[common.Address][]stateWrite{
+			eoa:      {{2, eoaAcc2}, {6, newAccount(1, 2, 51)}},
+			contract: {{3, contractAcc}},
+		},
+		bytecodes: map[common.Address][]stateWrite{contract: {{3, bytecode}}},
+		storage: map[common.Address]map[common.Hash][]stateWrite{
+			contract: {slot: {{3, one}, {5, two}}},
+		},
+	}
+	server := rpc.NewServer()
+	defer server.Stop()
+	require.NoError(t, server.RegisterName("eth", eth))
+	// the first requests fail with 503, which are retried
+	var lock sync.Mutex
+	failures := 2
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		fail := failures > 0
+		failures--
+		lock.Unlock()
+		if fail {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		server.ServeHTTP(w, req)
+	}))
+	defer httpServer.Close()
+
+	r := heightRange{start: 1, end: 10}
+	var serial bytes.Buffer
+	report := newTestReport(&serial, true)
+	err = runTestcases(hisdbDir, httpServer.URL, r, verifyConfig{workers: 1, retries: 3, seed: 1}, report)
+	require.NoError(t, err) // the failed requests were retried
+	// the balances at the start and in the middle of the second eoa record
+	require.Equal(t, 2, report.Mismatches)
+	require.Equal(t, 2, report.Kinds[kindBalance].Mismatched)
+	require.Equal(t, mismatchError{count: 2}, report.err())
+	// 3 account records, 1 bytecode record and 2 storage records
+	require.Equal(t, 3*5, report.Kinds[kindNonce].Checked+report.Kinds[kindBalance].Checked)
+	require.Equal(t, 3, report.Kinds[kindBytecode].Checked)
+	require.Equal(t, 6, report.Kinds[kindStorage].Checked)
+
+	var parallel bytes.Buffer
+	report = newTestReport(&parallel, true)
+	err = runTestcases(hisdbDir, httpServer.URL, r, verifyConfig{workers: 8, rate: 1000, retries: 3, seed: 1}, report)
+	require.NoError(t, err)
+	require.Equal(t, serial.String(), parallel.String())
+}